@@ -0,0 +1,252 @@
+package crypto
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// ChecksumManifest is a list of file checksums in the format
+// produced and consumed by sha1sum/sha256sum/sha512sum.
+type ChecksumManifest struct {
+	Algorithm Algorithm
+	Entries   []ChecksumManifestEntry
+}
+
+type ChecksumManifestEntry struct {
+	// Path is relative to the manifest's directory and always uses forward slashes
+	Path   string
+	Digest Digest
+}
+
+// ChecksumManifestReport lists every file that did not match the manifest.
+type ChecksumManifestReport struct {
+	Missing  []string
+	Extra    []string
+	Modified []string
+}
+
+// NewChecksumManifest computes a checksum of every regular file under dir.
+// Symlinks to files are followed, like sha256sum does; directories are not listed.
+func NewChecksumManifest(dir string, fs boshsys.FileSystem, algo Algorithm) (ChecksumManifest, error) {
+	paths, err := checksumManifestFiles(dir, fs)
+	if err != nil {
+		return ChecksumManifest{}, err
+	}
+
+	manifest := ChecksumManifest{Algorithm: algo}
+
+	for _, path := range paths {
+		digest, err := directoryFileDigest(filepath.Join(dir, filepath.FromSlash(path)), fs, algo)
+		if err != nil {
+			return ChecksumManifest{}, err
+		}
+
+		manifest.Entries = append(manifest.Entries, ChecksumManifestEntry{Path: path, Digest: digest})
+	}
+
+	return manifest, nil
+}
+
+// ParseChecksumManifest parses sha*sum output. Both text ("  ") and
+// binary (" *") separators as well as escaped file names are supported.
+func ParseChecksumManifest(content string, algo Algorithm) (ChecksumManifest, error) {
+	manifest := ChecksumManifest{Algorithm: algo}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		escaped := strings.HasPrefix(line, "\\")
+		if escaped {
+			line = line[1:]
+		}
+
+		hex, path, found := strings.Cut(line, " ")
+		if !found || len(path) < 2 || (path[0] != ' ' && path[0] != '*') {
+			return ChecksumManifest{}, bosherr.Errorf("Parsing checksum manifest line %d: Expected '<checksum>  <path>'", lineNum)
+		}
+		path = path[1:]
+
+		if !isStringAlphanumeric(hex) {
+			return ChecksumManifest{}, bosherr.Errorf("Parsing checksum manifest line %d: Checksum can only contain alpha-numeric characters", lineNum)
+		}
+
+		if escaped {
+			path = unescapeChecksumManifestPath(path)
+		}
+
+		manifest.Entries = append(manifest.Entries, ChecksumManifestEntry{
+			Path:   strings.TrimPrefix(filepath.ToSlash(path), "./"),
+			Digest: NewDigest(algo, hex),
+		})
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return ChecksumManifest{}, bosherr.WrapError(err, "Reading checksum manifest")
+	}
+
+	return manifest, nil
+}
+
+// String renders the manifest so that it can be checked with `sha256sum -c` (or sha1sum/sha512sum).
+func (m ChecksumManifest) String() string {
+	var sb strings.Builder
+
+	for _, entry := range m.Entries {
+		path := entry.Path
+		if strings.ContainsAny(path, "\\\n") {
+			sb.WriteString("\\")
+			path = strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(path)
+		}
+
+		fmt.Fprintf(&sb, "%s  %s\n", checksumManifestHex(entry.Digest), path)
+	}
+
+	return sb.String()
+}
+
+// Verify compares the manifest against the regular files under dir.
+// Returned error is only set when dir could not be read;
+// mismatches are reported through ChecksumManifestReport.
+func (m ChecksumManifest) Verify(dir string, fs boshsys.FileSystem) (ChecksumManifestReport, error) {
+	report := ChecksumManifestReport{}
+
+	paths, err := checksumManifestFiles(dir, fs)
+	if err != nil {
+		return report, err
+	}
+
+	present := map[string]struct{}{}
+	for _, path := range paths {
+		present[path] = struct{}{}
+	}
+
+	expected := map[string]struct{}{}
+
+	for _, entry := range m.Entries {
+		expected[entry.Path] = struct{}{}
+
+		if _, found := present[entry.Path]; !found {
+			report.Missing = append(report.Missing, entry.Path)
+			continue
+		}
+
+		actual, err := directoryFileDigest(filepath.Join(dir, filepath.FromSlash(entry.Path)), fs, entry.Digest.Algorithm())
+		if err != nil {
+			return report, err
+		}
+
+		if checksumManifestHex(actual) != checksumManifestHex(entry.Digest) {
+			report.Modified = append(report.Modified, entry.Path)
+		}
+	}
+
+	for _, path := range paths {
+		if _, found := expected[path]; !found {
+			report.Extra = append(report.Extra, path)
+		}
+	}
+
+	sort.Strings(report.Missing)
+	sort.Strings(report.Modified)
+
+	return report, nil
+}
+
+func (r ChecksumManifestReport) Matches() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Modified) == 0
+}
+
+func (r ChecksumManifestReport) Err() error {
+	if r.Matches() {
+		return nil
+	}
+
+	var errs []error
+	for _, path := range r.Missing {
+		errs = append(errs, bosherr.Errorf("Missing file '%s'", path))
+	}
+	for _, path := range r.Extra {
+		errs = append(errs, bosherr.Errorf("Unexpected file '%s'", path))
+	}
+	for _, path := range r.Modified {
+		errs = append(errs, bosherr.Errorf("Modified file '%s'", path))
+	}
+
+	return bosherr.NewMultiError(errs...)
+}
+
+func checksumManifestFiles(dir string, fs boshsys.FileSystem) ([]string, error) {
+	dir = filepath.Clean(dir)
+
+	var paths []string
+
+	err := fs.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			info, err = fs.Stat(path)
+			if err != nil {
+				return bosherr.WrapErrorf(err, "Following symlink '%s'", path)
+			}
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		paths = append(paths, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Walking directory '%s'", dir)
+	}
+
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+func checksumManifestHex(digest Digest) string {
+	return strings.TrimPrefix(digest.String(), digest.Algorithm().Name()+":")
+}
+
+func unescapeChecksumManifestPath(path string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+1 < len(path) {
+			i++
+			switch path[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			default:
+				sb.WriteByte(path[i])
+			}
+			continue
+		}
+		sb.WriteByte(path[i])
+	}
+
+	return sb.String()
+}
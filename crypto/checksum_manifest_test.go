@@ -0,0 +1,142 @@
+package crypto_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/bosh-utils/crypto"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+var _ = Describe("ChecksumManifest", func() {
+	var (
+		fs  boshsys.FileSystem
+		dir string
+	)
+
+	BeforeEach(func() {
+		fs = boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+		dir = GinkgoT().TempDir()
+
+		Expect(os.MkdirAll(filepath.Join(dir, "sub"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "hello"), []byte("hello world"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "sub", "empty"), []byte{}, 0644)).To(Succeed())
+	})
+
+	Describe("NewChecksumManifest", func() {
+		It("produces sha256sum compatible output sorted by path", func() {
+			manifest, err := NewChecksumManifest(dir, fs, DigestAlgorithmSHA256)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(manifest.String()).To(Equal(
+				"b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9  hello\n" +
+					"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  sub/empty\n",
+			))
+		})
+
+		It("produces sha1sum compatible output", func() {
+			manifest, err := NewChecksumManifest(dir, fs, DigestAlgorithmSHA1)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(manifest.String()).To(HavePrefix("2aae6c35c94fcfb415dbe95f408b9ce91ee846ed  hello\n"))
+		})
+
+		It("lists files that symlinks point to but not directories", func() {
+			Expect(os.Symlink("hello", filepath.Join(dir, "link"))).To(Succeed())
+			Expect(os.Symlink("sub", filepath.Join(dir, "dir-link"))).To(Succeed())
+
+			manifest, err := NewChecksumManifest(dir, fs, DigestAlgorithmSHA256)
+			Expect(err).ToNot(HaveOccurred())
+
+			var paths []string
+			for _, entry := range manifest.Entries {
+				paths = append(paths, entry.Path)
+			}
+			Expect(paths).To(Equal([]string{"hello", "link", "sub/empty"}))
+		})
+
+		It("escapes file names containing backslashes", func() {
+			Expect(os.WriteFile(filepath.Join(dir, `back\slash`), []byte("hello world"), 0644)).To(Succeed())
+
+			manifest, err := NewChecksumManifest(dir, fs, DigestAlgorithmSHA256)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(manifest.String()).To(HavePrefix(`\b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9  back\\slash` + "\n"))
+
+			parsed, err := ParseChecksumManifest(manifest.String(), DigestAlgorithmSHA256)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed.Entries[0].Path).To(Equal(`back\slash`))
+		})
+	})
+
+	Describe("ParseChecksumManifest", func() {
+		It("parses text and binary mode lines", func() {
+			manifest, err := ParseChecksumManifest(
+				"b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9  ./hello\n"+
+					"\n"+
+					"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 *sub/empty\r\n",
+				DigestAlgorithmSHA256,
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(manifest.Entries).To(HaveLen(2))
+			Expect(manifest.Entries[0].Path).To(Equal("hello"))
+			Expect(manifest.Entries[0].Digest.String()).To(Equal("sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"))
+			Expect(manifest.Entries[1].Path).To(Equal("sub/empty"))
+		})
+
+		It("returns an error identifying malformed lines", func() {
+			_, err := ParseChecksumManifest("abc  hello\nnot-a-manifest-line\n", DigestAlgorithmSHA256)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Parsing checksum manifest line 2: Expected '<checksum>  <path>'"))
+		})
+
+		It("returns an error for non alpha-numeric checksums", func() {
+			_, err := ParseChecksumManifest("ab!c  hello\n", DigestAlgorithmSHA256)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Parsing checksum manifest line 1: Checksum can only contain alpha-numeric characters"))
+		})
+	})
+
+	Describe("Verify", func() {
+		var manifest ChecksumManifest
+
+		BeforeEach(func() {
+			var err error
+			manifest, err = NewChecksumManifest(dir, fs, DigestAlgorithmSHA256)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("reports no mismatches for an unchanged directory", func() {
+			report, err := manifest.Verify(dir, fs)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Matches()).To(BeTrue())
+			Expect(report.Err()).ToNot(HaveOccurred())
+		})
+
+		It("reports missing, extra and modified files individually", func() {
+			Expect(os.Remove(filepath.Join(dir, "sub", "empty"))).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "hello"), []byte("goodbye"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "sub", "new"), []byte("new"), 0644)).To(Succeed())
+
+			report, err := manifest.Verify(dir, fs)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(report.Matches()).To(BeFalse())
+			Expect(report.Missing).To(Equal([]string{"sub/empty"}))
+			Expect(report.Extra).To(Equal([]string{"sub/new"}))
+			Expect(report.Modified).To(Equal([]string{"hello"}))
+
+			Expect(report.Err()).To(MatchError("Missing file 'sub/empty'\nUnexpected file 'sub/new'\nModified file 'hello'"))
+		})
+
+		It("returns an error if the directory cannot be walked", func() {
+			_, err := manifest.Verify(filepath.Join(dir, "missing"), fs)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Walking directory"))
+		})
+	})
+})
@@ -0,0 +1,187 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+const (
+	directoryEntryTypeFile    = "file"
+	directoryEntryTypeDir     = "dir"
+	directoryEntryTypeSymlink = "symlink"
+)
+
+type directoryEntry struct {
+	name   string
+	kind   string
+	mode   os.FileMode
+	digest string
+}
+
+// NewDirectoryDigest computes a deterministic digest of the tree rooted at dir.
+// Each directory is hashed over its sorted entries (type, mode, name and the
+// digest of the entry) so the root digest changes if any path, mode,
+// symlink target or file content anywhere in the tree changes.
+// Symlinks are not followed; their target path is hashed instead. Trees
+// containing other special files, such as FIFOs or sockets, are rejected.
+func NewDirectoryDigest(dir string, fs boshsys.FileSystem, algo Algorithm) (Digest, error) {
+	dir = filepath.Clean(dir)
+
+	var paths []string
+	infos := map[string]os.FileInfo{}
+
+	err := fs.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		infos[path] = info
+		return nil
+	})
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Walking directory '%s'", dir)
+	}
+
+	if len(paths) == 0 {
+		return nil, bosherr.Errorf("Directory '%s' does not exist", dir)
+	}
+
+	if !infos[paths[0]].IsDir() {
+		return nil, bosherr.Errorf("Expected '%s' to be a directory", dir)
+	}
+
+	children := map[string][]directoryEntry{}
+
+	// Walk visits parents before their children, so going backwards
+	// guarantees that each directory's entries are complete when it is hashed.
+	for i := len(paths) - 1; i >= 0; i-- {
+		path := paths[i]
+		info := infos[path]
+
+		entry := directoryEntry{name: filepath.Base(path)}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := fs.Readlink(path)
+			if err != nil {
+				return nil, bosherr.WrapErrorf(err, "Reading symlink '%s'", path)
+			}
+
+			digest, err := algo.CreateDigest(bytes.NewReader([]byte(filepath.ToSlash(target))))
+			if err != nil {
+				return nil, bosherr.WrapErrorf(err, "Calculating digest of symlink '%s'", path)
+			}
+
+			entry.kind = directoryEntryTypeSymlink
+			entry.digest = digest.String()
+
+		case info.IsDir():
+			digest, err := directoryEntriesDigest(children[path], algo)
+			if err != nil {
+				return nil, bosherr.WrapErrorf(err, "Calculating digest of directory '%s'", path)
+			}
+			delete(children, path)
+
+			if i == 0 {
+				return digest, nil
+			}
+
+			entry.kind = directoryEntryTypeDir
+			entry.mode = directoryEntryMode(info)
+			entry.digest = digest.String()
+
+		case info.Mode().IsRegular():
+			digest, err := directoryFileDigest(path, fs, algo)
+			if err != nil {
+				return nil, err
+			}
+
+			entry.kind = directoryEntryTypeFile
+			entry.mode = directoryEntryMode(info)
+			entry.digest = digest.String()
+
+		default:
+			// Reading a FIFO would block and devices or sockets have no content to hash
+			return nil, bosherr.Errorf("Calculating digest of '%s': Unsupported file type '%s'", path, info.Mode().Type())
+		}
+
+		parent := filepath.Dir(path)
+		children[parent] = append(children[parent], entry)
+	}
+
+	return nil, bosherr.Errorf("Expected '%s' to be a directory", dir)
+}
+
+// NewMultipleDigestFromDir computes a directory digest of dir for each of the given algorithms.
+func NewMultipleDigestFromDir(dir string, fs boshsys.FileSystem, algos []Algorithm) (MultipleDigest, error) {
+	if len(algos) == 0 {
+		return MultipleDigest{}, bosherr.Error("must provide at least one algorithm")
+	}
+
+	digests := []Digest{}
+	for _, algo := range algos {
+		digest, err := NewDirectoryDigest(dir, fs, algo)
+		if err != nil {
+			return MultipleDigest{}, err
+		}
+		digests = append(digests, digest)
+	}
+
+	return MultipleDigest{digests}, nil
+}
+
+// VerifyDirectory checks that the directory digest of dir matches the expected digest.
+// When given a MultipleDigest only its strongest digest is checked.
+func VerifyDirectory(expected Digest, dir string, fs boshsys.FileSystem) error {
+	if multipleDigest, ok := expected.(MultipleDigest); ok {
+		err := multipleDigest.validate()
+		if err != nil {
+			return err
+		}
+		expected = multipleDigest.strongestDigest()
+	}
+
+	actual, err := NewDirectoryDigest(dir, fs, expected.Algorithm())
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Computing digest of directory '%s'", dir)
+	}
+
+	if expected.String() != actual.String() {
+		return bosherr.Errorf("Expected directory '%s' to have digest '%s' but was '%s'", dir, expected.String(), actual.String())
+	}
+
+	return nil
+}
+
+func directoryEntriesDigest(entries []directoryEntry, algo Algorithm) (Digest, error) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		fmt.Fprintf(&buf, "%s %04o %s %s\x00", entry.kind, uint32(entry.mode), entry.digest, entry.name)
+	}
+
+	return algo.CreateDigest(&buf)
+}
+
+func directoryFileDigest(path string, fs boshsys.FileSystem, algo Algorithm) (Digest, error) {
+	file, err := fs.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "calculating digest of '%s'", path)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return algo.CreateDigest(file)
+}
+
+func directoryEntryMode(info os.FileInfo) os.FileMode {
+	return info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
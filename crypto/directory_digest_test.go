@@ -0,0 +1,174 @@
+package crypto_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/bosh-utils/crypto"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+var _ = Describe("DirectoryDigest", func() {
+	var (
+		fs  boshsys.FileSystem
+		dir string
+	)
+
+	writeTree := func(root string) {
+		Expect(os.MkdirAll(filepath.Join(root, "sub", "nested"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(root, "empty"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, "sub", "b.txt"), []byte("b"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, "sub", "nested", "c.txt"), []byte("c"), 0600)).To(Succeed())
+		Expect(os.Symlink("sub/b.txt", filepath.Join(root, "link"))).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		fs = boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+		dir = GinkgoT().TempDir()
+		writeTree(dir)
+	})
+
+	Describe("NewDirectoryDigest", func() {
+		It("returns the same digest for identical trees", func() {
+			otherDir := GinkgoT().TempDir()
+			writeTree(otherDir)
+
+			digest, err := NewDirectoryDigest(dir, fs, DigestAlgorithmSHA256)
+			Expect(err).ToNot(HaveOccurred())
+
+			otherDigest, err := NewDirectoryDigest(otherDir, fs, DigestAlgorithmSHA256)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(digest.String()).To(HavePrefix("sha256:"))
+			Expect(digest.String()).To(Equal(otherDigest.String()))
+			Expect(digest.Algorithm()).To(Equal(DigestAlgorithmSHA256))
+		})
+
+		It("ignores a trailing slash on the directory", func() {
+			digest, err := NewDirectoryDigest(dir, fs, DigestAlgorithmSHA1)
+			Expect(err).ToNot(HaveOccurred())
+
+			otherDigest, err := NewDirectoryDigest(dir+"/", fs, DigestAlgorithmSHA1)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(digest.String()).To(Equal(otherDigest.String()))
+		})
+
+		DescribeTable("changes when the tree changes",
+			func(change func()) {
+				before, err := NewDirectoryDigest(dir, fs, DigestAlgorithmSHA256)
+				Expect(err).ToNot(HaveOccurred())
+
+				change()
+
+				after, err := NewDirectoryDigest(dir, fs, DigestAlgorithmSHA256)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(after.String()).ToNot(Equal(before.String()))
+			},
+			Entry("content of a nested file", func() {
+				Expect(os.WriteFile(filepath.Join(dir, "sub", "nested", "c.txt"), []byte("changed"), 0600)).To(Succeed())
+			}),
+			Entry("mode of a file", func() {
+				Expect(os.Chmod(filepath.Join(dir, "a.txt"), 0755)).To(Succeed())
+			}),
+			Entry("mode of a directory", func() {
+				Expect(os.Chmod(filepath.Join(dir, "sub"), 0700)).To(Succeed())
+			}),
+			Entry("name of a file", func() {
+				Expect(os.Rename(filepath.Join(dir, "a.txt"), filepath.Join(dir, "z.txt"))).To(Succeed())
+			}),
+			Entry("an added empty directory", func() {
+				Expect(os.Mkdir(filepath.Join(dir, "sub", "new-empty"), 0755)).To(Succeed())
+			}),
+			Entry("a removed empty directory", func() {
+				Expect(os.Remove(filepath.Join(dir, "empty"))).To(Succeed())
+			}),
+			Entry("the target of a symlink", func() {
+				Expect(os.Remove(filepath.Join(dir, "link"))).To(Succeed())
+				Expect(os.Symlink("a.txt", filepath.Join(dir, "link"))).To(Succeed())
+			}),
+			Entry("a file moved into another directory", func() {
+				Expect(os.Rename(filepath.Join(dir, "sub", "b.txt"), filepath.Join(dir, "sub", "nested", "b.txt"))).To(Succeed())
+			}),
+		)
+
+		It("does not follow symlinks", func() {
+			before, err := NewDirectoryDigest(dir, fs, DigestAlgorithmSHA256)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(os.Remove(filepath.Join(dir, "link"))).To(Succeed())
+			Expect(os.Symlink("does-not-exist", filepath.Join(dir, "link"))).To(Succeed())
+
+			after, err := NewDirectoryDigest(dir, fs, DigestAlgorithmSHA256)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(after.String()).ToNot(Equal(before.String()))
+		})
+
+		It("returns an error if the path is not a directory", func() {
+			_, err := NewDirectoryDigest(filepath.Join(dir, "a.txt"), fs, DigestAlgorithmSHA256)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("to be a directory"))
+		})
+
+		It("returns an error if the directory does not exist", func() {
+			_, err := NewDirectoryDigest(filepath.Join(dir, "missing"), fs, DigestAlgorithmSHA256)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Walking directory"))
+		})
+
+		It("returns an error for unknown algorithms", func() {
+			_, err := NewDirectoryDigest(dir, fs, NewUnknownAlgorithm("unknown"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Unable to create digest of unknown algorithm 'unknown'"))
+		})
+	})
+
+	Describe("NewMultipleDigestFromDir", func() {
+		It("computes a digest for every algorithm", func() {
+			digest, err := NewMultipleDigestFromDir(dir, fs, []Algorithm{DigestAlgorithmSHA1, DigestAlgorithmSHA512})
+			Expect(err).ToNot(HaveOccurred())
+
+			sha1Digest, err := NewDirectoryDigest(dir, fs, DigestAlgorithmSHA1)
+			Expect(err).ToNot(HaveOccurred())
+			sha512Digest, err := NewDirectoryDigest(dir, fs, DigestAlgorithmSHA512)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(digest.String()).To(Equal(sha1Digest.String() + ";" + sha512Digest.String()))
+		})
+
+		It("requires at least one algorithm", func() {
+			_, err := NewMultipleDigestFromDir(dir, fs, []Algorithm{})
+			Expect(err).To(MatchError("must provide at least one algorithm"))
+		})
+	})
+
+	Describe("VerifyDirectory", func() {
+		It("succeeds when the digest matches", func() {
+			digest, err := NewMultipleDigestFromDir(dir, fs, []Algorithm{DigestAlgorithmSHA256})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(VerifyDirectory(digest, dir, fs)).To(Succeed())
+		})
+
+		It("uses the strongest digest of a multiple digest", func() {
+			sha512Digest, err := NewDirectoryDigest(dir, fs, DigestAlgorithmSHA512)
+			Expect(err).ToNot(HaveOccurred())
+
+			digest := MustNewMultipleDigest(NewDigest(DigestAlgorithmSHA1, "bogus"), sha512Digest)
+			Expect(VerifyDirectory(digest, dir, fs)).To(Succeed())
+		})
+
+		It("returns an error when the digest does not match", func() {
+			digest := NewDigest(DigestAlgorithmSHA1, "bogus")
+
+			err := VerifyDirectory(digest, dir, fs)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("Expected directory '" + dir + "' to have digest 'bogus' but was '"))
+		})
+	})
+})
@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package crypto_test
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/bosh-utils/crypto"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+var _ = Describe("DirectoryDigest with special files", func() {
+	It("returns an error instead of reading a FIFO", func() {
+		fs := boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+		dir := GinkgoT().TempDir()
+
+		Expect(os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)).To(Succeed())
+		Expect(syscall.Mkfifo(filepath.Join(dir, "fifo"), 0644)).To(Succeed())
+
+		_, err := NewDirectoryDigest(dir, fs, DigestAlgorithmSHA256)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Calculating digest of '" + filepath.Join(dir, "fifo") + "': Unsupported file type"))
+	})
+})
@@ -1,15 +1,74 @@
 package crypto
 
 import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
+	"net"
 	"strings"
+	"time"
 
 	bosherr "github.com/cloudfoundry/bosh-utils/errors"
 )
 
+// CertificateInfo is a summary of the commonly inspected fields of a certificate.
+type CertificateInfo struct {
+	Certificate *x509.Certificate
+
+	Subject      string
+	Issuer       string
+	SerialNumber string
+	NotBefore    time.Time
+	NotAfter     time.Time
+	DNSNames     []string
+	IPAddresses  []net.IP
+	IsCA         bool
+
+	// SHA256Fingerprint is the hex encoded SHA-256 of the DER encoded certificate
+	SHA256Fingerprint string
+}
+
 func CertPoolFromPEM(pemCerts []byte) (*x509.CertPool, error) {
+	certs, err := CertificatesFromPEM(pemCerts)
+	if err != nil {
+		return nil, err
+	}
+
 	certPool := x509.NewCertPool()
+	for _, cert := range certs {
+		certPool.AddCert(cert)
+	}
+
+	return certPool, nil
+}
+
+// SystemCertPoolWithPEM returns the system cert pool extended with the certificates in pemCerts.
+func SystemCertPoolWithPEM(pemCerts []byte) (*x509.CertPool, error) {
+	certs, err := CertificatesFromPEM(pemCerts)
+	if err != nil {
+		return nil, err
+	}
+
+	certPool, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Loading system cert pool")
+	}
+
+	for _, cert := range certs {
+		certPool.AddCert(cert)
+	}
+
+	return certPool, nil
+}
+
+// CertificatesFromPEM parses every certificate in a PEM bundle in the order they appear.
+func CertificatesFromPEM(pemCerts []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
 
 	for pemCertsIdx := 1; len(pemCerts) > 0; pemCertsIdx++ {
 		var block *pem.Block
@@ -32,8 +91,167 @@ func CertPoolFromPEM(pemCerts []byte) (*x509.CertPool, error) {
 			return nil, bosherr.WrapErrorf(err, "Parsing certificate %d", pemCertsIdx)
 		}
 
-		certPool.AddCert(cert)
+		certs = append(certs, cert)
 	}
 
-	return certPool, nil
+	return certs, nil
+}
+
+// CertificateInfosFromPEM parses every certificate in a PEM bundle and summarizes it.
+func CertificateInfosFromPEM(pemCerts []byte) ([]CertificateInfo, error) {
+	certs, err := CertificatesFromPEM(pemCerts)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]CertificateInfo, 0, len(certs))
+	for _, cert := range certs {
+		infos = append(infos, NewCertificateInfo(cert))
+	}
+
+	return infos, nil
+}
+
+func NewCertificateInfo(cert *x509.Certificate) CertificateInfo {
+	return CertificateInfo{
+		Certificate: cert,
+
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SerialNumber: cert.SerialNumber.String(),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		DNSNames:     cert.DNSNames,
+		IPAddresses:  cert.IPAddresses,
+		IsCA:         cert.IsCA,
+
+		SHA256Fingerprint: fmt.Sprintf("%x", sha256.Sum256(cert.Raw)),
+	}
+}
+
+// VerifyCertificateChain checks that certs[0] chains up to one of roots,
+// using the remaining certs as intermediates. A zero currentTime means now.
+func VerifyCertificateChain(certs []*x509.Certificate, roots *x509.CertPool, currentTime time.Time) error {
+	if len(certs) == 0 {
+		return bosherr.Error("Verifying certificate chain: No certificates given")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   currentTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Verifying certificate chain for '%s'", certs[0].Subject.String())
+	}
+
+	return nil
+}
+
+// VerifyCertificateChainPEM is VerifyCertificateChain for PEM encoded bundles.
+// The first certificate in chainPEM is the one being verified.
+func VerifyCertificateChainPEM(chainPEM, rootsPEM []byte, currentTime time.Time) error {
+	certs, err := CertificatesFromPEM(chainPEM)
+	if err != nil {
+		return bosherr.WrapError(err, "Parsing certificate chain")
+	}
+
+	roots, err := CertPoolFromPEM(rootsPEM)
+	if err != nil {
+		return bosherr.WrapError(err, "Parsing root certificates")
+	}
+
+	return VerifyCertificateChain(certs, roots, currentTime)
+}
+
+// ExpiresWithin returns true if cert is no longer valid at now + window.
+func ExpiresWithin(cert *x509.Certificate, window time.Duration, now time.Time) bool {
+	return !now.Add(window).Before(cert.NotAfter)
+}
+
+// CertificatesExpiringWithin returns the certificates that are no longer valid at now + window.
+func CertificatesExpiringWithin(certs []*x509.Certificate, window time.Duration, now time.Time) []*x509.Certificate {
+	var expiring []*x509.Certificate
+	for _, cert := range certs {
+		if ExpiresWithin(cert, window, now) {
+			expiring = append(expiring, cert)
+		}
+	}
+	return expiring
+}
+
+// PrivateKeyFromPEM parses the first PEM block as a PKCS#1, PKCS#8 or SEC 1 private key.
+func PrivateKeyFromPEM(pemKey []byte) (gocrypto.Signer, error) {
+	block, rest := pem.Decode(pemKey)
+	if block == nil {
+		return nil, bosherr.Error("Parsing private key: Missing PEM block")
+	}
+
+	if strings.TrimSpace(string(rest)) != "" {
+		return nil, bosherr.Error("Parsing private key: Expected a single PEM block")
+	}
+
+	var key interface{}
+	var err error
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, bosherr.Errorf("Parsing private key: Unsupported PEM block type '%s'", block.Type)
+	}
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Parsing private key")
+	}
+
+	signer, ok := key.(gocrypto.Signer)
+	if !ok {
+		return nil, bosherr.Errorf("Parsing private key: Unsupported key type %T", key)
+	}
+
+	return signer, nil
+}
+
+// PrivateKeyMatchesCertificate returns true if key is the private half of cert's public key.
+func PrivateKeyMatchesCertificate(key gocrypto.Signer, cert *x509.Certificate) bool {
+	type equaler interface {
+		Equal(gocrypto.PublicKey) bool
+	}
+
+	switch key.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return key.Public().(equaler).Equal(cert.PublicKey)
+	default:
+		return false
+	}
+}
+
+// PrivateKeyMatchesCertificatePEM is PrivateKeyMatchesCertificate for PEM encoded
+// key and certificate. Only the first certificate of certPEM is considered.
+func PrivateKeyMatchesCertificatePEM(keyPEM, certPEM []byte) (bool, error) {
+	key, err := PrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return false, err
+	}
+
+	certs, err := CertificatesFromPEM(certPEM)
+	if err != nil {
+		return false, err
+	}
+
+	if len(certs) == 0 {
+		return false, bosherr.Error("Parsing certificate 1: Missing PEM block")
+	}
+
+	return PrivateKeyMatchesCertificate(key, certs[0]), nil
 }
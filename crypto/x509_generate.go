@@ -0,0 +1,166 @@
+package crypto
+
+import (
+	gocrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+const defaultCertificateDuration = 24 * time.Hour
+
+// CertificateOptions configures GenerateCA and GenerateCertificate.
+// Generated certificates are meant for tests and short-lived use.
+type CertificateOptions struct {
+	CommonName   string
+	Organization string
+
+	DNSNames    []string
+	IPAddresses []net.IP
+
+	// NotBefore defaults to one minute ago to tolerate small clock skew
+	NotBefore time.Time
+	// Duration defaults to 24 hours
+	Duration time.Duration
+
+	// RSAKeySize generates an RSA key of the given size instead of an ECDSA P-256 key
+	RSAKeySize int
+
+	// ClientAuth adds the client authentication extended key usage to leaf certificates
+	ClientAuth bool
+}
+
+// CertificateKeyPair is a certificate along with its private key.
+type CertificateKeyPair struct {
+	Certificate *x509.Certificate
+	PrivateKey  gocrypto.Signer
+}
+
+// GenerateCA creates a self-signed CA certificate.
+func GenerateCA(opts CertificateOptions) (CertificateKeyPair, error) {
+	template, err := certificateTemplate(opts)
+	if err != nil {
+		return CertificateKeyPair{}, err
+	}
+
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	key, err := generatePrivateKey(opts)
+	if err != nil {
+		return CertificateKeyPair{}, err
+	}
+
+	return createCertificate(template, template, key, key)
+}
+
+// GenerateCertificate creates a leaf certificate signed by ca.
+func GenerateCertificate(ca CertificateKeyPair, opts CertificateOptions) (CertificateKeyPair, error) {
+	if ca.Certificate == nil || ca.PrivateKey == nil {
+		return CertificateKeyPair{}, bosherr.Error("Generating certificate: CA certificate and private key are required")
+	}
+
+	template, err := certificateTemplate(opts)
+	if err != nil {
+		return CertificateKeyPair{}, err
+	}
+
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	if opts.ClientAuth {
+		template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+	}
+
+	key, err := generatePrivateKey(opts)
+	if err != nil {
+		return CertificateKeyPair{}, err
+	}
+
+	return createCertificate(template, ca.Certificate, key, ca.PrivateKey)
+}
+
+func (p CertificateKeyPair) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.Certificate.Raw})
+}
+
+// PrivateKeyPEM encodes the private key as PKCS#8.
+func (p CertificateKeyPair) PrivateKeyPEM() ([]byte, error) {
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(p.PrivateKey)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Marshalling private key")
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}), nil
+}
+
+func certificateTemplate(opts CertificateOptions) (*x509.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Generating serial number")
+	}
+
+	notBefore := opts.NotBefore
+	if notBefore.IsZero() {
+		notBefore = time.Now().Add(-time.Minute)
+	}
+
+	duration := opts.Duration
+	if duration == 0 {
+		duration = defaultCertificateDuration
+	}
+
+	subject := pkix.Name{CommonName: opts.CommonName}
+	if opts.Organization != "" {
+		subject.Organization = []string{opts.Organization}
+	}
+
+	return &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      subject,
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(duration),
+		DNSNames:     opts.DNSNames,
+		IPAddresses:  opts.IPAddresses,
+	}, nil
+}
+
+func generatePrivateKey(opts CertificateOptions) (gocrypto.Signer, error) {
+	if opts.RSAKeySize > 0 {
+		key, err := rsa.GenerateKey(rand.Reader, opts.RSAKeySize)
+		if err != nil {
+			return nil, bosherr.WrapError(err, "Generating RSA private key")
+		}
+		return key, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Generating ECDSA private key")
+	}
+	return key, nil
+}
+
+func createCertificate(template, parent *x509.Certificate, key, parentKey gocrypto.Signer) (CertificateKeyPair, error) {
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return CertificateKeyPair{}, bosherr.WrapError(err, "Creating certificate")
+	}
+
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return CertificateKeyPair{}, bosherr.WrapError(err, "Parsing created certificate")
+	}
+
+	return CertificateKeyPair{Certificate: cert, PrivateKey: key}, nil
+}
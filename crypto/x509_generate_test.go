@@ -0,0 +1,77 @@
+package crypto_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-utils/crypto"
+)
+
+var _ = Describe("X509 generation", func() {
+	Describe("GenerateCA", func() {
+		It("creates a short-lived self-signed ECDSA CA by default", func() {
+			ca, err := crypto.GenerateCA(crypto.CertificateOptions{CommonName: "test-ca"})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(ca.Certificate.IsCA).To(BeTrue())
+			Expect(ca.Certificate.Subject.CommonName).To(Equal("test-ca"))
+			Expect(ca.Certificate.NotAfter.Sub(ca.Certificate.NotBefore)).To(Equal(24 * time.Hour))
+			Expect(ca.Certificate.CheckSignatureFrom(ca.Certificate)).To(Succeed())
+			Expect(ca.PrivateKey).To(BeAssignableToTypeOf(&ecdsa.PrivateKey{}))
+		})
+
+		It("honours NotBefore, Duration and RSAKeySize", func() {
+			notBefore := time.Now().Add(-time.Hour).Truncate(time.Second).UTC()
+
+			ca, err := crypto.GenerateCA(crypto.CertificateOptions{NotBefore: notBefore, Duration: time.Hour, RSAKeySize: 2048})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(ca.Certificate.NotBefore).To(Equal(notBefore))
+			Expect(ca.Certificate.NotAfter).To(Equal(notBefore.Add(time.Hour)))
+			Expect(ca.PrivateKey).To(BeAssignableToTypeOf(&rsa.PrivateKey{}))
+		})
+	})
+
+	Describe("GenerateCertificate", func() {
+		It("creates a leaf certificate signed by the CA usable for TLS", func() {
+			ca, err := crypto.GenerateCA(crypto.CertificateOptions{CommonName: "test-ca"})
+			Expect(err).ToNot(HaveOccurred())
+
+			leaf, err := crypto.GenerateCertificate(ca, crypto.CertificateOptions{
+				CommonName:  "leaf",
+				DNSNames:    []string{"leaf.internal"},
+				IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+				ClientAuth:  true,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(leaf.Certificate.IsCA).To(BeFalse())
+			Expect(leaf.Certificate.Issuer.CommonName).To(Equal("test-ca"))
+			Expect(leaf.Certificate.ExtKeyUsage).To(ConsistOf(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth))
+
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.Certificate)
+			_, err = leaf.Certificate.Verify(x509.VerifyOptions{Roots: roots, DNSName: "leaf.internal"})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = leaf.Certificate.Verify(x509.VerifyOptions{Roots: roots, DNSName: "127.0.0.1"})
+			Expect(err).ToNot(HaveOccurred())
+
+			keyPEM, err := leaf.PrivateKeyPEM()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = tls.X509KeyPair(leaf.CertificatePEM(), keyPEM)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("requires a CA key pair", func() {
+			_, err := crypto.GenerateCertificate(crypto.CertificateKeyPair{}, crypto.CertificateOptions{})
+			Expect(err).To(MatchError("Generating certificate: CA certificate and private key are required"))
+		})
+	})
+})
@@ -27,6 +27,11 @@ func (e ComplexError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Err.Error(), e.Cause.Error())
 }
 
+// Unwrap allows errors.Is and errors.As to match both the error and its cause
+func (e ComplexError) Unwrap() []error {
+	return []error{e.Err, e.Cause}
+}
+
 func (e ComplexError) ShortError() string {
 	var errorMessage string
 	if shortenableError, ok := e.Err.(ShortenableError); ok {
@@ -1,6 +1,8 @@
 package errors_test
 
 import (
+	"errors"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
@@ -90,6 +92,18 @@ var _ = Describe("WrapComplexError", func() {
 			"fake-delegate-delegate: fake-delegate-cause: fake-cause-delegate: fake-cause-cause"))
 	})
 
+	It("unwraps to the error and its cause", func() {
+		cause := testShortError{fullMsg: "fake-cause"}
+		delegate := Error("fake-message")
+
+		err := WrapComplexError(cause, delegate)
+		Expect(errors.Is(err, delegate)).To(BeTrue())
+
+		var causeErr testShortError
+		Expect(errors.As(WrapError(err, "fake-wrapper"), &causeErr)).To(BeTrue())
+		Expect(causeErr.fullMsg).To(Equal("fake-cause"))
+	})
+
 	It("shortens errors that are shortenable", func() {
 		cause := &testShortError{fullMsg: "cause-full", shortMsg: "cause-short1"}
 		delegate := &testShortError{fullMsg: "delegate-full", shortMsg: "delegate-short1"}
@@ -0,0 +1,190 @@
+package fileutil
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+type ArchiveEntryType string
+
+const (
+	ArchiveEntryTypeFile     ArchiveEntryType = "file"
+	ArchiveEntryTypeDir      ArchiveEntryType = "dir"
+	ArchiveEntryTypeSymlink  ArchiveEntryType = "symlink"
+	ArchiveEntryTypeHardLink ArchiveEntryType = "hardlink"
+	ArchiveEntryTypeOther    ArchiveEntryType = "other"
+)
+
+type ArchiveEntry struct {
+	// Name is the entry's path as stored in the archive, e.g. "./jobs/"
+	Name string
+	Type ArchiveEntryType
+	Size int64
+	Mode os.FileMode
+
+	ModTime time.Time
+
+	// LinkName is the target of symlinks and hard links
+	LinkName string
+}
+
+func newArchiveEntry(header *tar.Header) ArchiveEntry {
+	entryType := ArchiveEntryTypeOther
+
+	switch header.Typeflag {
+	case tar.TypeReg:
+		entryType = ArchiveEntryTypeFile
+	case tar.TypeDir:
+		entryType = ArchiveEntryTypeDir
+	case tar.TypeSymlink:
+		entryType = ArchiveEntryTypeSymlink
+	case tar.TypeLink:
+		entryType = ArchiveEntryTypeHardLink
+	}
+
+	return ArchiveEntry{
+		Name:     header.Name,
+		Type:     entryType,
+		Size:     header.Size,
+		Mode:     header.FileInfo().Mode().Perm(),
+		ModTime:  header.ModTime,
+		LinkName: header.Linkname,
+	}
+}
+
+func listArchiveEntries(fs boshsys.FileSystem, tarballPath string) ([]ArchiveEntry, error) {
+	var entries []ArchiveEntry
+
+	err := walkArchive(fs, tarballPath, func(header *tar.Header) {
+		entries = append(entries, newArchiveEntry(header))
+	})
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Listing entries of '%s'", tarballPath)
+	}
+
+	return entries, nil
+}
+
+// openArchiveEntry returns a reader of the content of the regular file or
+// hard link called name, which is matched regardless of a leading "./"
+func openArchiveEntry(fs boshsys.FileSystem, tarballPath, name string) (io.ReadCloser, error) {
+	wanted := cleanArchivePath(name)
+
+	// Following hard links requires reading the tarball again, since the
+	// entry they point to comes before them
+	for followed := 0; followed <= 1; followed++ {
+		tarReader, closeTarball, err := openTarball(fs, tarballPath)
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Reading '%s' from '%s'", name, tarballPath)
+		}
+
+		header, err := findArchiveEntry(tarReader, wanted)
+		if err != nil {
+			closeTarball()
+			return nil, bosherr.WrapErrorf(err, "Reading '%s' from '%s'", name, tarballPath)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeReg:
+			return archiveEntryReader{Reader: tarReader, closeFunc: closeTarball}, nil
+		case tar.TypeLink:
+			closeTarball()
+			wanted = cleanArchivePath(header.Linkname)
+		default:
+			closeTarball()
+			return nil, bosherr.Errorf("Reading '%s' from '%s': Not a regular file", name, tarballPath)
+		}
+	}
+
+	return nil, bosherr.Errorf("Reading '%s' from '%s': Too many hard links", name, tarballPath)
+}
+
+func readArchiveEntry(fs boshsys.FileSystem, tarballPath, name string) ([]byte, error) {
+	r, err := openArchiveEntry(fs, tarballPath, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() //nolint:errcheck
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Reading '%s' from '%s'", name, tarballPath)
+	}
+
+	return content, nil
+}
+
+func findArchiveEntry(tarReader *tar.Reader, name string) (*tar.Header, error) {
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, bosherr.Error("Not found")
+		}
+		if err != nil {
+			return nil, bosherr.WrapError(err, "Reading tarball")
+		}
+
+		if cleanArchivePath(header.Name) == name {
+			return header, nil
+		}
+	}
+}
+
+func walkArchive(fs boshsys.FileSystem, tarballPath string, walkFunc func(*tar.Header)) error {
+	tarReader, closeTarball, err := openTarball(fs, tarballPath)
+	if err != nil {
+		return err
+	}
+	defer closeTarball()
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return bosherr.WrapError(err, "Reading tarball")
+		}
+
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		walkFunc(header)
+	}
+}
+
+func openTarball(fs boshsys.FileSystem, tarballPath string) (*tar.Reader, func(), error) {
+	tarball, err := fs.OpenFile(tarballPath, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, nil, bosherr.WrapError(err, "Opening tarball")
+	}
+
+	r, err := decompressingReader(tarball)
+	if err != nil {
+		tarball.Close() //nolint:errcheck
+		return nil, nil, err
+	}
+
+	closeTarball := func() {
+		r.Close()       //nolint:errcheck
+		tarball.Close() //nolint:errcheck
+	}
+
+	return tar.NewReader(r), closeTarball, nil
+}
+
+type archiveEntryReader struct {
+	io.Reader
+	closeFunc func()
+}
+
+func (r archiveEntryReader) Close() error {
+	r.closeFunc()
+	return nil
+}
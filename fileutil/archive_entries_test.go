@@ -0,0 +1,106 @@
+package fileutil_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/bosh-utils/fileutil"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+var _ = Describe("archive entries", func() {
+	var (
+		fs            boshsys.FileSystem
+		compressor    Compressor
+		withLinksPath string
+	)
+
+	BeforeEach(func() {
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		fs = boshsys.NewOsFileSystem(logger)
+		compressor = NewTarballCompressor(boshsys.NewExecCmdRunner(logger), fs)
+		withLinksPath = filepath.Join(testAssetsDir, "compressor-decompress-with-links.tgz")
+	})
+
+	Describe("ListEntries", func() {
+		It("lists every entry with its metadata in archive order", func() {
+			entries, err := compressor.ListEntries(withLinksPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(entries).To(HaveLen(14))
+			Expect(entries[0].Name).To(Equal("./"))
+			Expect(entries[0].Type).To(Equal(ArchiveEntryTypeDir))
+			Expect(entries[0].Mode).To(Equal(os.FileMode(0755)))
+
+			Expect(entries).To(ContainElement(SatisfyAll(
+				HaveField("Name", "./other_logs/other_app.stdout.log"),
+				HaveField("Type", ArchiveEntryTypeFile),
+				HaveField("Size", int64(25)),
+				HaveField("Mode", os.FileMode(0644)),
+			)))
+			Expect(entries).To(ContainElement(SatisfyAll(
+				HaveField("Name", "./latest.log"),
+				HaveField("Type", ArchiveEntryTypeHardLink),
+				HaveField("LinkName", "./app.stdout.log"),
+			)))
+			Expect(entries).To(ContainElement(SatisfyAll(
+				HaveField("Name", "./symlink_dir"),
+				HaveField("Type", ArchiveEntryTypeSymlink),
+				HaveField("LinkName", "../symlink_target"),
+			)))
+		})
+
+		It("returns an error if the file is not a tarball", func() {
+			_, err := compressor.ListEntries(filepath.Join(testAssetsFixtureDir, "app.stdout.log"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Listing entries of"))
+		})
+	})
+
+	Describe("ReadEntry", func() {
+		for _, format := range []CompressionFormat{CompressionFormatGzip, CompressionFormatBzip2, CompressionFormatXz, CompressionFormatZstd, CompressionFormatNone} {
+			It("reads a single file from a "+string(format)+" tarball", func() {
+				tarballPath, err := NewNativeTarballCompressor(fs, boshlog.NewLogger(boshlog.LevelNone)).CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{CompressionFormat: format})
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(tarballPath) //nolint:errcheck
+
+				content, err := compressor.ReadEntry(tarballPath, "other_logs/other_app.stderr.log")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(content)).To(ContainSubstring("this is other app stderr"))
+			})
+		}
+
+		It("reads the content of hard links", func() {
+			content, err := compressor.ReadEntry(withLinksPath, "./latest.log")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(ContainSubstring("this is app stdout"))
+		})
+
+		It("returns an error for entries that are not files", func() {
+			_, err := compressor.ReadEntry(withLinksPath, "some_directory")
+			Expect(err).To(MatchError(ContainSubstring("Reading 'some_directory' from '" + withLinksPath + "': Not a regular file")))
+		})
+
+		It("returns an error for missing entries", func() {
+			_, err := compressor.ReadEntry(withLinksPath, "release.MF")
+			Expect(err).To(MatchError(ContainSubstring("Reading 'release.MF' from '" + withLinksPath + "': Not found")))
+		})
+	})
+
+	Describe("OpenEntry", func() {
+		It("streams a single file", func() {
+			r, err := compressor.OpenEntry(withLinksPath, "some_directory/sub_dir/other_sub_dir/.keep")
+			Expect(err).ToNot(HaveOccurred())
+			defer r.Close() //nolint:errcheck
+
+			content, err := io.ReadAll(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(ContainSubstring("this is a .keep file"))
+		})
+	})
+})
@@ -0,0 +1,132 @@
+package fileutil
+
+import (
+	"archive/tar"
+	"path"
+	"path/filepath"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+// archiveEntryValidator rejects archive entries that would escape the
+// extraction directory and enforces the extraction limits of CompressorOptions.
+// Entries must be passed to validate in archive order.
+type archiveEntryValidator struct {
+	options CompressorOptions
+
+	entries   int
+	totalSize int64
+
+	// escapingSymlinks are symlinks from the archive that point outside of it
+	escapingSymlinks map[string]struct{}
+}
+
+func newArchiveEntryValidator(options CompressorOptions) *archiveEntryValidator {
+	return &archiveEntryValidator{
+		options:          options,
+		escapingSymlinks: map[string]struct{}{},
+	}
+}
+
+func (v *archiveEntryValidator) validate(header *tar.Header) error {
+	err := v.validateEntry(header)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Validating '%s'", header.Name)
+	}
+
+	return nil
+}
+
+func (v *archiveEntryValidator) validateEntry(header *tar.Header) error {
+	v.entries++
+	if v.options.MaxEntries > 0 && v.entries > v.options.MaxEntries {
+		return bosherr.Errorf("Archive has more than %d entries", v.options.MaxEntries)
+	}
+
+	if v.options.MaxFileSize > 0 && header.Size > v.options.MaxFileSize {
+		return bosherr.Errorf("Size %d exceeds maximum file size of %d", header.Size, v.options.MaxFileSize)
+	}
+
+	v.totalSize += header.Size
+	if v.options.MaxTotalSize > 0 && v.totalSize > v.options.MaxTotalSize {
+		return bosherr.Errorf("Archive exceeds maximum total size of %d", v.options.MaxTotalSize)
+	}
+
+	name, err := safeArchivePath(header.Name)
+	if err != nil {
+		return err
+	}
+
+	for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+		if _, found := v.escapingSymlinks[parent]; found {
+			return bosherr.Errorf("Path traverses symlink '%s' pointing outside of the archive", parent)
+		}
+	}
+
+	switch header.Typeflag {
+	case tar.TypeLink:
+		_, err = safeArchivePath(header.Linkname)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Hard link target '%s'", header.Linkname)
+		}
+	case tar.TypeSymlink:
+		if symlinkEscapes(name, header.Linkname) {
+			v.escapingSymlinks[name] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+// safeArchivePath returns the cleaned name, or an error if it is absolute
+// or refers to a parent of the extraction directory
+func safeArchivePath(name string) (string, error) {
+	if path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", bosherr.Error("Absolute paths are not allowed")
+	}
+
+	cleaned := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", bosherr.Error("Path escapes the destination directory")
+	}
+
+	return cleaned, nil
+}
+
+func symlinkEscapes(name, target string) bool {
+	if path.IsAbs(target) || filepath.IsAbs(target) {
+		return true
+	}
+
+	resolved := path.Join(path.Dir(name), target)
+	return resolved == ".." || strings.HasPrefix(resolved, "../")
+}
+
+// checkWithinDir returns an error if target, or the closest of its existing
+// ancestors, resolves to a location outside of dir, e.g. through a symlink
+// that was already present in dir or that was created by an earlier entry
+func checkWithinDir(dir, target string) error {
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Resolving destination directory '%s'", dir)
+	}
+
+	existing := target
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			rel, err := filepath.Rel(resolvedDir, resolved)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return bosherr.Errorf("Path resolves to '%s' outside of the destination directory", resolved)
+			}
+			return nil
+		}
+
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return nil
+		}
+		existing = parent
+	}
+}
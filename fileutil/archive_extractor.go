@@ -0,0 +1,280 @@
+package fileutil
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// archiveEntryIterator yields the entries of an archive as tar headers along
+// with a reader of their content, so that every archive format is extracted
+// with the same safety checks
+type archiveEntryIterator interface {
+	// Next returns io.EOF after the last entry
+	Next() (*tar.Header, io.Reader, error)
+}
+
+type tarEntryIterator struct {
+	reader *tar.Reader
+}
+
+func (i tarEntryIterator) Next() (*tar.Header, io.Reader, error) {
+	header, err := i.reader.Next()
+	if err == io.EOF {
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, bosherr.WrapError(err, "Reading tarball")
+	}
+
+	return header, i.reader, nil
+}
+
+type archiveExtractor struct {
+	fs boshsys.FileSystem
+}
+
+type extractedDir struct {
+	path   string
+	header *tar.Header
+}
+
+func (e archiveExtractor) extract(entries archiveEntryIterator, dir string, options CompressorOptions) error {
+	var dirs []extractedDir
+	foundPathInArchive := false
+	validator := newArchiveEntryValidator(options)
+
+	for {
+		header, content, err := entries.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		err = validator.validate(header)
+		if err != nil {
+			return err
+		}
+
+		if !inArchivePath(header.Name, options.PathInArchive) {
+			continue
+		}
+		foundPathInArchive = true
+
+		name, ok := stripComponents(header.Name, options.StripComponents)
+		if !ok {
+			continue
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = checkWithinDir(dir, target)
+			if err == nil {
+				err = e.fs.MkdirAll(target, 0755)
+				dirs = append(dirs, extractedDir{path: target, header: header})
+			}
+		case tar.TypeReg:
+			err = e.extractFile(content, dir, target, header)
+		case tar.TypeSymlink:
+			err = e.extractSymlink(dir, target, header)
+		case tar.TypeLink:
+			err = e.extractHardLink(dir, target, header, options)
+		default:
+			err = bosherr.Errorf("Unsupported entry type '%c'", header.Typeflag)
+		}
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Extracting '%s'", header.Name)
+		}
+
+		if options.SameOwner {
+			err = lchown(target, header.Uid, header.Gid)
+			if err != nil {
+				return bosherr.WrapErrorf(err, "Changing owner of '%s'", header.Name)
+			}
+		}
+
+		// Permissions are applied after changing the owner, which clears the setuid and setgid bits
+		if header.Typeflag == tar.TypeReg {
+			err = e.applyMetadata(target, header)
+			if err != nil {
+				return bosherr.WrapErrorf(err, "Extracting '%s'", header.Name)
+			}
+		}
+	}
+
+	if options.PathInArchive != "" && !foundPathInArchive {
+		return bosherr.Errorf("Finding '%s' in archive: Not found", options.PathInArchive)
+	}
+
+	// Directory permissions and times are applied last, since extracting
+	// their contents would otherwise fail or update their modification time
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err := e.applyMetadata(dirs[i].path, dirs[i].header)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Extracting '%s'", dirs[i].header.Name)
+		}
+	}
+
+	return nil
+}
+
+func (e archiveExtractor) extractFile(r io.Reader, dir, target string, header *tar.Header) error {
+	err := checkWithinDir(dir, filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+
+	err = e.fs.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return bosherr.WrapError(err, "Creating parent directory")
+	}
+
+	// Replace rather than truncate so that hard links and symlinks at target are not written through
+	err = e.removeExisting(target)
+	if err != nil {
+		return err
+	}
+
+	f, err := e.fs.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, header.FileInfo().Mode().Perm())
+	if err != nil {
+		return bosherr.WrapError(err, "Creating file")
+	}
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close() //nolint:errcheck
+		return bosherr.WrapError(err, "Writing file")
+	}
+
+	err = f.Close()
+	if err != nil {
+		return bosherr.WrapError(err, "Closing file")
+	}
+
+	return nil
+}
+
+func (e archiveExtractor) extractSymlink(dir, target string, header *tar.Header) error {
+	err := checkWithinDir(dir, filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+
+	err = e.fs.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return bosherr.WrapError(err, "Creating parent directory")
+	}
+
+	return e.fs.Symlink(header.Linkname, target)
+}
+
+func (e archiveExtractor) extractHardLink(dir, target string, header *tar.Header, options CompressorOptions) error {
+	linkName, ok := stripComponents(header.Linkname, options.StripComponents)
+	if !ok {
+		return bosherr.Errorf("Hard link target '%s' is outside of the extracted files", header.Linkname)
+	}
+
+	source := filepath.Join(dir, filepath.FromSlash(linkName))
+
+	err := checkWithinDir(dir, source)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Hard link target '%s'", header.Linkname)
+	}
+
+	err = checkWithinDir(dir, filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+
+	err = e.fs.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return bosherr.WrapError(err, "Creating parent directory")
+	}
+
+	err = e.removeExisting(target)
+	if err != nil {
+		return err
+	}
+
+	return e.fs.Link(source, target)
+}
+
+func (e archiveExtractor) removeExisting(target string) error {
+	info, err := e.fs.Lstat(target)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+
+	err = e.fs.RemoveAll(target)
+	if err != nil {
+		return bosherr.WrapError(err, "Removing existing file")
+	}
+
+	return nil
+}
+
+func (e archiveExtractor) applyMetadata(target string, header *tar.Header) error {
+	err := e.fs.Chmod(target, header.FileInfo().Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+	if err != nil {
+		return bosherr.WrapError(err, "Changing permissions")
+	}
+
+	err = e.fs.Chtimes(target, header.ModTime, header.ModTime)
+	if err != nil {
+		return bosherr.WrapError(err, "Changing modification time")
+	}
+
+	return nil
+}
+
+// inArchivePath matches name against pathInArchive the way tar does for
+// member arguments: the member itself and, for directories, everything below it
+func inArchivePath(name, pathInArchive string) bool {
+	if pathInArchive == "" {
+		return true
+	}
+
+	name = cleanArchivePath(name)
+	pathInArchive = cleanArchivePath(pathInArchive)
+
+	return pathInArchive == "." || name == pathInArchive || strings.HasPrefix(name, pathInArchive+"/")
+}
+
+// stripComponents removes count leading path elements from name, counting
+// a leading "." like GNU tar does, and returns false if nothing is left of it
+func stripComponents(name string, count int) (string, bool) {
+	if count == 0 {
+		return cleanArchivePath(name), true
+	}
+
+	var components []string
+	for _, component := range strings.Split(name, "/") {
+		if component != "" {
+			components = append(components, component)
+		}
+	}
+
+	if len(components) <= count {
+		return "", false
+	}
+
+	return cleanArchivePath(strings.Join(components[count:], "/")), true
+}
+
+func cleanArchivePath(name string) string {
+	return path.Clean(strings.TrimPrefix(name, "./"))
+}
@@ -0,0 +1,239 @@
+package fileutil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+type CompressionFormat string
+
+const (
+	CompressionFormatGzip  CompressionFormat = "gzip"
+	CompressionFormatBzip2 CompressionFormat = "bzip2"
+	CompressionFormatXz    CompressionFormat = "xz"
+	CompressionFormatZstd  CompressionFormat = "zstd"
+
+	// CompressionFormatZip is a zip archive rather than a compressed tarball
+	CompressionFormatZip CompressionFormat = "zip"
+
+	// CompressionFormatNone is an uncompressed tarball
+	CompressionFormatNone CompressionFormat = "none"
+)
+
+var (
+	gzipMagic   = []byte{0x1f, 0x8b}
+	bzip2Magic  = []byte{0x42, 0x5a, 0x68} // "BZh"
+	xzMagic     = []byte{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00}
+	zstdMagic   = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic    = []byte{0x50, 0x4b, 0x03, 0x04} // "PK\x03\x04"
+	zipEmpty    = []byte{0x50, 0x4b, 0x05, 0x06} // end of central directory of an empty zip
+	ustarMagic  = []byte("ustar")
+	ustarOffset = 257 // Offset of the TAR magic string in the file
+)
+
+// xzDictCaps are the dictionary sizes of the xz presets 0 to 9
+var xzDictCaps = []int{256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
+// compressionFormat returns the format to compress with,
+// which is gzip unless the options say otherwise
+func (o CompressorOptions) compressionFormat() CompressionFormat {
+	if o.NoCompression {
+		return CompressionFormatNone
+	}
+
+	if o.CompressionFormat == "" {
+		return CompressionFormatGzip
+	}
+
+	return o.CompressionFormat
+}
+
+func detectCompressionFormat(fs boshsys.FileSystem, path string) (CompressionFormat, error) {
+	f, err := fs.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Opening '%s'", path)
+	}
+	defer f.Close() //nolint:errcheck
+
+	// Read the first 512 bytes to check both compression headers and the TAR header.
+	// Ignore the error from reading a partial buffer, which is fine for short files.
+	buffer := make([]byte, 512)
+	n, _ := io.ReadFull(f, buffer) //nolint:errcheck
+
+	format, ok := compressionFormatFromHeader(buffer[:n])
+	if !ok {
+		return "", bosherr.Errorf("Detecting compression format of '%s': Not a tarball", path)
+	}
+
+	return format, nil
+}
+
+func compressionFormatFromHeader(header []byte) (CompressionFormat, bool) {
+	// 1. Check for compression first.
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return CompressionFormatGzip, true
+	case bytes.HasPrefix(header, bzip2Magic):
+		return CompressionFormatBzip2, true
+	case bytes.HasPrefix(header, xzMagic):
+		return CompressionFormatXz, true
+	case bytes.HasPrefix(header, zstdMagic):
+		return CompressionFormatZstd, true
+	case bytes.HasPrefix(header, zipMagic), bytes.HasPrefix(header, zipEmpty):
+		return CompressionFormatZip, true
+	}
+
+	// 2. If NOT compressed, check for the TAR magic string at its specific offset.
+	// Ensure the buffer is long enough to contain the TAR header magic string.
+	if len(header) > ustarOffset+len(ustarMagic) {
+		magicBytes := header[ustarOffset : ustarOffset+len(ustarMagic)]
+		if bytes.Equal(magicBytes, ustarMagic) {
+			return CompressionFormatNone, true
+		}
+	}
+
+	return "", false
+}
+
+func isNonCompressedTarball(fs boshsys.FileSystem, path string) bool {
+	format, err := detectCompressionFormat(fs, path)
+	return err == nil && format == CompressionFormatNone
+}
+
+// compressingWriter wraps w so that writes are compressed in the format and at
+// the level given in options. Closing the returned writer does not close w.
+func compressingWriter(w io.Writer, options CompressorOptions) (io.WriteCloser, error) {
+	format := options.compressionFormat()
+	level := options.CompressionLevel
+
+	switch format {
+	case CompressionFormatNone:
+		return nopWriteCloser{w}, nil
+
+	case CompressionFormatGzip:
+		if options.Concurrency < 0 {
+			return nil, bosherr.Errorf("Invalid concurrency %d", options.Concurrency)
+		}
+		if options.Concurrency > 1 {
+			return newParallelGzipWriter(w, level, options.BlockSize, options.Concurrency)
+		}
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		gzipWriter, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Invalid compression level %d for %s", level, format)
+		}
+		return gzipWriter, nil
+
+	case CompressionFormatBzip2:
+		if level < 0 || level > bzip2.BestCompression {
+			return nil, bosherr.Errorf("Invalid compression level %d for %s", level, format)
+		}
+		bzip2Writer, err := bzip2.NewWriter(w, &bzip2.WriterConfig{Level: level})
+		if err != nil {
+			return nil, bosherr.WrapError(err, "Creating bzip2 writer")
+		}
+		return bzip2Writer, nil
+
+	case CompressionFormatXz:
+		if level < 0 || level >= len(xzDictCaps) {
+			return nil, bosherr.Errorf("Invalid compression level %d for %s", level, format)
+		}
+		config := xz.WriterConfig{}
+		if level != 0 {
+			config.DictCap = xzDictCaps[level]
+		}
+		xzWriter, err := config.NewWriter(w)
+		if err != nil {
+			return nil, bosherr.WrapError(err, "Creating xz writer")
+		}
+		return xzWriter, nil
+
+	case CompressionFormatZstd:
+		if level < 0 || level > 22 {
+			return nil, bosherr.Errorf("Invalid compression level %d for %s", level, format)
+		}
+		encoderLevel := zstd.SpeedDefault
+		if level != 0 {
+			encoderLevel = zstd.EncoderLevelFromZstd(level)
+		}
+		zstdWriter, err := zstd.NewWriter(w, zstd.WithEncoderLevel(encoderLevel))
+		if err != nil {
+			return nil, bosherr.WrapError(err, "Creating zstd writer")
+		}
+		return zstdWriter, nil
+
+	default:
+		return nil, bosherr.Errorf("Unsupported compression format '%s'", format)
+	}
+}
+
+// decompressingReader detects the compression format of r from its first
+// bytes and returns a reader of the uncompressed tarball
+func decompressingReader(r io.Reader) (io.ReadCloser, error) {
+	bufferedReader := bufio.NewReader(r)
+
+	header, err := bufferedReader.Peek(len(xzMagic))
+	if err != nil && err != io.EOF {
+		return nil, bosherr.WrapError(err, "Reading tarball header")
+	}
+
+	format, ok := compressionFormatFromHeader(header)
+	if !ok {
+		// Too short to tell, let archive/tar decide whether it is a tarball
+		format = CompressionFormatNone
+	}
+
+	switch format {
+	case CompressionFormatGzip:
+		gzipReader, err := gzip.NewReader(bufferedReader)
+		if err != nil {
+			return nil, bosherr.WrapError(err, "Reading gzip header")
+		}
+		return gzipReader, nil
+
+	case CompressionFormatBzip2:
+		bzip2Reader, err := bzip2.NewReader(bufferedReader, nil)
+		if err != nil {
+			return nil, bosherr.WrapError(err, "Reading bzip2 header")
+		}
+		return bzip2Reader, nil
+
+	case CompressionFormatXz:
+		xzReader, err := xz.NewReader(bufferedReader)
+		if err != nil {
+			return nil, bosherr.WrapError(err, "Reading xz header")
+		}
+		return io.NopCloser(xzReader), nil
+
+	case CompressionFormatZstd:
+		zstdReader, err := zstd.NewReader(bufferedReader, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, bosherr.WrapError(err, "Reading zstd header")
+		}
+		return zstdReader.IOReadCloser(), nil
+
+	case CompressionFormatZip:
+		return nil, bosherr.Error("Reading tarball: Zip archives are not tarballs")
+
+	default:
+		return io.NopCloser(bufferedReader), nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
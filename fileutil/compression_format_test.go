@@ -0,0 +1,92 @@
+package fileutil_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/bosh-utils/fileutil"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+var _ = Describe("CompressionFormat", func() {
+	var (
+		fs         boshsys.FileSystem
+		native     Compressor
+		shellOut   Compressor
+		dstDir     string
+		formats    = []CompressionFormat{CompressionFormatGzip, CompressionFormatBzip2, CompressionFormatXz, CompressionFormatZstd, CompressionFormatNone}
+		expectTree = func(dir string) {
+			content, err := fs.ReadFileString(filepath.Join(dir, "some_directory", "sub_dir", "other_sub_dir", ".keep"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(content).To(ContainSubstring("this is a .keep file"))
+		}
+	)
+
+	BeforeEach(func() {
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		fs = boshsys.NewOsFileSystem(logger)
+		native = NewNativeTarballCompressor(fs, logger)
+		shellOut = NewTarballCompressor(boshsys.NewExecCmdRunner(logger), fs)
+		dstDir = GinkgoT().TempDir()
+	})
+
+	for _, format := range formats {
+		Context("with "+string(format), func() {
+			It("creates tarballs with the native compressor that the tar compressor extracts", func() {
+				tarballPath, err := native.CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{CompressionFormat: format})
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(tarballPath) //nolint:errcheck
+
+				Expect(shellOut.DetectCompressionFormat(tarballPath)).To(Equal(format))
+
+				Expect(shellOut.DecompressFileToDir(tarballPath, dstDir, CompressorOptions{})).To(Succeed())
+				expectTree(dstDir)
+			})
+
+			It("creates tarballs with the tar compressor that the native compressor extracts", func() {
+				tarballPath, err := shellOut.CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{CompressionFormat: format, CompressionLevel: 1})
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(tarballPath) //nolint:errcheck
+
+				Expect(native.DetectCompressionFormat(tarballPath)).To(Equal(format))
+
+				Expect(native.DecompressFileToDir(tarballPath, dstDir, CompressorOptions{})).To(Succeed())
+				expectTree(dstDir)
+			})
+		})
+	}
+
+	It("prefers NoCompression over CompressionFormat", func() {
+		tarballPath, err := native.CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{NoCompression: true, CompressionFormat: CompressionFormatXz})
+		Expect(err).ToNot(HaveOccurred())
+		defer os.Remove(tarballPath) //nolint:errcheck
+
+		Expect(native.IsNonCompressedTarball(tarballPath)).To(BeTrue())
+	})
+
+	It("returns an error for levels outside of the format's range", func() {
+		_, err := native.CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{CompressionFormat: CompressionFormatBzip2, CompressionLevel: 10})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Invalid compression level 10 for bzip2"))
+
+		_, err = shellOut.CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{CompressionFormat: CompressionFormatZstd, CompressionLevel: 23})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Invalid compression level 23 for zstd"))
+	})
+
+	It("returns an error for unknown formats", func() {
+		_, err := native.CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{CompressionFormat: "lz4"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Unsupported compression format 'lz4'"))
+	})
+
+	It("returns an error when detecting the format of something that is not a tarball", func() {
+		_, err := native.DetectCompressionFormat(filepath.Join(testAssetsFixtureDir, "app.stdout.log"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Not a tarball"))
+	})
+})
@@ -1,10 +1,35 @@
 package fileutil
 
+import (
+	"io"
+)
+
 type CompressorOptions struct {
 	SameOwner       bool
 	PathInArchive   string
 	StripComponents int
 	NoCompression   bool
+
+	// CompressionFormat used when compressing, gzip if empty; ignored when NoCompression is set
+	CompressionFormat CompressionFormat
+	// CompressionLevel is specific to CompressionFormat, zero uses the format's default
+	CompressionLevel int
+
+	// Reproducible creates byte for byte identical tarballs from identical content
+	// by sorting entries, zeroing ownership and setting every modification time
+	// to SOURCE_DATE_EPOCH, or to the Unix epoch if it is unset
+	Reproducible bool
+
+	// Concurrency greater than 1 compresses gzip tarballs in blocks of BlockSize
+	// bytes on that many cores, BlockSize defaults to 1 MiB. The result is still
+	// a standard gzip stream, at a slightly lower compression ratio.
+	Concurrency int
+	BlockSize   int
+
+	// Limits enforced while extracting; zero means unlimited
+	MaxTotalSize int64
+	MaxEntries   int
+	MaxFileSize  int64
 }
 
 type Compressor interface {
@@ -13,10 +38,33 @@ type Compressor interface {
 
 	CompressSpecificFilesInDir(dir string, files []string, options CompressorOptions) (path string, err error)
 
+	// CompressFilesInDirToWriter writes the compressed tarball to w instead of a temporary file
+	CompressFilesInDirToWriter(dir string, w io.Writer, options CompressorOptions) (err error)
+
+	CompressSpecificFilesInDirToWriter(dir string, files []string, w io.Writer, options CompressorOptions) (err error)
+
+	// DecompressFileToDir rejects entries that would be written outside of dir
+	// and entries exceeding the limits set in options
 	DecompressFileToDir(path string, dir string, options CompressorOptions) (err error)
 
+	// DecompressReaderToDir extracts a tarball read from r the same way as DecompressFileToDir
+	DecompressReaderToDir(r io.Reader, dir string, options CompressorOptions) (err error)
+
+	// ListEntries returns the entries of the tarball at path in archive order
+	ListEntries(path string) ([]ArchiveEntry, error)
+
+	// OpenEntry returns the content of a single file in the tarball at path without
+	// extracting the tarball; name is matched with or without a leading "./"
+	OpenEntry(path string, name string) (io.ReadCloser, error)
+
+	// ReadEntry is OpenEntry reading the whole content into memory
+	ReadEntry(path string, name string) ([]byte, error)
+
 	IsNonCompressedTarball(path string) bool
 
+	// DetectCompressionFormat returns CompressionFormatNone for uncompressed tarballs
+	DetectCompressionFormat(path string) (CompressionFormat, error)
+
 	// CleanUp cleans up compressed file after it was used
 	CleanUp(path string) error
 }
@@ -1,7 +1,30 @@
 package fileutil
 
+// CopyOptions control how FilteredMultiCopyToDir selects and copies files
+type CopyOptions struct {
+	// Filters are globs relative to each directory, a directory matches everything
+	// below it. A filter starting with "!" excludes the files it matches again,
+	// unless a later filter includes them, the way .gitignore patterns do.
+	Filters []string
+
+	PreserveMode    bool
+	PreserveOwner   bool
+	PreserveModTime bool
+
+	// PreserveSymlinks copies symlinks as symlinks rather than what they point to
+	PreserveSymlinks bool
+
+	// PreserveHardLinks links files that are hard links of each other in the
+	// source in the destination too, rather than copying their content again
+	PreserveHardLinks bool
+}
+
 type Copier interface {
 	FilteredMultiCopyToTemp(dirs []DirToCopy, filters []string) (string, error)
 	FilteredCopyToTemp(dir string, filters []string) (tempDir string, err error)
+
+	// FilteredMultiCopyToDir copies into an existing dstDir, keeping what is already in it
+	FilteredMultiCopyToDir(dirs []DirToCopy, dstDir string, options CopyOptions) error
+
 	CleanUp(tempDir string)
 }
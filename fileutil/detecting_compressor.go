@@ -0,0 +1,101 @@
+package fileutil
+
+import (
+	"bufio"
+	"io"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// detectingCompressor reads archives with the tarball or the zip compressor
+// depending on their magic bytes, so callers do not need to know the format
+// in advance. Archives are always created with the tarball compressor.
+type detectingCompressor struct {
+	tarballCompressor Compressor
+	zipCompressor     Compressor
+	fs                boshsys.FileSystem
+}
+
+func NewDetectingCompressor(tarballCompressor, zipCompressor Compressor, fs boshsys.FileSystem) Compressor {
+	return detectingCompressor{
+		tarballCompressor: tarballCompressor,
+		zipCompressor:     zipCompressor,
+		fs:                fs,
+	}
+}
+
+func (c detectingCompressor) CompressFilesInDir(dir string, options CompressorOptions) (string, error) {
+	return c.tarballCompressor.CompressFilesInDir(dir, options)
+}
+
+func (c detectingCompressor) CompressSpecificFilesInDir(dir string, files []string, options CompressorOptions) (string, error) {
+	return c.tarballCompressor.CompressSpecificFilesInDir(dir, files, options)
+}
+
+func (c detectingCompressor) CompressFilesInDirToWriter(dir string, w io.Writer, options CompressorOptions) error {
+	return c.tarballCompressor.CompressFilesInDirToWriter(dir, w, options)
+}
+
+func (c detectingCompressor) CompressSpecificFilesInDirToWriter(dir string, files []string, w io.Writer, options CompressorOptions) error {
+	return c.tarballCompressor.CompressSpecificFilesInDirToWriter(dir, files, w, options)
+}
+
+func (c detectingCompressor) DecompressFileToDir(archivePath string, dir string, options CompressorOptions) error {
+	return c.compressorFor(archivePath).DecompressFileToDir(archivePath, dir, options)
+}
+
+func (c detectingCompressor) DecompressReaderToDir(r io.Reader, dir string, options CompressorOptions) error {
+	bufferedReader := bufio.NewReader(r)
+
+	header, err := bufferedReader.Peek(len(zipMagic))
+	if err != nil && err != io.EOF {
+		return bosherr.WrapError(err, "Reading archive header")
+	}
+
+	if format, _ := compressionFormatFromHeader(header); format == CompressionFormatZip {
+		return c.zipCompressor.DecompressReaderToDir(bufferedReader, dir, options)
+	}
+
+	return c.tarballCompressor.DecompressReaderToDir(bufferedReader, dir, options)
+}
+
+func (c detectingCompressor) ListEntries(archivePath string) ([]ArchiveEntry, error) {
+	return c.compressorFor(archivePath).ListEntries(archivePath)
+}
+
+func (c detectingCompressor) OpenEntry(archivePath string, name string) (io.ReadCloser, error) {
+	return c.compressorFor(archivePath).OpenEntry(archivePath, name)
+}
+
+func (c detectingCompressor) ReadEntry(archivePath string, name string) ([]byte, error) {
+	return c.compressorFor(archivePath).ReadEntry(archivePath, name)
+}
+
+func (c detectingCompressor) IsNonCompressedTarball(path string) bool {
+	return isNonCompressedTarball(c.fs, path)
+}
+
+func (c detectingCompressor) DetectCompressionFormat(path string) (CompressionFormat, error) {
+	return detectCompressionFormat(c.fs, path)
+}
+
+func (c detectingCompressor) CleanUp(archivePath string) error {
+	return c.fs.RemoveAll(archivePath)
+}
+
+// compressorFor falls back to the tarball compressor when the format cannot
+// be detected, so that its errors are reported for unreadable archives
+func (c detectingCompressor) compressorFor(archivePath string) Compressor {
+	resolvedArchivePath, err := c.fs.ReadAndFollowLink(archivePath)
+	if err != nil {
+		return c.tarballCompressor
+	}
+
+	format, err := detectCompressionFormat(c.fs, resolvedArchivePath)
+	if err == nil && format == CompressionFormatZip {
+		return c.zipCompressor
+	}
+
+	return c.tarballCompressor
+}
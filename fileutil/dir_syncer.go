@@ -0,0 +1,369 @@
+package fileutil
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	boshcrypto "github.com/cloudfoundry/bosh-utils/crypto"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+const dirSyncerLogTag = "dirSyncer"
+
+type dirSyncer struct {
+	fs     boshsys.FileSystem
+	logger boshlog.Logger
+}
+
+func NewDirSyncer(fs boshsys.FileSystem, logger boshlog.Logger) Syncer {
+	return dirSyncer{fs: fs, logger: logger}
+}
+
+// Sync compares files by size and modification time like rsync does, and
+// copies modes and modification times along with the content of changed files
+// so that they compare equal on the next sync. Files and symlinks are written
+// to a temporary file next to them that is renamed over them, so that they are
+// never seen partially written. Replacing a directory with another type of
+// entry removes its contents, which are reported even when Delete is off.
+func (s dirSyncer) Sync(srcDir string, dstDir string, options SyncOptions) (SyncReport, error) {
+	var report SyncReport
+
+	srcEntries, srcPaths, err := s.entries(srcDir)
+	if err != nil {
+		return report, bosherr.WrapErrorf(err, "Listing source directory '%s'", srcDir)
+	}
+
+	dstEntries := map[string]os.FileInfo{}
+	var dstPaths []string
+
+	if s.fs.FileExists(dstDir) {
+		dstEntries, dstPaths, err = s.entries(dstDir)
+		if err != nil {
+			return report, bosherr.WrapErrorf(err, "Listing destination directory '%s'", dstDir)
+		}
+	} else if !options.DryRun {
+		err = s.fs.MkdirAll(dstDir, os.ModePerm)
+		if err != nil {
+			return report, bosherr.WrapErrorf(err, "Creating destination directory '%s'", dstDir)
+		}
+	}
+
+	if options.Delete {
+		// Children are removed before the directories containing them
+		for i := len(dstPaths) - 1; i >= 0; i-- {
+			relPath := dstPaths[i]
+			if _, found := srcEntries[relPath]; found {
+				continue
+			}
+
+			report.Removed = append([]string{relPath}, report.Removed...)
+
+			if !options.DryRun {
+				err = s.fs.RemoveAll(filepath.Join(dstDir, filepath.FromSlash(relPath)))
+				if err != nil {
+					return report, bosherr.WrapErrorf(err, "Removing '%s'", relPath)
+				}
+			}
+		}
+	}
+
+	var dirs []string
+
+	for _, relPath := range srcPaths {
+		srcInfo := srcEntries[relPath]
+		dstInfo, found := dstEntries[relPath]
+
+		src := filepath.Join(srcDir, filepath.FromSlash(relPath))
+		dst := filepath.Join(dstDir, filepath.FromSlash(relPath))
+
+		if !found {
+			report.Added = append(report.Added, relPath)
+		} else {
+			changed, err := s.changed(src, dst, srcInfo, dstInfo, options)
+			if err != nil {
+				return report, bosherr.WrapErrorf(err, "Comparing '%s'", relPath)
+			}
+			if !changed {
+				continue
+			}
+
+			report.Updated = append(report.Updated, relPath)
+
+			if dstInfo.IsDir() && !srcInfo.IsDir() && !options.Delete {
+				// With Delete, the contents were already removed as they are not in the source
+				report.Removed = append(report.Removed, childPaths(dstPaths, relPath)...)
+			}
+		}
+
+		if options.DryRun {
+			continue
+		}
+
+		s.logger.Debug(dirSyncerLogTag, "Syncing '%s' to '%s'", src, dst)
+
+		// Files and symlinks replace each other, but directories cannot be replaced
+		if found && syncEntryTypeOf(srcInfo) != syncEntryTypeOf(dstInfo) && (srcInfo.IsDir() || dstInfo.IsDir()) {
+			err = s.fs.RemoveAll(dst)
+			if err != nil {
+				return report, bosherr.WrapErrorf(err, "Removing '%s'", relPath)
+			}
+		}
+
+		err = s.syncEntry(src, dst, srcInfo)
+		if err != nil {
+			return report, bosherr.WrapErrorf(err, "Syncing '%s'", relPath)
+		}
+
+		if srcInfo.IsDir() {
+			dirs = append(dirs, relPath)
+		}
+	}
+
+	// Directory modes are changed last, in case they prevent writing their contents
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err = s.fs.Chmod(filepath.Join(dstDir, filepath.FromSlash(dirs[i])), srcEntries[dirs[i]].Mode().Perm())
+		if err != nil {
+			return report, bosherr.WrapErrorf(err, "Changing mode of '%s'", dirs[i])
+		}
+	}
+
+	sort.Strings(report.Removed)
+
+	return report, nil
+}
+
+// childPaths returns the paths below dir, which are sorted like paths
+func childPaths(paths []string, dir string) []string {
+	var children []string
+	for _, path := range paths {
+		if strings.HasPrefix(path, dir+"/") {
+			children = append(children, path)
+		}
+	}
+	return children
+}
+
+// entries returns the entries below dir by their slash separated path
+// relative to dir, along with those paths in lexical order
+func (s dirSyncer) entries(dir string) (map[string]os.FileInfo, []string, error) {
+	entries := map[string]os.FileInfo{}
+	var paths []string
+
+	err := s.fs.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			if !info.IsDir() {
+				return bosherr.Errorf("Expected '%s' to be a directory", dir)
+			}
+			return nil
+		}
+
+		if syncEntryTypeOf(info) == syncEntryTypeOther {
+			return bosherr.Errorf("Unsupported file type of '%s'", path)
+		}
+
+		relPath = filepath.ToSlash(relPath)
+		entries[relPath] = info
+		paths = append(paths, relPath)
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Strings(paths)
+
+	return entries, paths, nil
+}
+
+func (s dirSyncer) changed(src, dst string, srcInfo, dstInfo os.FileInfo, options SyncOptions) (bool, error) {
+	if syncEntryTypeOf(srcInfo) != syncEntryTypeOf(dstInfo) {
+		return true, nil
+	}
+
+	switch syncEntryTypeOf(srcInfo) {
+	case syncEntryTypeDir:
+		return srcInfo.Mode().Perm() != dstInfo.Mode().Perm(), nil
+
+	case syncEntryTypeSymlink:
+		srcTarget, err := s.fs.Readlink(src)
+		if err != nil {
+			return false, bosherr.WrapErrorf(err, "Reading symlink '%s'", src)
+		}
+
+		dstTarget, err := s.fs.Readlink(dst)
+		if err != nil {
+			return false, bosherr.WrapErrorf(err, "Reading symlink '%s'", dst)
+		}
+
+		return srcTarget != dstTarget, nil
+	}
+
+	if srcInfo.Size() != dstInfo.Size() || srcInfo.Mode().Perm() != dstInfo.Mode().Perm() {
+		return true, nil
+	}
+
+	if options.ChecksumAlgorithm == nil {
+		// Whole seconds, since not every file system stores finer modification times
+		return srcInfo.ModTime().Unix() != dstInfo.ModTime().Unix(), nil
+	}
+
+	srcDigest, err := s.digest(src, options.ChecksumAlgorithm)
+	if err != nil {
+		return false, err
+	}
+
+	dstDigest, err := s.digest(dst, options.ChecksumAlgorithm)
+	if err != nil {
+		return false, err
+	}
+
+	return srcDigest.String() != dstDigest.String(), nil
+}
+
+func (s dirSyncer) digest(path string, algorithm boshcrypto.Algorithm) (boshcrypto.Digest, error) {
+	file, err := s.fs.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Opening '%s'", path)
+	}
+	defer file.Close() //nolint:errcheck
+
+	digest, err := algorithm.CreateDigest(file)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Calculating digest of '%s'", path)
+	}
+
+	return digest, nil
+}
+
+func (s dirSyncer) syncEntry(src, dst string, srcInfo os.FileInfo) error {
+	switch syncEntryTypeOf(srcInfo) {
+	case syncEntryTypeDir:
+		err := s.fs.MkdirAll(dst, os.ModePerm)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Creating directory '%s'", dst)
+		}
+
+		return nil
+
+	}
+
+	tempPath, err := tempSiblingPath(dst)
+	if err != nil {
+		return err
+	}
+
+	err = s.writeTempEntry(src, tempPath, srcInfo)
+	if err != nil {
+		_ = s.fs.RemoveAll(tempPath) //nolint:errcheck
+		return err
+	}
+
+	err = s.fs.ReplaceFile(tempPath, dst)
+	if err != nil {
+		_ = s.fs.RemoveAll(tempPath) //nolint:errcheck
+		return bosherr.WrapErrorf(err, "Replacing '%s' with '%s'", dst, tempPath)
+	}
+
+	return nil
+}
+
+// writeTempEntry writes the file or symlink that replaces dst
+func (s dirSyncer) writeTempEntry(src, tempPath string, srcInfo os.FileInfo) error {
+	if syncEntryTypeOf(srcInfo) == syncEntryTypeSymlink {
+		target, err := s.fs.Readlink(src)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Reading symlink '%s'", src)
+		}
+
+		return s.fs.Symlink(target, tempPath)
+	}
+
+	err := s.copyFile(src, tempPath, srcInfo)
+	if err != nil {
+		return err
+	}
+
+	// The mode is changed explicitly since the umask applies to new files
+	err = s.fs.Chmod(tempPath, srcInfo.Mode().Perm())
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Changing mode of '%s'", tempPath)
+	}
+
+	err = s.fs.Chtimes(tempPath, srcInfo.ModTime(), srcInfo.ModTime())
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Changing modification time of '%s'", tempPath)
+	}
+
+	return nil
+}
+
+func (s dirSyncer) copyFile(src, dst string, srcInfo os.FileInfo) error {
+	srcFile, err := s.fs.OpenFile(src, os.O_RDONLY, 0)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Opening '%s'", src)
+	}
+	defer srcFile.Close() //nolint:errcheck
+
+	dstFile, err := s.fs.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, srcInfo.Mode().Perm())
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Creating '%s'", dst)
+	}
+
+	_, err = io.Copy(dstFile, srcFile)
+	if err != nil {
+		dstFile.Close() //nolint:errcheck
+		return bosherr.WrapErrorf(err, "Copying '%s'", src)
+	}
+
+	// Make sure the content is on disk before the file is renamed into place
+	if syncer, ok := dstFile.(interface{ Sync() error }); ok {
+		err = syncer.Sync()
+		if err != nil {
+			dstFile.Close() //nolint:errcheck
+			return bosherr.WrapErrorf(err, "Syncing '%s'", dst)
+		}
+	}
+
+	err = dstFile.Close()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Closing '%s'", dst)
+	}
+
+	return nil
+}
+
+type syncEntryType string
+
+const (
+	syncEntryTypeFile    syncEntryType = "file"
+	syncEntryTypeDir     syncEntryType = "dir"
+	syncEntryTypeSymlink syncEntryType = "symlink"
+	syncEntryTypeOther   syncEntryType = "other"
+)
+
+func syncEntryTypeOf(info os.FileInfo) syncEntryType {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return syncEntryTypeSymlink
+	case info.IsDir():
+		return syncEntryTypeDir
+	case info.Mode().IsRegular():
+		return syncEntryTypeFile
+	default:
+		return syncEntryTypeOther
+	}
+}
@@ -0,0 +1,298 @@
+package fileutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	boshcrypto "github.com/cloudfoundry/bosh-utils/crypto"
+	. "github.com/cloudfoundry/bosh-utils/fileutil"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+	"github.com/cloudfoundry/bosh-utils/system/fakes"
+)
+
+// replaceRecordingFileSystem records the replaced paths that existed when they were replaced
+type replaceRecordingFileSystem struct {
+	boshsys.FileSystem
+
+	replaced []string
+}
+
+func (fs *replaceRecordingFileSystem) ReplaceFile(oldPath, newPath string) error {
+	if fs.FileExists(newPath) {
+		fs.replaced = append(fs.replaced, newPath)
+	}
+	return fs.FileSystem.ReplaceFile(oldPath, newPath)
+}
+
+var _ = Describe("dirSyncer", func() {
+	var (
+		fs     boshsys.FileSystem
+		syncer Syncer
+		srcDir string
+		dstDir string
+	)
+
+	BeforeEach(func() {
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		fs = boshsys.NewOsFileSystem(logger)
+		syncer = NewDirSyncer(fs, logger)
+
+		srcDir = testAssetsFixtureDir
+		dstDir = filepath.Join(GinkgoT().TempDir(), "dst")
+	})
+
+	writeFile := func(path, content string, modTime time.Time) {
+		Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+		Expect(os.Chtimes(path, modTime, modTime)).To(Succeed())
+	}
+
+	It("copies everything into a missing destination", func() {
+		report, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(report.Added).To(ContainElements("app.stdout.log", "other_logs", "other_logs/more_logs/more.stdout.log"))
+		Expect(report.Updated).To(BeEmpty())
+		Expect(report.Removed).To(BeEmpty())
+
+		content, err := fs.ReadFileString(filepath.Join(dstDir, "other_logs", "more_logs", "more.stdout.log"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(content).To(ContainSubstring("this is more stdout"))
+	})
+
+	It("reports no changes when syncing again", func() {
+		_, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		report, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Changed()).To(BeFalse())
+	})
+
+	It("copies only files whose size or modification time changed", func() {
+		_, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		writeFile(filepath.Join(srcDir, "app.stdout.log"), "changed", time.Now())
+		writeFile(filepath.Join(srcDir, "new.log"), "new", time.Now())
+
+		report, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report).To(Equal(SyncReport{Added: []string{"new.log"}, Updated: []string{"app.stdout.log"}}))
+
+		content, err := fs.ReadFileString(filepath.Join(dstDir, "app.stdout.log"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(content).To(Equal("changed"))
+	})
+
+	Context("when comparing digests", func() {
+		var modTime time.Time
+
+		BeforeEach(func() {
+			modTime = time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+			writeFile(filepath.Join(srcDir, "app.stdout.log"), "source", modTime)
+
+			_, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			// Same size and modification time, different content
+			writeFile(filepath.Join(dstDir, "app.stdout.log"), "tamper", modTime)
+		})
+
+		It("detects changes that size and modification time miss", func() {
+			report, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Changed()).To(BeFalse())
+
+			report, err = syncer.Sync(srcDir, dstDir, SyncOptions{ChecksumAlgorithm: boshcrypto.DigestAlgorithmSHA256})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Updated).To(Equal([]string{"app.stdout.log"}))
+
+			content, err := fs.ReadFileString(filepath.Join(dstDir, "app.stdout.log"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(content).To(Equal("source"))
+		})
+
+		It("ignores modification times", func() {
+			writeFile(filepath.Join(dstDir, "app.stdout.log"), "source", modTime.Add(time.Hour))
+
+			report, err := syncer.Sync(srcDir, dstDir, SyncOptions{ChecksumAlgorithm: boshcrypto.DigestAlgorithmSHA256})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Changed()).To(BeFalse())
+		})
+	})
+
+	Context("when the destination has extraneous files", func() {
+		BeforeEach(func() {
+			_, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(os.MkdirAll(filepath.Join(dstDir, "extra", "dir"), 0755)).To(Succeed())
+			writeFile(filepath.Join(dstDir, "extra", "dir", "file"), "extra", time.Now())
+		})
+
+		It("keeps them by default", func() {
+			report, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Removed).To(BeEmpty())
+			Expect(filepath.Join(dstDir, "extra", "dir", "file")).To(BeAnExistingFile())
+		})
+
+		It("removes them when asked to", func() {
+			report, err := syncer.Sync(srcDir, dstDir, SyncOptions{Delete: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Removed).To(Equal([]string{"extra", "extra/dir", "extra/dir/file"}))
+			Expect(filepath.Join(dstDir, "extra")).ToNot(BeAnExistingFile())
+		})
+	})
+
+	It("replaces entries whose type changed", func() {
+		_, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.RemoveAll(filepath.Join(srcDir, "some_directory"))).To(Succeed())
+		writeFile(filepath.Join(srcDir, "some_directory"), "now a file", time.Now())
+
+		report, err := syncer.Sync(srcDir, dstDir, SyncOptions{Delete: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Updated).To(Equal([]string{"some_directory"}))
+
+		content, err := fs.ReadFileString(filepath.Join(dstDir, "some_directory"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(content).To(Equal("now a file"))
+	})
+
+	It("reports the contents of directories replaced by other entries without Delete", func() {
+		_, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.RemoveAll(filepath.Join(srcDir, "other_logs"))).To(Succeed())
+		writeFile(filepath.Join(srcDir, "other_logs"), "now a file", time.Now())
+
+		report, err := syncer.Sync(srcDir, dstDir, SyncOptions{DryRun: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Removed).To(Equal([]string{
+			"other_logs/more_logs",
+			"other_logs/more_logs/more.stdout.log",
+			"other_logs/other_app.stderr.log",
+			"other_logs/other_app.stdout.log",
+		}))
+
+		actualReport, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actualReport).To(Equal(report))
+
+		content, err := fs.ReadFileString(filepath.Join(dstDir, "other_logs"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(content).To(Equal("now a file"))
+	})
+
+	It("replaces changed files by renaming a copy over them", func() {
+		_, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		// A link to the original file keeps its content once it is replaced
+		link := filepath.Join(GinkgoT().TempDir(), "link")
+		Expect(os.Link(filepath.Join(dstDir, "app.stdout.log"), link)).To(Succeed())
+
+		original, err := os.ReadFile(link)
+		Expect(err).ToNot(HaveOccurred())
+
+		writeFile(filepath.Join(srcDir, "app.stdout.log"), "changed", time.Now())
+
+		_, err = syncer.Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		content, err := fs.ReadFileString(filepath.Join(dstDir, "app.stdout.log"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(content).To(Equal("changed"))
+
+		linked, err := os.ReadFile(link)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(linked).To(Equal(original))
+
+		entries, err := os.ReadDir(dstDir)
+		Expect(err).ToNot(HaveOccurred())
+		for _, entry := range entries {
+			Expect(entry.Name()).ToNot(HavePrefix(".app.stdout.log"))
+		}
+	})
+
+	It("keeps changed files in place until they are replaced", func() {
+		_, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		writeFile(filepath.Join(srcDir, "app.stdout.log"), "changed", time.Now())
+
+		recordingFs := &replaceRecordingFileSystem{FileSystem: fs}
+		_, err = NewDirSyncer(recordingFs, boshlog.NewLogger(boshlog.LevelNone)).Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(recordingFs.replaced).To(Equal([]string{filepath.Join(dstDir, "app.stdout.log")}))
+	})
+
+	It("syncs symlinks and modes", func() {
+		if runtime.GOOS == "windows" {
+			Skip("Symlinks and modes are exercised on POSIX file systems")
+		}
+
+		Expect(os.Symlink("app.stdout.log", filepath.Join(srcDir, "link"))).To(Succeed())
+		Expect(os.Chmod(filepath.Join(srcDir, "app.stderr.log"), 0600)).To(Succeed())
+
+		_, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).ToNot(HaveOccurred())
+
+		target, err := os.Readlink(filepath.Join(dstDir, "link"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(target).To(Equal("app.stdout.log"))
+
+		info, err := os.Stat(filepath.Join(dstDir, "app.stderr.log"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+		Expect(os.Chmod(filepath.Join(srcDir, "app.stderr.log"), 0640)).To(Succeed())
+
+		report, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(report.Updated).To(Equal([]string{"app.stderr.log"}))
+	})
+
+	It("returns an error if the destination is a file", func() {
+		Expect(os.WriteFile(dstDir, []byte("content"), 0644)).To(Succeed())
+
+		_, err := syncer.Sync(srcDir, dstDir, SyncOptions{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Expected '%s' to be a directory", dstDir))
+
+		content, err := fs.ReadFileString(dstDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(content).To(Equal("content"))
+	})
+
+	Context("with a dry run", func() {
+		It("reports changes without making them", func() {
+			report, err := syncer.Sync(srcDir, dstDir, SyncOptions{DryRun: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report.Added).To(ContainElement("app.stdout.log"))
+			Expect(dstDir).ToNot(BeAnExistingFile())
+		})
+
+		It("goes through the file system without writing to it", func() {
+			fakeFs := fakes.NewFakeFileSystem()
+			Expect(fakeFs.WriteFileString("/src/file", "content")).To(Succeed())
+			Expect(fakeFs.WriteFileString("/dst/extra", "extra")).To(Succeed())
+
+			report, err := NewDirSyncer(fakeFs, boshlog.NewLogger(boshlog.LevelNone)).Sync("/src", "/dst", SyncOptions{Delete: true, DryRun: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(report).To(Equal(SyncReport{Added: []string{"file"}, Removed: []string{"extra"}}))
+
+			Expect(fakeFs.FileExists("/dst/file")).To(BeFalse())
+			Expect(fakeFs.FileExists("/dst/extra")).To(BeTrue())
+		})
+	})
+})
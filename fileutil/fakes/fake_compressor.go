@@ -1,6 +1,8 @@
 package fakes
 
 import (
+	"io"
+
 	boshcmd "github.com/cloudfoundry/bosh-utils/fileutil"
 )
 
@@ -18,15 +20,52 @@ type FakeCompressor struct {
 	CompressSpecificFilesInDirErr         error
 	CompressSpecificFilesInDirCallBack    func()
 
+	CompressFilesInDirToWriterDir      string
+	CompressFilesInDirToWriterWriter   io.Writer
+	CompressFilesInDirToWriterOptions  boshcmd.CompressorOptions
+	CompressFilesInDirToWriterErr      error
+	CompressFilesInDirToWriterCallBack func()
+
+	CompressSpecificFilesInDirToWriterDir      string
+	CompressSpecificFilesInDirToWriterFiles    []string
+	CompressSpecificFilesInDirToWriterWriter   io.Writer
+	CompressSpecificFilesInDirToWriterOptions  boshcmd.CompressorOptions
+	CompressSpecificFilesInDirToWriterErr      error
+	CompressSpecificFilesInDirToWriterCallBack func()
+
+	DecompressReaderToDirReaders  []io.Reader
+	DecompressReaderToDirDirs     []string
+	DecompressReaderToDirOptions  []boshcmd.CompressorOptions
+	DecompressReaderToDirErr      error
+	DecompressReaderToDirCallBack func()
+
 	DecompressFileToDirTarballPaths []string
 	DecompressFileToDirDirs         []string
 	DecompressFileToDirOptions      []boshcmd.CompressorOptions
 	DecompressFileToDirErr          error
 	DecompressFileToDirCallBack     func()
 
+	ListEntriesPath    string
+	ListEntriesEntries []boshcmd.ArchiveEntry
+	ListEntriesErr     error
+
+	OpenEntryPath   string
+	OpenEntryName   string
+	OpenEntryReader io.ReadCloser
+	OpenEntryErr    error
+
+	ReadEntryPath    string
+	ReadEntryName    string
+	ReadEntryContent []byte
+	ReadEntryErr     error
+
 	IsNonCompressedTarballPath    string
 	IsNonCompressedTarballReturns bool
 
+	DetectCompressionFormatPath    string
+	DetectCompressionFormatReturns boshcmd.CompressionFormat
+	DetectCompressionFormatErr     error
+
 	CleanUpTarballPath string
 	CleanUpErr         error
 }
@@ -56,6 +95,41 @@ func (fc *FakeCompressor) CompressSpecificFilesInDir(dir string, files []string,
 	return fc.CompressSpecificFilesInDirTarballPath, fc.CompressSpecificFilesInDirErr
 }
 
+func (fc *FakeCompressor) CompressFilesInDirToWriter(dir string, w io.Writer, options boshcmd.CompressorOptions) error {
+	fc.CompressFilesInDirToWriterDir = dir
+	fc.CompressFilesInDirToWriterWriter = w
+	fc.CompressFilesInDirToWriterOptions = options
+	if fc.CompressFilesInDirToWriterCallBack != nil {
+		fc.CompressFilesInDirToWriterCallBack()
+	}
+
+	return fc.CompressFilesInDirToWriterErr
+}
+
+func (fc *FakeCompressor) CompressSpecificFilesInDirToWriter(dir string, files []string, w io.Writer, options boshcmd.CompressorOptions) error {
+	fc.CompressSpecificFilesInDirToWriterDir = dir
+	fc.CompressSpecificFilesInDirToWriterFiles = files
+	fc.CompressSpecificFilesInDirToWriterWriter = w
+	fc.CompressSpecificFilesInDirToWriterOptions = options
+	if fc.CompressSpecificFilesInDirToWriterCallBack != nil {
+		fc.CompressSpecificFilesInDirToWriterCallBack()
+	}
+
+	return fc.CompressSpecificFilesInDirToWriterErr
+}
+
+func (fc *FakeCompressor) DecompressReaderToDir(r io.Reader, dir string, options boshcmd.CompressorOptions) error {
+	fc.DecompressReaderToDirReaders = append(fc.DecompressReaderToDirReaders, r)
+	fc.DecompressReaderToDirDirs = append(fc.DecompressReaderToDirDirs, dir)
+	fc.DecompressReaderToDirOptions = append(fc.DecompressReaderToDirOptions, options)
+
+	if fc.DecompressReaderToDirCallBack != nil {
+		fc.DecompressReaderToDirCallBack()
+	}
+
+	return fc.DecompressReaderToDirErr
+}
+
 func (fc *FakeCompressor) DecompressFileToDir(tarballPath string, dir string, options boshcmd.CompressorOptions) (err error) {
 	fc.DecompressFileToDirTarballPaths = append(fc.DecompressFileToDirTarballPaths, tarballPath)
 	fc.DecompressFileToDirDirs = append(fc.DecompressFileToDirDirs, dir)
@@ -68,11 +142,33 @@ func (fc *FakeCompressor) DecompressFileToDir(tarballPath string, dir string, op
 	return fc.DecompressFileToDirErr
 }
 
+func (fc *FakeCompressor) ListEntries(path string) ([]boshcmd.ArchiveEntry, error) {
+	fc.ListEntriesPath = path
+	return fc.ListEntriesEntries, fc.ListEntriesErr
+}
+
+func (fc *FakeCompressor) OpenEntry(path string, name string) (io.ReadCloser, error) {
+	fc.OpenEntryPath = path
+	fc.OpenEntryName = name
+	return fc.OpenEntryReader, fc.OpenEntryErr
+}
+
+func (fc *FakeCompressor) ReadEntry(path string, name string) ([]byte, error) {
+	fc.ReadEntryPath = path
+	fc.ReadEntryName = name
+	return fc.ReadEntryContent, fc.ReadEntryErr
+}
+
 func (fc *FakeCompressor) IsNonCompressedTarball(path string) bool {
 	fc.IsNonCompressedTarballPath = path
 	return fc.IsNonCompressedTarballReturns
 }
 
+func (fc *FakeCompressor) DetectCompressionFormat(path string) (boshcmd.CompressionFormat, error) {
+	fc.DetectCompressionFormatPath = path
+	return fc.DetectCompressionFormatReturns, fc.DetectCompressionFormatErr
+}
+
 func (fc *FakeCompressor) CleanUp(tarballPath string) error {
 	fc.CleanUpTarballPath = tarballPath
 	return fc.CleanUpErr
@@ -12,6 +12,11 @@ type FakeCopier struct {
 	FilteredMultiCopyToTempError   error
 	FilteredMultiCopyToTempDir     string
 
+	FilteredMultiCopyToDirDirs    []fileutil.DirToCopy
+	FilteredMultiCopyToDirDstDir  string
+	FilteredMultiCopyToDirOptions fileutil.CopyOptions
+	FilteredMultiCopyToDirError   error
+
 	CleanUpTempDir string
 }
 
@@ -36,6 +41,13 @@ func (c *FakeCopier) FilteredMultiCopyToTemp(dirs []fileutil.DirToCopy, filters
 	return
 }
 
+func (c *FakeCopier) FilteredMultiCopyToDir(dirs []fileutil.DirToCopy, dstDir string, options fileutil.CopyOptions) error {
+	c.FilteredMultiCopyToDirDirs = dirs
+	c.FilteredMultiCopyToDirDstDir = dstDir
+	c.FilteredMultiCopyToDirOptions = options
+	return c.FilteredMultiCopyToDirError
+}
+
 func (c *FakeCopier) CleanUp(tempDir string) {
 	c.CleanUpTempDir = tempDir
 }
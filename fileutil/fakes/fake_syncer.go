@@ -0,0 +1,22 @@
+package fakes
+
+import "github.com/cloudfoundry/bosh-utils/fileutil"
+
+type FakeSyncer struct {
+	SyncSrcDir  string
+	SyncDstDir  string
+	SyncOptions fileutil.SyncOptions
+	SyncReport  fileutil.SyncReport
+	SyncErr     error
+}
+
+func NewFakeSyncer() *FakeSyncer {
+	return &FakeSyncer{}
+}
+
+func (s *FakeSyncer) Sync(srcDir string, dstDir string, options fileutil.SyncOptions) (fileutil.SyncReport, error) {
+	s.SyncSrcDir = srcDir
+	s.SyncDstDir = dstDir
+	s.SyncOptions = options
+	return s.SyncReport, s.SyncErr
+}
@@ -3,6 +3,7 @@ package fileutil
 import (
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/bmatcuk/doublestar"
@@ -49,30 +50,44 @@ func (c genericCpCopier) FilteredMultiCopyToTemp(dirs []DirToCopy, filters []str
 		bosherr.WrapError(err, "Fixing permissions on temp dir") //nolint:errcheck
 	}
 
-	for _, dirToCopy := range dirs {
-		globsFiles := c.convertDirectoriesToGlobs(dirToCopy.Dir, filters)
-		var filesToCopy []string
+	err = c.FilteredMultiCopyToDir(dirs, tempDir, CopyOptions{Filters: filters})
+	if err != nil {
+		c.CleanUp(tempDir)
+		return "", err
+	}
 
-		for _, globFile := range globsFiles {
-			filteredFilesToCopy, err := doublestar.Glob(globFile)
-			if err != nil {
-				c.CleanUp(tempDir)
-				return "", bosherr.WrapError(err, "Finding files matching filters")
-			}
+	return tempDir, nil
+}
 
-			for _, fileToCopy := range filteredFilesToCopy {
-				filesToCopy = append(filesToCopy, strings.TrimPrefix(strings.TrimPrefix(fileToCopy, dirToCopy.Dir), "/"))
-			}
+func (c genericCpCopier) FilteredMultiCopyToDir(dirs []DirToCopy, dstDir string, options CopyOptions) error {
+	copier := &filteredCopy{
+		fs:        c.fs,
+		options:   options,
+		hardLinks: map[fileIdentity]string{},
+		dirs:      map[string]os.FileInfo{},
+	}
+
+	for _, dirToCopy := range dirs {
+		// Files of later dirs overwrite those of earlier dirs at the same destination
+		copier.copied = map[string]struct{}{}
+
+		filesToCopy, err := c.filesToCopy(dirToCopy.Dir, options.Filters)
+		if err != nil {
+			return bosherr.WrapError(err, "Finding files matching filters")
 		}
 
-		err = c.copyFilesToDir(filesToCopy, dirToCopy.Dir, tempDir, dirToCopy.Prefix)
+		err = copier.copyFilesToDir(filesToCopy, dirToCopy.Dir, filepath.Join(dstDir, dirToCopy.Prefix))
 		if err != nil {
-			c.CleanUp(tempDir)
-			return "", bosherr.WrapError(err, "Copying Files to Temp Dir")
+			return bosherr.WrapErrorf(err, "Copying files to '%s'", dstDir)
 		}
 	}
 
-	return tempDir, nil
+	err := copier.applyDirMetadata()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Copying files to '%s'", dstDir)
+	}
+
+	return nil
 }
 
 func (c genericCpCopier) CleanUp(tempDir string) {
@@ -82,45 +97,288 @@ func (c genericCpCopier) CleanUp(tempDir string) {
 	}
 }
 
-func (c genericCpCopier) copyFilesToDir(fileList []string, srcDir string, destDir string, destPrefix string) error {
-	destDir = filepath.Join(destDir, destPrefix)
+// filesToCopy returns the paths relative to dir matched by the last of the
+// filters matching them, unless that filter is an exclusion
+func (c genericCpCopier) filesToCopy(dir string, filters []string) ([]string, error) {
+	var filesToCopy []string
+	seen := map[string]struct{}{}
+
+	for i, filter := range filters {
+		if strings.HasPrefix(filter, "!") {
+			continue
+		}
+
+		filteredFilesToCopy, err := doublestar.Glob(c.convertDirectoryToGlob(dir, filter))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, fileToCopy := range filteredFilesToCopy {
+			if _, found := seen[fileToCopy]; found {
+				continue
+			}
+			seen[fileToCopy] = struct{}{}
+
+			included, err := c.includedByLaterFilters(dir, fileToCopy, filters[i+1:])
+			if err != nil {
+				return nil, err
+			}
+
+			if included {
+				filesToCopy = append(filesToCopy, strings.TrimPrefix(strings.TrimPrefix(fileToCopy, dir), "/"))
+			}
+		}
+	}
+
+	return filesToCopy, nil
+}
+
+func (c genericCpCopier) includedByLaterFilters(dir, file string, filters []string) (bool, error) {
+	included := true
+
+	for _, filter := range filters {
+		exclusion := strings.HasPrefix(filter, "!")
+
+		matched, err := doublestar.PathMatch(c.convertDirectoryToGlob(dir, strings.TrimPrefix(filter, "!")), file)
+		if err != nil {
+			return false, err
+		}
+
+		if matched {
+			included = !exclusion
+		}
+	}
+
+	return included, nil
+}
+
+func (c genericCpCopier) convertDirectoryToGlob(dir string, filter string) string {
+	src := filepath.Join(dir, filter)
+	fileInfo, err := os.Stat(src)
+	if err == nil && fileInfo.IsDir() {
+		return filepath.Join(src, "**", "*")
+	}
+
+	return src
+}
+
+// filteredCopy is the state of a single FilteredMultiCopyToDir call
+type filteredCopy struct {
+	fs      boshsys.FileSystem
+	options CopyOptions
+
+	// copied are destination paths already written from the current dir,
+	// e.g. a symlink that several matched files were found through
+	copied map[string]struct{}
+
+	// hardLinks maps source files to the first destination they were copied to
+	hardLinks map[fileIdentity]string
+
+	// dirs are destination directories whose metadata is applied once
+	// all files have been copied into them
+	dirs map[string]os.FileInfo
+}
 
+func (c *filteredCopy) copyFilesToDir(fileList []string, srcDir string, destDir string) error {
 	for _, relativePath := range fileList {
+		if c.options.PreserveSymlinks {
+			symlinkPath, err := c.symlinkAncestor(srcDir, relativePath)
+			if err != nil {
+				return err
+			}
+			relativePath = symlinkPath
+		}
+
 		src := filepath.Join(srcDir, relativePath)
 		dst := filepath.Join(destDir, relativePath)
 
-		fileInfo, err := os.Stat(src)
+		if _, found := c.copied[dst]; found {
+			continue
+		}
+		c.copied[dst] = struct{}{}
+
+		fileInfo, err := c.stat(src)
 		if err != nil {
 			return bosherr.WrapErrorf(err, "Getting file info for '%s'", src)
 		}
 
-		if !fileInfo.IsDir() {
-			dstContainingDir := filepath.Dir(dst)
-			err := c.fs.MkdirAll(dstContainingDir, os.ModePerm)
-			if err != nil {
-				return bosherr.WrapErrorf(err, "Making destination directory '%s' for '%s'", dstContainingDir, src)
+		if fileInfo.IsDir() {
+			if c.preservesMetadata() && dst != destDir {
+				c.dirs[dst] = fileInfo
 			}
+			continue
+		}
 
-			err = c.fs.CopyFile(src, dst)
-			if err != nil {
-				return err
+		err = c.makeParentDirs(srcDir, destDir, relativePath)
+		if err != nil {
+			return err
+		}
+
+		err = c.copyFile(src, dst, fileInfo)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *filteredCopy) copyFile(src, dst string, fileInfo os.FileInfo) error {
+	if fileInfo.Mode()&os.ModeSymlink != 0 {
+		target, err := c.fs.Readlink(src)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Reading symlink '%s'", src)
+		}
+
+		err = c.fs.Symlink(target, dst)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Creating symlink '%s'", dst)
+		}
+
+		return c.applyMetadata(dst, fileInfo)
+	}
+
+	if c.options.PreserveHardLinks {
+		identity, isHardLink := hardLinkIdentity(fileInfo)
+		if isHardLink {
+			if linkedDst, found := c.hardLinks[identity]; found {
+				err := c.fs.RemoveAll(dst)
+				if err != nil {
+					return bosherr.WrapErrorf(err, "Removing '%s'", dst)
+				}
+
+				err = c.fs.Link(linkedDst, dst)
+				if err != nil {
+					return bosherr.WrapErrorf(err, "Linking '%s' to '%s'", dst, linkedDst)
+				}
+
+				return nil
 			}
+
+			c.hardLinks[identity] = dst
+		}
+	}
+
+	err := c.fs.CopyFile(src, dst)
+	if err != nil {
+		return err
+	}
+
+	return c.applyMetadata(dst, fileInfo)
+}
+
+// makeParentDirs creates the directories leading to relativePath, recording
+// their source so that their metadata can be applied later
+func (c *filteredCopy) makeParentDirs(srcDir, destDir, relativePath string) error {
+	dstContainingDir := filepath.Join(destDir, filepath.Dir(relativePath))
+	err := c.fs.MkdirAll(dstContainingDir, os.ModePerm)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Making destination directory '%s' for '%s'", dstContainingDir, filepath.Join(srcDir, relativePath))
+	}
+
+	if !c.preservesMetadata() {
+		return nil
+	}
+
+	for parent := filepath.Dir(relativePath); parent != "."; parent = filepath.Dir(parent) {
+		dst := filepath.Join(destDir, parent)
+		if _, found := c.dirs[dst]; found {
+			break
 		}
+
+		fileInfo, err := c.fs.Stat(filepath.Join(srcDir, parent))
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Getting file info for '%s'", filepath.Join(srcDir, parent))
+		}
+		c.dirs[dst] = fileInfo
 	}
+
 	return nil
 }
 
-func (c genericCpCopier) convertDirectoriesToGlobs(dir string, filters []string) []string {
-	convertedFilters := []string{}
-	for _, filter := range filters {
-		src := filepath.Join(dir, filter)
-		fileInfo, err := os.Stat(src)
-		if err == nil && fileInfo.IsDir() {
-			convertedFilters = append(convertedFilters, filepath.Join(src, "**", "*"))
-		} else {
-			convertedFilters = append(convertedFilters, src)
+// symlinkAncestor returns the topmost symlink that relativePath was found
+// through, so that the symlink is copied instead of what it points to
+func (c *filteredCopy) symlinkAncestor(srcDir, relativePath string) (string, error) {
+	var ancestors []string
+	for parent := filepath.Dir(relativePath); parent != "."; parent = filepath.Dir(parent) {
+		ancestors = append([]string{parent}, ancestors...)
+	}
+
+	for _, ancestor := range ancestors {
+		fileInfo, err := c.fs.Lstat(filepath.Join(srcDir, ancestor))
+		if err != nil {
+			return "", bosherr.WrapErrorf(err, "Getting file info for '%s'", filepath.Join(srcDir, ancestor))
+		}
+
+		if fileInfo.Mode()&os.ModeSymlink != 0 {
+			return ancestor, nil
+		}
+	}
+
+	return relativePath, nil
+}
+
+func (c *filteredCopy) stat(path string) (os.FileInfo, error) {
+	if c.options.PreserveSymlinks {
+		return c.fs.Lstat(path)
+	}
+
+	return c.fs.Stat(path)
+}
+
+func (c *filteredCopy) preservesMetadata() bool {
+	return c.options.PreserveMode || c.options.PreserveOwner || c.options.PreserveModTime
+}
+
+func (c *filteredCopy) applyDirMetadata() error {
+	var dirs []string
+	for dir := range c.dirs {
+		dirs = append(dirs, dir)
+	}
+
+	// Deepest first, in case a read-only parent would prevent changing its children
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+
+	for _, dir := range dirs {
+		err := c.applyMetadata(dir, c.dirs[dir])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *filteredCopy) applyMetadata(dst string, fileInfo os.FileInfo) error {
+	isSymlink := fileInfo.Mode()&os.ModeSymlink != 0
+
+	// The owner is changed first, since changing it clears setuid and setgid bits
+	if c.options.PreserveOwner {
+		uid, gid, found := fileOwner(fileInfo)
+		if found {
+			err := lchown(dst, uid, gid)
+			if err != nil {
+				return bosherr.WrapErrorf(err, "Changing owner of '%s'", dst)
+			}
+		}
+	}
+
+	if isSymlink {
+		return nil
+	}
+
+	if c.options.PreserveMode {
+		err := c.fs.Chmod(dst, fileInfo.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Changing mode of '%s'", dst)
 		}
 	}
 
-	return convertedFilters
+	if c.options.PreserveModTime {
+		err := c.fs.Chtimes(dst, fileInfo.ModTime(), fileInfo.ModTime())
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Changing modification time of '%s'", dst)
+		}
+	}
+
+	return nil
 }
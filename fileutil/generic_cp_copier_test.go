@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -34,6 +35,24 @@ func filesInDir(dir string) []string {
 	return copiedFiles
 }
 
+// linkRecordingFileSystem records the paths of links and modification time changes
+type linkRecordingFileSystem struct {
+	boshsys.FileSystem
+
+	links   []string
+	chtimes []string
+}
+
+func (fs *linkRecordingFileSystem) Link(oldPath, newPath string) error {
+	fs.links = append(fs.links, newPath)
+	return fs.FileSystem.Link(oldPath, newPath)
+}
+
+func (fs *linkRecordingFileSystem) Chtimes(path string, atime, mtime time.Time) error {
+	fs.chtimes = append(fs.chtimes, path)
+	return fs.FileSystem.Chtimes(path, atime, mtime)
+}
+
 var _ = Describe("genericCpCopier", func() {
 	var (
 		fs       boshsys.FileSystem
@@ -193,6 +212,166 @@ var _ = Describe("genericCpCopier", func() {
 		})
 	})
 
+	Describe("FilteredMultiCopyToDir", func() {
+		var dstDir string
+
+		BeforeEach(func() {
+			dstDir = GinkgoT().TempDir()
+		})
+
+		relativeFilesInDir := func(dir string) []string {
+			var files []string
+			for _, file := range filesInDir(dir) {
+				relativePath, err := filepath.Rel(dir, file)
+				Expect(err).ToNot(HaveOccurred())
+				files = append(files, filepath.ToSlash(relativePath))
+			}
+			return files
+		}
+
+		It("copies into the given directory, keeping its existing files", func() {
+			Expect(fs.WriteFileString(filepath.Join(dstDir, "existing"), "existing")).To(Succeed())
+
+			err := cpCopier.FilteredMultiCopyToDir([]DirToCopy{{Dir: testAssetsFixtureDir, Prefix: "prefix"}}, dstDir, CopyOptions{Filters: []string{"*.stdout.log"}})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(relativeFilesInDir(dstDir)).To(Equal([]string{"existing", "prefix/app.stdout.log"}))
+		})
+
+		It("overwrites files of earlier dirs with the same files of later dirs", func() {
+			firstDir := GinkgoT().TempDir()
+			secondDir := GinkgoT().TempDir()
+			Expect(fs.WriteFileString(filepath.Join(firstDir, "same.log"), "first")).To(Succeed())
+			Expect(fs.WriteFileString(filepath.Join(secondDir, "same.log"), "second")).To(Succeed())
+
+			err := cpCopier.FilteredMultiCopyToDir([]DirToCopy{{Dir: firstDir}, {Dir: secondDir}}, dstDir, CopyOptions{Filters: []string{"*.log"}})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fs.ReadFileString(filepath.Join(dstDir, "same.log"))).To(Equal("second"))
+		})
+
+		It("excludes files matching negated filters unless a later filter includes them again", func() {
+			filters := []string{"**/*", "!other_logs", "other_logs/more_logs", "!**/*.stderr.log"}
+
+			err := cpCopier.FilteredMultiCopyToDir([]DirToCopy{{Dir: testAssetsFixtureDir}}, dstDir, CopyOptions{Filters: filters})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(relativeFilesInDir(dstDir)).To(Equal([]string{
+				".keep",
+				"app.stdout.log",
+				"other_logs/more_logs/more.stdout.log",
+				"some_directory/sub_dir/other_sub_dir/.keep",
+			}))
+		})
+
+		It("supports negated filters when copying to temp", func() {
+			tempDir, err := cpCopier.FilteredCopyToTemp(testAssetsFixtureDir, []string{"*.log", "!app.stderr.log"})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tempDir) //nolint:errcheck
+
+			Expect(relativeFilesInDir(tempDir)).To(Equal([]string{"app.stdout.log"}))
+		})
+
+		Context("on POSIX file systems", func() {
+			BeforeEach(func() {
+				if runtime.GOOS == "windows" {
+					Skip("Modes, owners and links are exercised on POSIX file systems")
+				}
+			})
+
+			It("preserves modes and modification times", func() {
+				modTime := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+				Expect(os.Chmod(filepath.Join(testAssetsFixtureDir, "other_logs", "other_app.stdout.log"), 0600)).To(Succeed())
+				Expect(os.Chtimes(filepath.Join(testAssetsFixtureDir, "other_logs", "other_app.stdout.log"), modTime, modTime)).To(Succeed())
+				Expect(os.Chmod(filepath.Join(testAssetsFixtureDir, "other_logs"), 0750)).To(Succeed())
+				Expect(os.Chtimes(filepath.Join(testAssetsFixtureDir, "other_logs"), modTime, modTime)).To(Succeed())
+
+				err := cpCopier.FilteredMultiCopyToDir([]DirToCopy{{Dir: testAssetsFixtureDir}}, dstDir, CopyOptions{
+					Filters:         []string{"other_logs/*.stdout.log"},
+					PreserveMode:    true,
+					PreserveModTime: true,
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				fileInfo, err := os.Stat(filepath.Join(dstDir, "other_logs", "other_app.stdout.log"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0600)))
+				Expect(fileInfo.ModTime()).To(BeTemporally("==", modTime))
+
+				dirInfo, err := os.Stat(filepath.Join(dstDir, "other_logs"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(dirInfo.Mode().Perm()).To(Equal(os.FileMode(0750)))
+				Expect(dirInfo.ModTime()).To(BeTemporally("==", modTime))
+			})
+
+			It("preserves owners", func() {
+				if os.Getuid() != 0 {
+					Skip("Changing owners requires root")
+				}
+
+				Expect(os.Lchown(filepath.Join(testAssetsFixtureDir, "app.stdout.log"), 1234, 5678)).To(Succeed())
+
+				err := cpCopier.FilteredMultiCopyToDir([]DirToCopy{{Dir: testAssetsFixtureDir}}, dstDir, CopyOptions{Filters: []string{"app.stdout.log"}, PreserveOwner: true})
+				Expect(err).ToNot(HaveOccurred())
+
+				fileInfo, err := os.Stat(filepath.Join(dstDir, "app.stdout.log"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(fileInfo.Sys()).To(HaveField("Uid", uint32(1234)))
+				Expect(fileInfo.Sys()).To(HaveField("Gid", uint32(5678)))
+			})
+
+			It("copies symlinks as symlinks", func() {
+				Expect(os.Symlink("../symlink_target", filepath.Join(testAssetsFixtureDir, "symlink_dir"))).To(Succeed())
+				Expect(os.Symlink("app.stdout.log", filepath.Join(testAssetsFixtureDir, "symlink_file"))).To(Succeed())
+
+				err := cpCopier.FilteredMultiCopyToDir([]DirToCopy{{Dir: testAssetsFixtureDir}}, dstDir, CopyOptions{Filters: []string{"**/*.stdout.log", "symlink_file"}, PreserveSymlinks: true})
+				Expect(err).ToNot(HaveOccurred())
+
+				target, err := os.Readlink(filepath.Join(dstDir, "symlink_dir"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(target).To(Equal("../symlink_target"))
+
+				target, err = os.Readlink(filepath.Join(dstDir, "symlink_file"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(target).To(Equal("app.stdout.log"))
+			})
+
+			It("links hard links and changes modification times through the file system", func() {
+				Expect(os.Link(filepath.Join(testAssetsFixtureDir, "app.stdout.log"), filepath.Join(testAssetsFixtureDir, "latest.log"))).To(Succeed())
+
+				recordingFs := &linkRecordingFileSystem{FileSystem: fs}
+				cpCopier = NewGenericCpCopier(recordingFs, boshlog.NewLogger(boshlog.LevelNone))
+
+				err := cpCopier.FilteredMultiCopyToDir([]DirToCopy{{Dir: testAssetsFixtureDir}}, dstDir, CopyOptions{
+					Filters:           []string{"app.stdout.log", "latest.log"},
+					PreserveHardLinks: true,
+					PreserveModTime:   true,
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(recordingFs.links).To(Equal([]string{filepath.Join(dstDir, "latest.log")}))
+				Expect(recordingFs.chtimes).To(Equal([]string{filepath.Join(dstDir, "app.stdout.log")}))
+			})
+
+			It("links hard links instead of copying them twice", func() {
+				Expect(os.Link(filepath.Join(testAssetsFixtureDir, "app.stdout.log"), filepath.Join(testAssetsFixtureDir, "latest.log"))).To(Succeed())
+
+				err := cpCopier.FilteredMultiCopyToDir([]DirToCopy{{Dir: testAssetsFixtureDir}}, dstDir, CopyOptions{Filters: []string{"*.log"}, PreserveHardLinks: true})
+				Expect(err).ToNot(HaveOccurred())
+
+				original, err := os.Stat(filepath.Join(dstDir, "app.stdout.log"))
+				Expect(err).ToNot(HaveOccurred())
+				link, err := os.Stat(filepath.Join(dstDir, "latest.log"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(os.SameFile(original, link)).To(BeTrue())
+
+				stderr, err := os.Stat(filepath.Join(dstDir, "app.stderr.log"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(os.SameFile(original, stderr)).To(BeFalse())
+			})
+		})
+	})
+
 	Describe("CleanUp", func() {
 		It("cleans up", func() {
 			tempDir := filepath.Join(os.TempDir(), "test-copier-cleanup")
@@ -19,13 +19,7 @@ func NewFileMover(fs boshsys.FileSystem) fileMover {
 func (m fileMover) Move(oldPath, newPath string) error {
 	err := m.fs.Rename(oldPath, newPath)
 
-	le, ok := err.(*os.LinkError)
-	if !ok {
-		return err
-	}
-
-	// 0x11 is Win32 Error Code ERROR_NOT_SAME_DEVICE (https://msdn.microsoft.com/en-us/library/cc231199.aspx)
-	if le.Err == syscall.Errno(0x12) || (runtime.GOOS == "windows" && le.Err == syscall.Errno(0x11)) {
+	if isCrossDeviceError(err) {
 		err = m.fs.CopyFile(oldPath, newPath)
 		if err != nil {
 			return err
@@ -41,3 +35,14 @@ func (m fileMover) Move(oldPath, newPath string) error {
 
 	return err
 }
+
+// isCrossDeviceError returns true for errors renaming across file systems
+func isCrossDeviceError(err error) bool {
+	le, ok := err.(*os.LinkError)
+	if !ok {
+		return false
+	}
+
+	// 0x11 is Win32 Error Code ERROR_NOT_SAME_DEVICE (https://msdn.microsoft.com/en-us/library/cc231199.aspx)
+	return le.Err == syscall.Errno(0x12) || (runtime.GOOS == "windows" && le.Err == syscall.Errno(0x11))
+}
@@ -0,0 +1,287 @@
+package fileutil
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+const nativeTarballCompressorLogTag = "nativeTarballCompressor"
+
+// nativeTarballCompressor reads and writes tarballs with archive/tar
+// instead of shelling out, so it does not depend on a tar binary being
+// installed or on differences between GNU, BSD and Windows tar.
+type nativeTarballCompressor struct {
+	fs     boshsys.FileSystem
+	logger boshlog.Logger
+}
+
+func NewNativeTarballCompressor(fs boshsys.FileSystem, logger boshlog.Logger) Compressor {
+	return nativeTarballCompressor{fs: fs, logger: logger}
+}
+
+func (c nativeTarballCompressor) CompressFilesInDir(dir string, options CompressorOptions) (string, error) {
+	return c.CompressSpecificFilesInDir(dir, []string{"."}, options)
+}
+
+func (c nativeTarballCompressor) CompressSpecificFilesInDir(dir string, files []string, options CompressorOptions) (string, error) {
+	tarball, err := c.fs.TempFile("bosh-platform-disk-NativeTarballCompressor-CompressSpecificFilesInDir")
+	if err != nil {
+		return "", bosherr.WrapError(err, "Creating temporary file for tarball")
+	}
+
+	defer tarball.Close() //nolint:errcheck
+
+	tarballPath := tarball.Name()
+
+	err = c.CompressSpecificFilesInDirToWriter(dir, files, tarball, options)
+	if err != nil {
+		_ = c.fs.RemoveAll(tarballPath) //nolint:errcheck
+		return "", err
+	}
+
+	return tarballPath, nil
+}
+
+func (c nativeTarballCompressor) CompressFilesInDirToWriter(dir string, w io.Writer, options CompressorOptions) error {
+	return c.CompressSpecificFilesInDirToWriter(dir, []string{"."}, w, options)
+}
+
+func (c nativeTarballCompressor) CompressSpecificFilesInDirToWriter(dir string, files []string, w io.Writer, options CompressorOptions) error {
+	err := c.writeTarball(w, dir, files, options)
+	if err != nil {
+		return bosherr.WrapError(err, "Writing tarball")
+	}
+
+	return nil
+}
+
+func (c nativeTarballCompressor) writeTarball(w io.Writer, dir string, files []string, options CompressorOptions) error {
+	compressor, err := compressingWriter(w, options)
+	if err != nil {
+		return err
+	}
+
+	tarWriter := tar.NewWriter(compressor)
+	entryWriter := tarEntryWriter{
+		tarWriter: tarWriter,
+		hardLinks: map[fileIdentity]string{},
+	}
+
+	if options.Reproducible {
+		files = append([]string{}, files...)
+		sort.Strings(files)
+
+		modTime, err := reproducibleModTime()
+		if err != nil {
+			return err
+		}
+		entryWriter.reproducibleModTime = &modTime
+	}
+
+	for _, file := range files {
+		err := c.addToTarball(entryWriter, dir, file)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return bosherr.WrapError(err, "Closing tar writer")
+	}
+
+	err = compressor.Close()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Compressing tarball with %s", options.compressionFormat())
+	}
+
+	return nil
+}
+
+// addToTarball adds file and everything below it, naming entries the way
+// tar -C dir file does, e.g. "./sub/" when file is "." and "file/sub/" otherwise
+func (c nativeTarballCompressor) addToTarball(entryWriter tarEntryWriter, dir, file string) error {
+	root := filepath.Join(dir, file)
+	file = strings.TrimSuffix(filepath.ToSlash(file), "/")
+
+	return c.fs.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Walking '%s'", filePath)
+		}
+
+		relPath, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Determining path of '%s' in archive", filePath)
+		}
+
+		name := file
+		if relPath != "." {
+			name = file + "/" + filepath.ToSlash(relPath)
+		}
+
+		return c.addEntry(entryWriter, filePath, name, info)
+	})
+}
+
+// tarEntryWriter is the state shared by all entries of a tarball being written
+type tarEntryWriter struct {
+	tarWriter *tar.Writer
+	hardLinks map[fileIdentity]string
+
+	// reproducibleModTime replaces modification times and ownership when set
+	reproducibleModTime *time.Time
+}
+
+func (c nativeTarballCompressor) addEntry(entryWriter tarEntryWriter, filePath, name string, info os.FileInfo) error {
+	// Sockets cannot be archived, so they are skipped like tar skips them
+	if info.Mode()&os.ModeSocket != 0 {
+		c.logger.Warn(nativeTarballCompressorLogTag, "Skipping socket '%s'", filePath)
+		return nil
+	}
+
+	var linkTarget string
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		linkTarget, err = c.fs.Readlink(filePath)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Reading symlink '%s'", filePath)
+		}
+	}
+
+	header, err := tar.FileInfoHeader(info, linkTarget)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Creating tar header for '%s'", filePath)
+	}
+
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+
+	if info.Mode().IsRegular() {
+		if id, ok := hardLinkIdentity(info); ok {
+			if firstName, found := entryWriter.hardLinks[id]; found {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = firstName
+				header.Size = 0
+			} else {
+				entryWriter.hardLinks[id] = name
+			}
+		}
+	}
+
+	if entryWriter.reproducibleModTime != nil {
+		header.ModTime = *entryWriter.reproducibleModTime
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+		header.Uid = 0
+		header.Gid = 0
+		header.Uname = ""
+		header.Gname = ""
+	}
+
+	err = entryWriter.tarWriter.WriteHeader(header)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing tar header for '%s'", filePath)
+	}
+
+	if header.Typeflag != tar.TypeReg {
+		return nil
+	}
+
+	f, err := c.fs.OpenFile(filePath, os.O_RDONLY, 0)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Opening '%s'", filePath)
+	}
+	defer f.Close() //nolint:errcheck
+
+	_, err = io.Copy(entryWriter.tarWriter, f)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing '%s' to tarball", filePath)
+	}
+
+	return nil
+}
+
+func (c nativeTarballCompressor) DecompressFileToDir(tarballPath string, dir string, options CompressorOptions) error {
+	resolvedTarballPath, err := c.fs.ReadAndFollowLink(tarballPath)
+	if err != nil {
+		return bosherr.WrapError(err, "Resolving tarball path")
+	}
+
+	tarball, err := c.fs.OpenFile(resolvedTarballPath, os.O_RDONLY, 0)
+	if err != nil {
+		return bosherr.WrapError(err, "Opening tarball")
+	}
+	defer tarball.Close() //nolint:errcheck
+
+	return c.DecompressReaderToDir(tarball, dir, options)
+}
+
+func (c nativeTarballCompressor) DecompressReaderToDir(tarball io.Reader, dir string, options CompressorOptions) error {
+	dirInfo, err := c.fs.Stat(dir)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Checking destination directory '%s'", dir)
+	}
+	if !dirInfo.IsDir() {
+		return bosherr.Errorf("Checking destination directory '%s': Not a directory", dir)
+	}
+
+	r, err := decompressingReader(tarball)
+	if err != nil {
+		return err
+	}
+	defer r.Close() //nolint:errcheck
+
+	return archiveExtractor{fs: c.fs}.extract(tarEntryIterator{reader: tar.NewReader(r)}, dir, options)
+}
+
+// reproducibleModTime honours SOURCE_DATE_EPOCH (https://reproducible-builds.org/specs/source-date-epoch/)
+func reproducibleModTime() (time.Time, error) {
+	sourceDateEpoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if sourceDateEpoch == "" {
+		return time.Unix(0, 0), nil
+	}
+
+	seconds, err := strconv.ParseInt(sourceDateEpoch, 10, 64)
+	if err != nil {
+		return time.Time{}, bosherr.WrapErrorf(err, "Parsing SOURCE_DATE_EPOCH '%s'", sourceDateEpoch)
+	}
+
+	return time.Unix(seconds, 0), nil
+}
+
+func (c nativeTarballCompressor) ListEntries(tarballPath string) ([]ArchiveEntry, error) {
+	return listArchiveEntries(c.fs, tarballPath)
+}
+
+func (c nativeTarballCompressor) OpenEntry(tarballPath string, name string) (io.ReadCloser, error) {
+	return openArchiveEntry(c.fs, tarballPath, name)
+}
+
+func (c nativeTarballCompressor) ReadEntry(tarballPath string, name string) ([]byte, error) {
+	return readArchiveEntry(c.fs, tarballPath, name)
+}
+
+func (c nativeTarballCompressor) IsNonCompressedTarball(path string) bool {
+	return isNonCompressedTarball(c.fs, path)
+}
+
+func (c nativeTarballCompressor) DetectCompressionFormat(path string) (CompressionFormat, error) {
+	return detectCompressionFormat(c.fs, path)
+}
+
+func (c nativeTarballCompressor) CleanUp(tarballPath string) error {
+	return c.fs.RemoveAll(tarballPath)
+}
@@ -0,0 +1,374 @@
+package fileutil_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	boshcrypto "github.com/cloudfoundry/bosh-utils/crypto"
+	. "github.com/cloudfoundry/bosh-utils/fileutil"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	"github.com/cloudfoundry/bosh-utils/logger/loggerfakes"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+var _ = Describe("nativeTarballCompressor", func() {
+	var (
+		dstDir     string
+		cmdRunner  boshsys.CmdRunner
+		fs         boshsys.FileSystem
+		compressor Compressor
+	)
+
+	BeforeEach(func() {
+		logger := boshlog.NewLogger(boshlog.LevelNone)
+		cmdRunner = boshsys.NewExecCmdRunner(logger)
+		fs = boshsys.NewOsFileSystem(logger)
+
+		var err error
+		dstDir, err = filepath.EvalSymlinks(GinkgoT().TempDir())
+		Expect(err).ToNot(HaveOccurred())
+		compressor = NewNativeTarballCompressor(fs, logger)
+	})
+
+	Describe("CompressFilesInDir", func() {
+		It("creates a tarball that GNU tar can list and extract", func() {
+			symlinkPath := filepath.Join(testAssetsFixtureDir, "symlink_dir")
+			Expect(os.Symlink("../symlink_target", symlinkPath)).To(Succeed())
+
+			tgzName, err := compressor.CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(tgzName) //nolint:errcheck
+
+			tarballContents, _, _, err := cmdRunner.RunCommand("tar", "-tzf", tgzName)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(strings.Fields(tarballContents)).To(ConsistOf(
+				"./",
+				"./.keep",
+				"./app.stderr.log",
+				"./app.stdout.log",
+				"./other_logs/",
+				"./some_directory/",
+				"./some_directory/sub_dir/",
+				"./some_directory/sub_dir/other_sub_dir/",
+				"./some_directory/sub_dir/other_sub_dir/.keep",
+				"./symlink_dir",
+				"./other_logs/more_logs/",
+				"./other_logs/other_app.stderr.log",
+				"./other_logs/other_app.stdout.log",
+				"./other_logs/more_logs/more.stdout.log",
+			))
+
+			_, _, _, err = cmdRunner.RunCommand("tar", "-xzpf", tgzName, "-C", dstDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			content, err := fs.ReadFileString(filepath.Join(dstDir, "other_logs", "other_app.stdout.log"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(content).To(ContainSubstring("this is other app stdout"))
+
+			target, err := os.Readlink(filepath.Join(dstDir, "symlink_dir"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(target).To(Equal("../symlink_target"))
+		})
+
+		It("creates an uncompressed tarball when NoCompression is set", func() {
+			tarName, err := compressor.CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{NoCompression: true})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(tarName) //nolint:errcheck
+
+			Expect(compressor.IsNonCompressedTarball(tarName)).To(BeTrue())
+
+			_, _, _, err = cmdRunner.RunCommand("tar", "-xf", tarName, "-C", dstDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(filepath.Join(dstDir, "app.stdout.log")).To(BeAnExistingFile())
+		})
+
+		It("compresses by default", func() {
+			tgzName, err := compressor.CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(tgzName) //nolint:errcheck
+
+			Expect(compressor.IsNonCompressedTarball(tgzName)).To(BeFalse())
+		})
+
+		It("skips sockets with a warning", func() {
+			if runtime.GOOS == "windows" {
+				Skip("Sockets are only skipped on POSIX file systems")
+			}
+
+			srcDir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(srcDir, "file"), []byte("content"), 0644)).To(Succeed())
+
+			listener, err := net.Listen("unix", filepath.Join(srcDir, "socket"))
+			Expect(err).ToNot(HaveOccurred())
+			defer listener.Close() //nolint:errcheck
+
+			logger := &loggerfakes.FakeLogger{}
+			compressor := NewNativeTarballCompressor(fs, logger)
+
+			tgzName, err := compressor.CompressFilesInDir(srcDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(tgzName) //nolint:errcheck
+
+			tarballContents, _, _, err := cmdRunner.RunCommand("tar", "-tzf", tgzName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.Fields(tarballContents)).To(ConsistOf("./", "./file"))
+
+			Expect(logger.WarnCallCount()).To(Equal(1))
+			_, message, args := logger.WarnArgsForCall(0)
+			Expect(fmt.Sprintf(message, args...)).To(ContainSubstring(filepath.Join(srcDir, "socket")))
+		})
+
+		It("returns an error if the directory does not exist", func() {
+			_, err := compressor.CompressFilesInDir(filepath.Join(dstDir, "missing"), CompressorOptions{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Walking"))
+		})
+	})
+
+	Describe("CompressSpecificFilesInDir", func() {
+		It("names entries relative to the given directory", func() {
+			files := []string{"app.stdout.log", "some_directory", "app.stderr.log"}
+
+			tgzName, err := compressor.CompressSpecificFilesInDir(testAssetsFixtureDir, files, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(tgzName) //nolint:errcheck
+
+			tarballContents, _, _, err := cmdRunner.RunCommand("tar", "-tzf", tgzName)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(strings.Fields(tarballContents)).To(Equal([]string{
+				"app.stdout.log",
+				"some_directory/",
+				"some_directory/sub_dir/",
+				"some_directory/sub_dir/other_sub_dir/",
+				"some_directory/sub_dir/other_sub_dir/.keep",
+				"app.stderr.log",
+			}))
+		})
+	})
+
+	Describe("DecompressFileToDir", func() {
+		It("decompresses a tarball created by GNU tar", func() {
+			err := compressor.DecompressFileToDir(filepath.Join(testAssetsDir, "compressor-decompress-file-to-dir.tgz"), dstDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			content, err := fs.ReadFileString(filepath.Join(dstDir, "dir", "nested-dir", "double-nested-file"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(content).To(ContainSubstring("double-nested-file"))
+
+			Expect(filepath.Join(dstDir, "empty-dir")).To(beDir())
+			Expect(filepath.Join(dstDir, "dir", "empty-nested-dir")).To(beDir())
+		})
+
+		It("restores symlinks and hard links", func() {
+			err := compressor.DecompressFileToDir(filepath.Join(testAssetsDir, "compressor-decompress-with-links.tgz"), dstDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			target, err := os.Readlink(filepath.Join(dstDir, "symlink_dir"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(target).To(Equal("../symlink_target"))
+
+			linkInfo, err := os.Stat(filepath.Join(dstDir, "latest.log"))
+			Expect(err).ToNot(HaveOccurred())
+			fileInfo, err := os.Stat(filepath.Join(dstDir, "app.stdout.log"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.SameFile(linkInfo, fileInfo)).To(BeTrue())
+		})
+
+		It("round trips hard links and permissions", func() {
+			if runtime.GOOS == "windows" {
+				Skip("Hard links and POSIX permissions are not preserved on Windows")
+			}
+
+			srcDir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(srcDir, "script"), []byte("#!/bin/sh"), 0750)).To(Succeed())
+			Expect(os.Link(filepath.Join(srcDir, "script"), filepath.Join(srcDir, "script-link"))).To(Succeed())
+			Expect(os.Mkdir(filepath.Join(srcDir, "private"), 0700)).To(Succeed())
+
+			tgzName, err := compressor.CompressFilesInDir(srcDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(tgzName) //nolint:errcheck
+
+			tarballContents, _, _, err := cmdRunner.RunCommand("tar", "-tvzf", tgzName)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tarballContents).To(MatchRegexp(`\./script-link link to \./script`))
+
+			err = compressor.DecompressFileToDir(tgzName, dstDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			scriptInfo, err := os.Stat(filepath.Join(dstDir, "script"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scriptInfo.Mode().Perm()).To(Equal(os.FileMode(0750)))
+
+			linkInfo, err := os.Stat(filepath.Join(dstDir, "script-link"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.SameFile(scriptInfo, linkInfo)).To(BeTrue())
+
+			dirInfo, err := os.Stat(filepath.Join(dstDir, "private"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dirInfo.Mode().Perm()).To(Equal(os.FileMode(0700)))
+		})
+
+		It("restores setuid, setgid and sticky bits after restoring ownership", func() {
+			if runtime.GOOS == "windows" || os.Geteuid() != 0 {
+				Skip("Changing ownership requires root")
+			}
+
+			srcDir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(srcDir, "script"), []byte("#!/bin/sh"), 0755)).To(Succeed())
+			Expect(os.Chmod(filepath.Join(srcDir, "script"), 0755|os.ModeSetuid|os.ModeSetgid)).To(Succeed())
+			Expect(os.Mkdir(filepath.Join(srcDir, "shared"), 0777)).To(Succeed())
+			Expect(os.Chmod(filepath.Join(srcDir, "shared"), 0777|os.ModeSticky)).To(Succeed())
+
+			tgzName, err := compressor.CompressFilesInDir(srcDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(tgzName) //nolint:errcheck
+
+			err = compressor.DecompressFileToDir(tgzName, dstDir, CompressorOptions{SameOwner: true})
+			Expect(err).ToNot(HaveOccurred())
+
+			scriptInfo, err := os.Stat(filepath.Join(dstDir, "script"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(scriptInfo.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid)).To(Equal(0755 | os.ModeSetuid | os.ModeSetgid))
+
+			dirInfo, err := os.Stat(filepath.Join(dstDir, "shared"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dirInfo.Mode() & (os.ModePerm | os.ModeSticky)).To(Equal(0777 | os.ModeSticky))
+		})
+
+		It("strips leading path components like GNU tar", func() {
+			err := compressor.DecompressFileToDir(filepath.Join(testAssetsDir, "compressor-decompress-file-to-dir.tgz"), dstDir, CompressorOptions{StripComponents: 2})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(filepath.Join(dstDir, "nested-file")).To(BeAnExistingFile())
+			Expect(filepath.Join(dstDir, "nested-dir", "double-nested-file")).To(BeAnExistingFile())
+			Expect(filepath.Join(dstDir, "not-nested-file")).ToNot(BeAnExistingFile())
+		})
+
+		It("only extracts PathInArchive", func() {
+			err := compressor.DecompressFileToDir(filepath.Join(testAssetsDir, "compressor-decompress-file-to-dir.tgz"), dstDir, CompressorOptions{PathInArchive: "./dir/nested-dir"})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(filepath.Join(dstDir, "dir", "nested-dir", "double-nested-file")).To(BeAnExistingFile())
+			Expect(filepath.Join(dstDir, "dir", "nested-file")).ToNot(BeAnExistingFile())
+			Expect(filepath.Join(dstDir, "not-nested-file")).ToNot(BeAnExistingFile())
+		})
+
+		It("returns an error if PathInArchive is not in the tarball", func() {
+			err := compressor.DecompressFileToDir(filepath.Join(testAssetsDir, "compressor-decompress-file-to-dir.tgz"), dstDir, CompressorOptions{PathInArchive: "missing"})
+			Expect(err).To(MatchError("Finding 'missing' in archive: Not found"))
+		})
+
+		It("restores ownership when SameOwner is set", func() {
+			if runtime.GOOS == "windows" || os.Geteuid() != 0 {
+				Skip("Changing ownership requires root")
+			}
+
+			err := compressor.DecompressFileToDir(filepath.Join(testAssetsDir, "compressor-decompress-with-links.tgz"), dstDir, CompressorOptions{SameOwner: true})
+			Expect(err).ToNot(HaveOccurred())
+
+			ownerIDs, _, _, err := cmdRunner.RunCommand("stat", "-c", "%u:%g", filepath.Join(dstDir, "app.stdout.log"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.TrimSpace(ownerIDs)).To(Equal("502:20"))
+		})
+
+		It("returns error if the destination does not exist", func() {
+			Expect(fs.RemoveAll(dstDir)).To(Succeed())
+
+			err := compressor.DecompressFileToDir(filepath.Join(testAssetsDir, "compressor-decompress-file-to-dir.tgz"), dstDir, CompressorOptions{})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(dstDir))
+		})
+	})
+
+	Describe("Reproducible", func() {
+		var otherDir string
+
+		BeforeEach(func() {
+			otherDir = GinkgoT().TempDir()
+			Expect(fs.CopyDir(testAssetsFixtureDir, otherDir)).To(Succeed())
+			Expect(os.Chmod(testAssetsFixtureDir, 0755)).To(Succeed())
+			Expect(os.Chmod(otherDir, 0755)).To(Succeed())
+
+			past := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+			Expect(os.Chtimes(filepath.Join(otherDir, "app.stdout.log"), past, past)).To(Succeed())
+			Expect(os.Chtimes(filepath.Join(otherDir, "some_directory"), past, past)).To(Succeed())
+		})
+
+		digestOf := func(path string) string {
+			digest, err := boshcrypto.NewMultipleDigestFromPath(path, fs, []boshcrypto.Algorithm{boshcrypto.DigestAlgorithmSHA256})
+			Expect(err).ToNot(HaveOccurred())
+			return digest.String()
+		}
+
+		It("creates identical tarballs from identical content", func() {
+			options := CompressorOptions{Reproducible: true}
+
+			firstPath, err := compressor.CompressFilesInDir(testAssetsFixtureDir, options)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(firstPath) //nolint:errcheck
+
+			secondPath, err := NewTarballCompressor(cmdRunner, fs).CompressFilesInDir(otherDir, options)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(secondPath) //nolint:errcheck
+
+			Expect(digestOf(firstPath)).To(Equal(digestOf(secondPath)))
+		})
+
+		It("sorts the given files", func() {
+			options := CompressorOptions{Reproducible: true}
+
+			firstPath, err := compressor.CompressSpecificFilesInDir(testAssetsFixtureDir, []string{"app.stdout.log", "app.stderr.log"}, options)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(firstPath) //nolint:errcheck
+
+			secondPath, err := compressor.CompressSpecificFilesInDir(otherDir, []string{"app.stderr.log", "app.stdout.log"}, options)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(secondPath) //nolint:errcheck
+
+			Expect(digestOf(firstPath)).To(Equal(digestOf(secondPath)))
+		})
+
+		It("zeroes ownership and uses SOURCE_DATE_EPOCH as modification time", func() {
+			GinkgoT().Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+			tgzName, err := compressor.CompressFilesInDir(otherDir, CompressorOptions{Reproducible: true})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(tgzName) //nolint:errcheck
+
+			tarballContents, _, _, err := cmdRunner.RunCommand("tar", "--numeric-owner", "--full-time", "--utc", "-tvzf", tgzName)
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, line := range strings.Split(strings.TrimSpace(tarballContents), "\n") {
+				Expect(line).To(MatchRegexp(`^\S+ 0/0 +\d+ 2023-11-14 22:13:20 `))
+			}
+		})
+
+		It("returns an error for an invalid SOURCE_DATE_EPOCH", func() {
+			GinkgoT().Setenv("SOURCE_DATE_EPOCH", "yesterday")
+
+			_, err := compressor.CompressFilesInDir(otherDir, CompressorOptions{Reproducible: true})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Parsing SOURCE_DATE_EPOCH 'yesterday'"))
+		})
+	})
+
+	Describe("CleanUp", func() {
+		It("removes tarball path", func() {
+			tgzName, err := compressor.CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(compressor.CleanUp(tgzName)).To(Succeed())
+			Expect(tgzName).ToNot(BeAnExistingFile())
+		})
+	})
+})
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package fileutil
+
+import (
+	"os"
+	"syscall"
+)
+
+type fileIdentity struct {
+	dev uint64
+	ino uint64
+}
+
+// hardLinkIdentity returns the device and inode of files with more than one link
+func hardLinkIdentity(info os.FileInfo) (fileIdentity, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return fileIdentity{}, false
+	}
+
+	return fileIdentity{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true //nolint:unconvert
+}
+
+// fileOwner returns the numeric owner and group of a file
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return int(stat.Uid), int(stat.Gid), true
+}
+
+func lchown(path string, uid, gid int) error {
+	return os.Lchown(path, uid, gid)
+}
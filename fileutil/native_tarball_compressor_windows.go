@@ -0,0 +1,22 @@
+package fileutil
+
+import (
+	"os"
+)
+
+type fileIdentity struct{}
+
+// hardLinkIdentity does not detect hard links on Windows, so they are archived as regular files
+func hardLinkIdentity(info os.FileInfo) (fileIdentity, bool) {
+	return fileIdentity{}, false
+}
+
+// fileOwner reports no owner on Windows, which has no numeric owners
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
+
+// lchown is a no-op on Windows, which has no numeric owners to restore
+func lchown(path string, uid, gid int) error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package fileutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/cloudfoundry/bosh-utils/fileutil"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+const benchmarkTarballSize = 64 << 20
+
+// Compare with:
+//
+//	go test ./fileutil -run '^$' -bench BenchmarkTarballCompressor -benchtime 5x
+func BenchmarkTarballCompressorTarGzip(b *testing.B) {
+	benchmarkTarballCompressor(b, fileutil.CompressorOptions{})
+}
+
+func BenchmarkTarballCompressorParallelGzip(b *testing.B) {
+	benchmarkTarballCompressor(b, fileutil.CompressorOptions{Concurrency: runtime.NumCPU()})
+}
+
+func BenchmarkTarballCompressorParallelGzipSmallBlocks(b *testing.B) {
+	benchmarkTarballCompressor(b, fileutil.CompressorOptions{Concurrency: runtime.NumCPU(), BlockSize: 128 << 10})
+}
+
+func benchmarkTarballCompressor(b *testing.B, options fileutil.CompressorOptions) {
+	logger := boshlog.NewLogger(boshlog.LevelNone)
+	fs := boshsys.NewOsFileSystem(logger)
+	compressor := fileutil.NewTarballCompressor(boshsys.NewExecCmdRunner(logger), fs)
+
+	sourceDir := b.TempDir()
+	err := os.WriteFile(filepath.Join(sourceDir, "package.log"), compressibleContent(benchmarkTarballSize), 0644)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(benchmarkTarballSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tarballPath, err := compressor.CompressFilesInDir(sourceDir, options)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.StopTimer()
+		_ = compressor.CleanUp(tarballPath) //nolint:errcheck
+		b.StartTimer()
+	}
+}
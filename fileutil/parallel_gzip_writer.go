@@ -0,0 +1,254 @@
+package fileutil
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+const (
+	defaultParallelGzipBlockSize = 1 << 20
+
+	// parallelGzipDictSize is the deflate window, the most of the previous
+	// block that can be referred to when compressing the next one
+	parallelGzipDictSize = 32 << 10
+)
+
+// parallelGzipWriter compresses blocks of its input concurrently and writes
+// them out in order as a single gzip member, so that the result can be read
+// by any gzip implementation. Every block but the last ends with a sync flush
+// and is compressed with the end of the previous block as its dictionary,
+// which keeps the ratio close to that of a single-threaded writer.
+type parallelGzipWriter struct {
+	w         io.Writer
+	level     int
+	blockSize int
+
+	block []byte
+	dict  []byte
+
+	crc  uint32
+	size uint32
+
+	// results holds one channel per dispatched block in input order. Along
+	// with the block writeBlocks waits for, its capacity limits how many
+	// blocks are compressed at a time.
+	results chan chan compressedBlock
+	done    chan struct{}
+	closed  bool
+
+	errLock sync.Mutex
+	err     error
+}
+
+type compressedBlock struct {
+	data []byte
+	err  error
+}
+
+func newParallelGzipWriter(w io.Writer, level, blockSize, concurrency int) (io.WriteCloser, error) {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	_, err := flate.NewWriter(io.Discard, level)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Invalid compression level %d for %s", level, CompressionFormatGzip)
+	}
+
+	if blockSize < 0 {
+		return nil, bosherr.Errorf("Invalid block size %d", blockSize)
+	}
+	if blockSize == 0 {
+		blockSize = defaultParallelGzipBlockSize
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	gw := &parallelGzipWriter{
+		w:         w,
+		level:     level,
+		blockSize: blockSize,
+		block:     make([]byte, 0, blockSize),
+		results:   make(chan chan compressedBlock, concurrency-1),
+		done:      make(chan struct{}),
+	}
+
+	go gw.writeBlocks()
+
+	return gw, nil
+}
+
+func (w *parallelGzipWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, bosherr.Error("Writing to closed gzip writer")
+	}
+
+	err := w.loadErr()
+	if err != nil {
+		return 0, err
+	}
+
+	w.crc = crc32.Update(w.crc, crc32.IEEETable, p)
+	w.size += uint32(len(p))
+
+	written := len(p)
+
+	for len(p) > 0 {
+		n := copy(w.block[len(w.block):cap(w.block)], p)
+		w.block = w.block[:len(w.block)+n]
+		p = p[n:]
+
+		if len(w.block) == w.blockSize {
+			w.dispatch(false)
+		}
+	}
+
+	return written, nil
+}
+
+// Close writes the last block and the gzip trailer. It does not close the underlying writer.
+func (w *parallelGzipWriter) Close() error {
+	if w.closed {
+		return w.loadErr()
+	}
+	w.closed = true
+
+	w.dispatch(true)
+	close(w.results)
+	<-w.done
+
+	err := w.loadErr()
+	if err != nil {
+		return err
+	}
+
+	trailer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(trailer[:4], w.crc)
+	binary.LittleEndian.PutUint32(trailer[4:], w.size)
+
+	_, err = w.w.Write(trailer)
+	if err != nil {
+		return bosherr.WrapError(err, "Writing gzip trailer")
+	}
+
+	return nil
+}
+
+func (w *parallelGzipWriter) dispatch(final bool) {
+	block, dict := w.block, w.dict
+
+	result := make(chan compressedBlock, 1)
+	w.results <- result
+
+	go func() {
+		data, err := compressGzipBlock(block, dict, w.level, final)
+		result <- compressedBlock{data: data, err: err}
+	}()
+
+	if len(block) > parallelGzipDictSize {
+		w.dict = block[len(block)-parallelGzipDictSize:]
+	} else {
+		// A new slice, since the previous dictionary may still be in use
+		nextDict := append(append(make([]byte, 0, len(dict)+len(block)), dict...), block...)
+		if len(nextDict) > parallelGzipDictSize {
+			nextDict = nextDict[len(nextDict)-parallelGzipDictSize:]
+		}
+		w.dict = nextDict
+	}
+
+	w.block = make([]byte, 0, w.blockSize)
+}
+
+// writeBlocks writes the header and then every compressed block in order,
+// consuming all results even after an error so that dispatch never blocks
+func (w *parallelGzipWriter) writeBlocks() {
+	defer close(w.done)
+
+	err := w.writeHeader()
+	if err != nil {
+		w.storeErr(bosherr.WrapError(err, "Writing gzip header"))
+	}
+
+	for result := range w.results {
+		block := <-result
+
+		if w.loadErr() != nil {
+			continue
+		}
+
+		if block.err != nil {
+			w.storeErr(bosherr.WrapError(block.err, "Compressing block"))
+			continue
+		}
+
+		_, err := w.w.Write(block.data)
+		if err != nil {
+			w.storeErr(bosherr.WrapError(err, "Writing compressed block"))
+		}
+	}
+}
+
+func (w *parallelGzipWriter) writeHeader() error {
+	// Same header as compress/gzip writes without a name, comment or modification time
+	header := []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255}
+
+	switch w.level {
+	case gzip.BestCompression:
+		header[8] = 2
+	case gzip.BestSpeed:
+		header[8] = 4
+	}
+
+	_, err := w.w.Write(header)
+	return err
+}
+
+func (w *parallelGzipWriter) loadErr() error {
+	w.errLock.Lock()
+	defer w.errLock.Unlock()
+
+	return w.err
+}
+
+func (w *parallelGzipWriter) storeErr(err error) {
+	w.errLock.Lock()
+	defer w.errLock.Unlock()
+
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func compressGzipBlock(block, dict []byte, level int, final bool) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	flateWriter, err := flate.NewWriterDict(&buffer, level, dict)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = flateWriter.Write(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if final {
+		err = flateWriter.Close()
+	} else {
+		err = flateWriter.Flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
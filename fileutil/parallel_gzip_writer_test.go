@@ -0,0 +1,131 @@
+package fileutil_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/bosh-utils/fileutil"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// compressibleContent returns size bytes of random words, which compress
+// roughly as well as logs and source code do
+func compressibleContent(size int) []byte {
+	words := []string{"bosh ", "director ", "compile ", "package ", "job ", "release ", "stemcell ", "\n"}
+	random := rand.New(rand.NewSource(int64(size)))
+
+	var content bytes.Buffer
+	for content.Len() < size {
+		content.WriteString(words[random.Intn(len(words))])
+	}
+
+	return content.Bytes()[:size]
+}
+
+func writeCompressibleFile(path string, size int) []byte {
+	content := compressibleContent(size)
+	Expect(os.WriteFile(path, content, 0644)).To(Succeed())
+	return content
+}
+
+var _ = Describe("parallel gzip compression", func() {
+	var (
+		fs        boshsys.FileSystem
+		sourceDir string
+		content   []byte
+	)
+
+	BeforeEach(func() {
+		fs = boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+		sourceDir = GinkgoT().TempDir()
+		content = writeCompressibleFile(filepath.Join(sourceDir, "large.log"), 300*1024+17)
+	})
+
+	compressors := map[string]func() Compressor{
+		"native": func() Compressor { return NewNativeTarballCompressor(fs, boshlog.NewLogger(boshlog.LevelNone)) },
+		"tar": func() Compressor {
+			return NewTarballCompressor(boshsys.NewExecCmdRunner(boshlog.NewLogger(boshlog.LevelNone)), fs)
+		},
+	}
+
+	for compressorName, newCompressor := range compressors {
+		Context("with the "+compressorName+" compressor", func() {
+			for _, blockSize := range []int{0, 4096, 50000} {
+				It("writes a standard gzip stream with blocks of "+sizeName(blockSize), func() {
+					tarballPath, err := newCompressor().CompressFilesInDir(sourceDir, CompressorOptions{Concurrency: 4, BlockSize: blockSize})
+					Expect(err).ToNot(HaveOccurred())
+					defer os.Remove(tarballPath) //nolint:errcheck
+
+					header, err := fs.ReadFile(tarballPath)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(header[:2]).To(Equal([]byte{0x1f, 0x8b}))
+
+					extracted, err := newCompressor().ReadEntry(tarballPath, "large.log")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(extracted).To(Equal(content))
+				})
+			}
+		})
+	}
+
+	It("can be read by the gzip command", func() {
+		if _, err := exec.LookPath("gzip"); err != nil {
+			Skip("gzip is not installed")
+		}
+
+		tarballPath, err := NewNativeTarballCompressor(fs, boshlog.NewLogger(boshlog.LevelNone)).CompressFilesInDir(sourceDir, CompressorOptions{Concurrency: 3, BlockSize: 8192, CompressionLevel: 9})
+		Expect(err).ToNot(HaveOccurred())
+		defer os.Remove(tarballPath) //nolint:errcheck
+
+		output, err := exec.Command("gzip", "-t", tarballPath).CombinedOutput()
+		Expect(err).ToNot(HaveOccurred(), string(output))
+	})
+
+	It("compresses about as well as a single-threaded writer", func() {
+		var single, parallel bytes.Buffer
+		compressor := NewNativeTarballCompressor(fs, boshlog.NewLogger(boshlog.LevelNone))
+
+		Expect(compressor.CompressFilesInDirToWriter(sourceDir, &single, CompressorOptions{})).To(Succeed())
+		Expect(compressor.CompressFilesInDirToWriter(sourceDir, &parallel, CompressorOptions{Concurrency: 4, BlockSize: 64 * 1024})).To(Succeed())
+
+		Expect(parallel.Len()).To(BeNumerically("<", single.Len()*11/10))
+
+		gzipReader, err := gzip.NewReader(&parallel)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = io.Copy(io.Discard, gzipReader)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("returns an error for invalid options", func() {
+		compressor := NewNativeTarballCompressor(fs, boshlog.NewLogger(boshlog.LevelNone))
+
+		err := compressor.CompressFilesInDirToWriter(sourceDir, io.Discard, CompressorOptions{Concurrency: 2, BlockSize: -1})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Invalid block size -1"))
+
+		err = compressor.CompressFilesInDirToWriter(sourceDir, io.Discard, CompressorOptions{Concurrency: -1})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Invalid concurrency -1"))
+
+		err = compressor.CompressFilesInDirToWriter(sourceDir, io.Discard, CompressorOptions{Concurrency: 2, CompressionLevel: 10})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Invalid compression level 10 for gzip"))
+	})
+})
+
+func sizeName(blockSize int) string {
+	if blockSize == 0 {
+		return "the default size"
+	}
+	return strconv.Itoa(blockSize) + " bytes"
+}
@@ -0,0 +1,219 @@
+package fileutil_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/bosh-utils/fileutil"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+type testTarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	content  string
+}
+
+func writeTestTarball(path string, entries []testTarEntry) {
+	f, err := os.Create(path)
+	Expect(err).ToNot(HaveOccurred())
+	defer f.Close() //nolint:errcheck
+
+	gzipWriter := gzip.NewWriter(f)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.typeflag,
+			Linkname: entry.linkname,
+			Size:     int64(len(entry.content)),
+			Mode:     0644,
+		}
+		if entry.typeflag == tar.TypeDir {
+			header.Mode = 0755
+		}
+		if entry.typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+
+		Expect(tarWriter.WriteHeader(header)).To(Succeed())
+		if header.Size > 0 {
+			_, err = tarWriter.Write([]byte(entry.content))
+			Expect(err).ToNot(HaveOccurred())
+		}
+	}
+
+	Expect(tarWriter.Close()).To(Succeed())
+	Expect(gzipWriter.Close()).To(Succeed())
+}
+
+var _ = Describe("safe extraction", func() {
+	var (
+		fs          boshsys.FileSystem
+		dstDir      string
+		outsideDir  string
+		tarballPath string
+	)
+
+	BeforeEach(func() {
+		if runtime.GOOS == "windows" {
+			Skip("Extraction safety is exercised with POSIX paths and symlinks")
+		}
+
+		fs = boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+
+		var err error
+		dstDir, err = filepath.EvalSymlinks(GinkgoT().TempDir())
+		Expect(err).ToNot(HaveOccurred())
+		outsideDir = GinkgoT().TempDir()
+		tarballPath = filepath.Join(GinkgoT().TempDir(), "archive.tgz")
+	})
+
+	compressors := map[string]func() Compressor{
+		"native": func() Compressor { return NewNativeTarballCompressor(fs, boshlog.NewLogger(boshlog.LevelNone)) },
+		"tar": func() Compressor {
+			return NewTarballCompressor(boshsys.NewExecCmdRunner(boshlog.NewLogger(boshlog.LevelNone)), fs)
+		},
+	}
+
+	for compressorName, newCompressor := range compressors {
+		Context("with the "+compressorName+" compressor", func() {
+			DescribeTable("rejects unsafe entries and names them",
+				func(entries func() []testTarEntry, options CompressorOptions, expectedErr string) {
+					writeTestTarball(tarballPath, entries())
+
+					err := newCompressor().DecompressFileToDir(tarballPath, dstDir, options)
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring(expectedErr))
+
+					outsideEntries, err := os.ReadDir(outsideDir)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(outsideEntries).To(BeEmpty())
+				},
+				Entry("parent directory references",
+					func() []testTarEntry {
+						return []testTarEntry{{name: "./ok", typeflag: tar.TypeReg}, {name: "dir/../../evil", typeflag: tar.TypeReg, content: "evil"}}
+					},
+					CompressorOptions{},
+					"Validating 'dir/../../evil': Path escapes the destination directory",
+				),
+				Entry("absolute paths",
+					func() []testTarEntry {
+						return []testTarEntry{{name: "/etc/evil", typeflag: tar.TypeReg, content: "evil"}}
+					},
+					CompressorOptions{},
+					"Validating '/etc/evil': Absolute paths are not allowed",
+				),
+				Entry("writes through a symlink pointing outside",
+					func() []testTarEntry {
+						return []testTarEntry{
+							{name: "escape", typeflag: tar.TypeSymlink, linkname: outsideDir},
+							{name: "escape/evil", typeflag: tar.TypeReg, content: "evil"},
+						}
+					},
+					CompressorOptions{},
+					"Validating 'escape/evil': Path traverses symlink 'escape' pointing outside of the archive",
+				),
+				Entry("hard links to files outside",
+					func() []testTarEntry {
+						return []testTarEntry{{name: "evil", typeflag: tar.TypeLink, linkname: "../../etc/passwd"}}
+					},
+					CompressorOptions{},
+					"Validating 'evil': Hard link target '../../etc/passwd': Path escapes the destination directory",
+				),
+				Entry("more entries than allowed",
+					func() []testTarEntry {
+						return []testTarEntry{{name: "a", typeflag: tar.TypeReg}, {name: "b", typeflag: tar.TypeReg}, {name: "c", typeflag: tar.TypeReg}}
+					},
+					CompressorOptions{MaxEntries: 2},
+					"Validating 'c': Archive has more than 2 entries",
+				),
+				Entry("files larger than allowed",
+					func() []testTarEntry {
+						return []testTarEntry{{name: "small", typeflag: tar.TypeReg, content: "abc"}, {name: "big", typeflag: tar.TypeReg, content: "0123456789"}}
+					},
+					CompressorOptions{MaxFileSize: 5},
+					"Validating 'big': Size 10 exceeds maximum file size of 5",
+				),
+				Entry("more total bytes than allowed",
+					func() []testTarEntry {
+						return []testTarEntry{{name: "a", typeflag: tar.TypeReg, content: "0123"}, {name: "b", typeflag: tar.TypeReg, content: "4567"}}
+					},
+					CompressorOptions{MaxTotalSize: 6},
+					"Validating 'b': Archive exceeds maximum total size of 6",
+				),
+			)
+
+			It("rejects entries that escape once leading components are stripped", func() {
+				baseDir := GinkgoT().TempDir()
+				dstDir = filepath.Join(baseDir, "dst")
+				outsideDir = filepath.Join(baseDir, "outside")
+				Expect(os.Mkdir(dstDir, 0755)).To(Succeed())
+				Expect(os.Mkdir(outsideDir, 0755)).To(Succeed())
+
+				// Within the archive until "top" is stripped from it
+				writeTestTarball(tarballPath, []testTarEntry{
+					{name: "top/link", typeflag: tar.TypeSymlink, linkname: "../outside"},
+					{name: "top/link/evil", typeflag: tar.TypeReg, content: "evil"},
+				})
+
+				err := newCompressor().DecompressFileToDir(tarballPath, dstDir, CompressorOptions{StripComponents: 1})
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("'top/link/evil'"))
+
+				Expect(filepath.Join(outsideDir, "evil")).ToNot(BeAnExistingFile())
+			})
+
+			It("extracts archives within the limits", func() {
+				writeTestTarball(tarballPath, []testTarEntry{
+					{name: "./", typeflag: tar.TypeDir},
+					{name: "./dir/", typeflag: tar.TypeDir},
+					{name: "./dir/file", typeflag: tar.TypeReg, content: "content"},
+					{name: "./link", typeflag: tar.TypeSymlink, linkname: "dir/file"},
+				})
+
+				err := newCompressor().DecompressFileToDir(tarballPath, dstDir, CompressorOptions{MaxEntries: 4, MaxFileSize: 7, MaxTotalSize: 7})
+				Expect(err).ToNot(HaveOccurred())
+
+				content, err := fs.ReadFileString(filepath.Join(dstDir, "link"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(content).To(Equal("content"))
+			})
+		})
+	}
+
+	It("refuses to write through symlinks already present in the destination", func() {
+		Expect(os.Symlink(outsideDir, filepath.Join(dstDir, "escape"))).To(Succeed())
+		writeTestTarball(tarballPath, []testTarEntry{{name: "escape/evil", typeflag: tar.TypeReg, content: "evil"}})
+
+		err := NewNativeTarballCompressor(fs, boshlog.NewLogger(boshlog.LevelNone)).DecompressFileToDir(tarballPath, dstDir, CompressorOptions{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(HavePrefix("Extracting 'escape/evil': Path resolves to '"))
+		Expect(err.Error()).To(ContainSubstring("outside of the destination directory"))
+
+		Expect(filepath.Join(outsideDir, "evil")).ToNot(BeAnExistingFile())
+	})
+
+	It("refuses to have tar write through symlinks already present in the destination", func() {
+		Expect(os.Symlink(outsideDir, filepath.Join(dstDir, "escape"))).To(Succeed())
+		writeTestTarball(tarballPath, []testTarEntry{{name: "escape/evil", typeflag: tar.TypeReg, content: "evil"}})
+
+		compressor := NewTarballCompressor(boshsys.NewExecCmdRunner(boshlog.NewLogger(boshlog.LevelNone)), fs)
+
+		err := compressor.DecompressFileToDir(tarballPath, dstDir, CompressorOptions{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(HavePrefix("Validating 'escape/evil': Path resolves to '"))
+		Expect(err.Error()).To(ContainSubstring("outside of the destination directory"))
+
+		Expect(filepath.Join(outsideDir, "evil")).ToNot(BeAnExistingFile())
+	})
+})
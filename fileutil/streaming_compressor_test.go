@@ -0,0 +1,84 @@
+package fileutil_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/bosh-utils/fileutil"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("fake-write-err") }
+
+var _ = Describe("streaming compression", func() {
+	var (
+		fs     boshsys.FileSystem
+		dstDir string
+	)
+
+	BeforeEach(func() {
+		fs = boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+		dstDir = GinkgoT().TempDir()
+	})
+
+	compressors := map[string]func() Compressor{
+		"native": func() Compressor { return NewNativeTarballCompressor(fs, boshlog.NewLogger(boshlog.LevelNone)) },
+		"tar": func() Compressor {
+			return NewTarballCompressor(boshsys.NewExecCmdRunner(boshlog.NewLogger(boshlog.LevelNone)), fs)
+		},
+	}
+
+	for compressorName, newCompressor := range compressors {
+		Context("with the "+compressorName+" compressor", func() {
+			It("pipes a tarball from a directory straight into another directory", func() {
+				compressor := newCompressor()
+				options := CompressorOptions{CompressionFormat: CompressionFormatXz}
+
+				pipeReader, pipeWriter := io.Pipe()
+				go func() {
+					defer GinkgoRecover()
+					pipeWriter.CloseWithError(compressor.CompressFilesInDirToWriter(testAssetsFixtureDir, pipeWriter, options)) //nolint:errcheck
+				}()
+
+				Expect(compressor.DecompressReaderToDir(pipeReader, dstDir, options)).To(Succeed())
+
+				content, err := fs.ReadFileString(filepath.Join(dstDir, "other_logs", "more_logs", "more.stdout.log"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(content).To(ContainSubstring("this is more stdout"))
+			})
+
+			It("writes only the given files", func() {
+				compressor := newCompressor()
+
+				var buffer bytes.Buffer
+				err := compressor.CompressSpecificFilesInDirToWriter(testAssetsFixtureDir, []string{"app.stdout.log"}, &buffer, CompressorOptions{})
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(compressor.DecompressReaderToDir(&buffer, dstDir, CompressorOptions{})).To(Succeed())
+
+				entries, err := fs.Glob(filepath.Join(dstDir, "*"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(entries).To(Equal([]string{filepath.Join(dstDir, "app.stdout.log")}))
+			})
+
+			It("returns an error if the writer fails", func() {
+				err := newCompressor().CompressFilesInDirToWriter(testAssetsFixtureDir, failingWriter{}, CompressorOptions{})
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("returns an error if the stream is not a tarball", func() {
+				err := newCompressor().DecompressReaderToDir(bytes.NewBufferString("not a tarball"), dstDir, CompressorOptions{})
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Reading tarball"))
+			})
+		})
+	}
+})
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package fileutil
+
+import (
+	"os"
+
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// syncDir makes the renames of entries of dir durable
+func syncDir(fs boshsys.FileSystem, dir string) error {
+	file, err := fs.OpenFile(dir, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close() //nolint:errcheck
+
+	if syncer, ok := file.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+
+	return nil
+}
@@ -0,0 +1,10 @@
+package fileutil
+
+import (
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// syncDir does nothing since directories cannot be synced on Windows
+func syncDir(fs boshsys.FileSystem, dir string) error {
+	return nil
+}
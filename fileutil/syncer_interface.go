@@ -0,0 +1,34 @@
+package fileutil
+
+import (
+	boshcrypto "github.com/cloudfoundry/bosh-utils/crypto"
+)
+
+type SyncOptions struct {
+	// ChecksumAlgorithm compares files of the same size by digest rather than
+	// by modification time when set
+	ChecksumAlgorithm boshcrypto.Algorithm
+
+	// Delete removes files from the destination that are not in the source
+	Delete bool
+
+	// DryRun reports the changes a sync would make without making them
+	DryRun bool
+}
+
+// SyncReport lists the paths relative to the synced directories that were
+// added to, updated in or removed from the destination, in lexical order
+type SyncReport struct {
+	Added   []string
+	Updated []string
+	Removed []string
+}
+
+func (r SyncReport) Changed() bool {
+	return len(r.Added) > 0 || len(r.Updated) > 0 || len(r.Removed) > 0
+}
+
+type Syncer interface {
+	// Sync makes dstDir a copy of srcDir, only copying the files that differ
+	Sync(srcDir string, dstDir string, options SyncOptions) (SyncReport, error)
+}
@@ -1,24 +1,18 @@
 package fileutil
 
 import (
-	"bytes"
+	"archive/tar"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 
 	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
 	boshsys "github.com/cloudfoundry/bosh-utils/system"
 )
 
-var (
-	gzipMagic   = []byte{0x1f, 0x8b}
-	bzip2Magic  = []byte{0x42, 0x5a, 0x68} // "BZh"
-	xzMagic     = []byte{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00}
-	zstdMagic   = []byte{0x28, 0xb5, 0x2f, 0xfd}
-	ustarMagic  = []byte("ustar")
-	ustarOffset = 257 // Offset of the TAR magic string in the file
-)
-
 type tarballCompressor struct {
 	cmdRunner boshsys.CmdRunner
 	fs        boshsys.FileSystem
@@ -31,11 +25,23 @@ func NewTarballCompressor(
 	return tarballCompressor{cmdRunner: cmdRunner, fs: fs}
 }
 
+// native returns the compressor used where tar cannot be relied on. Sockets it
+// skips are not logged, since tarballCompressor is created without a logger.
+func (c tarballCompressor) native() Compressor {
+	return NewNativeTarballCompressor(c.fs, boshlog.NewLogger(boshlog.LevelNone))
+}
+
 func (c tarballCompressor) CompressFilesInDir(dir string, options CompressorOptions) (string, error) {
 	return c.CompressSpecificFilesInDir(dir, []string{"."}, options)
 }
 
 func (c tarballCompressor) CompressSpecificFilesInDir(dir string, files []string, options CompressorOptions) (string, error) {
+	// GNU and BSD tar neither produce the same bytes nor support the same
+	// normalisation flags, so reproducible tarballs are always written natively
+	if options.Reproducible {
+		return c.native().CompressSpecificFilesInDir(dir, files, options)
+	}
+
 	tarball, err := c.fs.TempFile("bosh-platform-disk-TarballCompressor-CompressSpecificFilesInDir")
 	if err != nil {
 		return "", bosherr.WrapError(err, "Creating temporary file for tarball")
@@ -45,8 +51,70 @@ func (c tarballCompressor) CompressSpecificFilesInDir(dir string, files []string
 
 	tarballPath := tarball.Name()
 
+	format := options.compressionFormat()
+
+	// tar is only asked to gzip single-threaded at the default level, every other format and level
+	// is compressed in process so that no xz, zstd or bzip2 binaries are needed
+	if format == CompressionFormatNone || (format == CompressionFormatGzip && options.CompressionLevel == 0 && options.Concurrency <= 1) {
+		err = c.runTar(tarballPath, dir, files, format == CompressionFormatGzip)
+		if err != nil {
+			_ = c.fs.RemoveAll(tarballPath) //nolint:errcheck
+			return "", err
+		}
+
+		return tarballPath, nil
+	}
+
+	err = c.CompressSpecificFilesInDirToWriter(dir, files, tarball, options)
+	if err != nil {
+		_ = c.fs.RemoveAll(tarballPath) //nolint:errcheck
+		return "", err
+	}
+
+	return tarballPath, nil
+}
+
+func (c tarballCompressor) CompressFilesInDirToWriter(dir string, w io.Writer, options CompressorOptions) error {
+	return c.CompressSpecificFilesInDirToWriter(dir, []string{"."}, w, options)
+}
+
+// CompressSpecificFilesInDirToWriter has tar write an uncompressed tarball to
+// its stdout, which is compressed in process on its way to w
+func (c tarballCompressor) CompressSpecificFilesInDirToWriter(dir string, files []string, w io.Writer, options CompressorOptions) error {
+	if options.Reproducible {
+		return c.native().CompressSpecificFilesInDirToWriter(dir, files, w, options)
+	}
+
+	format := options.compressionFormat()
+
+	compressor, err := compressingWriter(w, options)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-cf", "-", "-C", dir}
+	if runtime.GOOS == "darwin" {
+		args = append([]string{"--no-mac-metadata"}, args...)
+	}
+
+	args = append(args, files...)
+
+	_, _, _, err = c.cmdRunner.RunComplexCommand(boshsys.Command{Name: "tar", Args: args, Stdout: compressor})
+	if err != nil {
+		return bosherr.WrapError(err, "Shelling out to tar")
+	}
+
+	err = compressor.Close()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Compressing tarball with %s", format)
+	}
+
+	return nil
+}
+
+func (c tarballCompressor) runTar(tarballPath, dir string, files []string, gzip bool) error {
 	args := []string{"-cf", tarballPath, "-C", dir}
-	if !options.NoCompression {
+	if gzip {
 		args = append(args, "-z")
 	}
 	if runtime.GOOS == "darwin" {
@@ -55,12 +123,18 @@ func (c tarballCompressor) CompressSpecificFilesInDir(dir string, files []string
 
 	args = append(args, files...)
 
-	_, _, _, err = c.cmdRunner.RunCommand("tar", args...)
+	_, _, _, err := c.cmdRunner.RunCommand("tar", args...)
 	if err != nil {
-		return "", bosherr.WrapError(err, "Shelling out to tar")
+		return bosherr.WrapError(err, "Shelling out to tar")
 	}
 
-	return tarballPath, nil
+	return nil
+}
+
+// DecompressReaderToDir extracts natively, since unlike a file on disk
+// a stream cannot be validated before tar starts writing entries
+func (c tarballCompressor) DecompressReaderToDir(r io.Reader, dir string, options CompressorOptions) error {
+	return c.native().DecompressReaderToDir(r, dir, options)
 }
 
 func (c tarballCompressor) DecompressFileToDir(tarballPath string, dir string, options CompressorOptions) error {
@@ -73,7 +147,23 @@ func (c tarballCompressor) DecompressFileToDir(tarballPath string, dir string, o
 	if err != nil {
 		return bosherr.WrapError(err, "Resolving tarball path")
 	}
-	args := []string{sameOwnerOption, "-xf", resolvedTarballPath, "-C", dir}
+
+	err = c.validateTarball(resolvedTarballPath, dir, options)
+	if err != nil {
+		return err
+	}
+
+	format, err := detectCompressionFormat(c.fs, resolvedTarballPath)
+	if err != nil {
+		return err
+	}
+
+	tarballArg := resolvedTarballPath
+	if format != CompressionFormatNone && format != CompressionFormatGzip {
+		tarballArg = "-"
+	}
+
+	args := []string{sameOwnerOption, "-xf", tarballArg, "-C", dir}
 	if options.StripComponents != 0 {
 		args = append(args, fmt.Sprintf("--strip-components=%d", options.StripComponents))
 	}
@@ -81,7 +171,30 @@ func (c tarballCompressor) DecompressFileToDir(tarballPath string, dir string, o
 	if options.PathInArchive != "" {
 		args = append(args, options.PathInArchive)
 	}
-	_, _, _, err = c.cmdRunner.RunCommand("tar", args...)
+
+	if tarballArg != "-" {
+		_, _, _, err = c.cmdRunner.RunCommand("tar", args...)
+		if err != nil {
+			return bosherr.WrapError(err, "Shelling out to tar")
+		}
+
+		return nil
+	}
+
+	// Decompress in process so that tar does not need the xz, zstd or bzip2 binaries
+	tarball, err := c.fs.OpenFile(resolvedTarballPath, os.O_RDONLY, 0)
+	if err != nil {
+		return bosherr.WrapError(err, "Opening tarball")
+	}
+	defer tarball.Close() //nolint:errcheck
+
+	r, err := decompressingReader(tarball)
+	if err != nil {
+		return err
+	}
+	defer r.Close() //nolint:errcheck
+
+	_, _, _, err = c.cmdRunner.RunComplexCommand(boshsys.Command{Name: "tar", Args: args, Stdin: r})
 	if err != nil {
 		return bosherr.WrapError(err, "Shelling out to tar")
 	}
@@ -89,37 +202,104 @@ func (c tarballCompressor) DecompressFileToDir(tarballPath string, dir string, o
 	return nil
 }
 
-func (c tarballCompressor) IsNonCompressedTarball(path string) bool {
-	f, err := c.fs.OpenFile(path, os.O_RDONLY, 0644)
+// validateTarball reads through the tarball before tar extracts it, since tar
+// itself neither enforces size limits nor refuses every unsafe entry. Entries
+// are validated again by the names tar extracts them to, which must not
+// resolve outside of dir through symlinks already present in it either.
+func (c tarballCompressor) validateTarball(tarballPath, dir string, options CompressorOptions) error {
+	tarball, err := c.fs.OpenFile(tarballPath, os.O_RDONLY, 0)
 	if err != nil {
-		// If we cannot open the file, we assume it is not compressed
-		return false
-	}
-	defer f.Close() //nolint:errcheck
-
-	// Read the first 512 bytes to check both compression headers and the TAR header.
-	// Ignore the error from reading a partial buffer, which is fine for short files.
-	buffer := make([]byte, 512)
-	_, _ = f.Read(buffer) //nolint:errcheck
-
-	// 1. Check for compression first.
-	if bytes.HasPrefix(buffer, gzipMagic) ||
-		bytes.HasPrefix(buffer, bzip2Magic) ||
-		bytes.HasPrefix(buffer, xzMagic) ||
-		bytes.HasPrefix(buffer, zstdMagic) {
-		return false
-	}
-
-	// 2. If NOT compressed, check for the TAR magic string at its specific offset.
-	// Ensure the buffer is long enough to contain the TAR header magic string.
-	if len(buffer) > ustarOffset+len(ustarMagic) {
-		magicBytes := buffer[ustarOffset : ustarOffset+len(ustarMagic)]
-		if bytes.Equal(magicBytes, ustarMagic) {
-			return true
+		return bosherr.WrapError(err, "Opening tarball")
+	}
+	defer tarball.Close() //nolint:errcheck
+
+	r, err := decompressingReader(tarball)
+	if err != nil {
+		return err
+	}
+	defer r.Close() //nolint:errcheck
+
+	tarReader := tar.NewReader(r)
+	validator := newArchiveEntryValidator(options)
+	extractedValidator := newArchiveEntryValidator(CompressorOptions{})
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return bosherr.WrapError(err, "Reading tarball")
+		}
+
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		err = validator.validate(header)
+		if err != nil {
+			return err
+		}
+
+		extracted, ok := extractedHeader(header, options)
+		if !ok {
+			continue
+		}
+
+		err = extractedValidator.validateEntry(extracted)
+		if err == nil {
+			err = checkWithinDir(dir, filepath.Join(dir, filepath.FromSlash(extracted.Name)))
+		}
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Validating '%s'", header.Name)
 		}
 	}
+}
+
+// extractedHeader returns the header with the names tar extracts it to once
+// PathInArchive and StripComponents are applied, or false if it is skipped
+func extractedHeader(header *tar.Header, options CompressorOptions) (*tar.Header, bool) {
+	if !inArchivePath(header.Name, options.PathInArchive) {
+		return nil, false
+	}
+
+	name, ok := stripComponents(header.Name, options.StripComponents)
+	if !ok {
+		return nil, false
+	}
+
+	extracted := *header
+	extracted.Name = name
+
+	// tar strips the targets of hard links as well
+	if header.Typeflag == tar.TypeLink {
+		linkname, ok := stripComponents(header.Linkname, options.StripComponents)
+		if ok {
+			extracted.Linkname = linkname
+		}
+	}
+
+	return &extracted, true
+}
+
+func (c tarballCompressor) ListEntries(tarballPath string) ([]ArchiveEntry, error) {
+	return listArchiveEntries(c.fs, tarballPath)
+}
+
+func (c tarballCompressor) OpenEntry(tarballPath string, name string) (io.ReadCloser, error) {
+	return openArchiveEntry(c.fs, tarballPath, name)
+}
+
+func (c tarballCompressor) ReadEntry(tarballPath string, name string) ([]byte, error) {
+	return readArchiveEntry(c.fs, tarballPath, name)
+}
+
+func (c tarballCompressor) IsNonCompressedTarball(path string) bool {
+	return isNonCompressedTarball(c.fs, path)
+}
 
-	return false
+func (c tarballCompressor) DetectCompressionFormat(path string) (CompressionFormat, error) {
+	return detectCompressionFormat(c.fs, path)
 }
 
 func (c tarballCompressor) CleanUp(tarballPath string) error {
@@ -21,6 +21,21 @@ func beDir() assert.BeDir {
 	return assert.BeDir{}
 }
 
+// tempFileRecordingFileSystem records the paths of the temp files it creates
+type tempFileRecordingFileSystem struct {
+	boshsys.FileSystem
+
+	tempFiles []string
+}
+
+func (fs *tempFileRecordingFileSystem) TempFile(prefix string) (boshsys.File, error) {
+	file, err := fs.FileSystem.TempFile(prefix)
+	if err == nil {
+		fs.tempFiles = append(fs.tempFiles, file.Name())
+	}
+	return file, err
+}
+
 var _ = Describe("tarballCompressor", func() {
 	var (
 		dstDir        string
@@ -163,6 +178,24 @@ var _ = Describe("tarballCompressor", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(content).To(ContainSubstring("this is a .keep file"))
 		})
+
+		for name, options := range map[string]CompressorOptions{
+			"by tar":     {},
+			"in process": {CompressionFormat: CompressionFormatXz},
+		} {
+			options := options
+
+			It("removes the tarball when compressing "+name+" fails", func() {
+				recordingFs := &tempFileRecordingFileSystem{FileSystem: fs}
+				compressor := NewTarballCompressor(cmdRunner, recordingFs)
+
+				_, err := compressor.CompressSpecificFilesInDir(testAssetsFixtureDir, []string{"missing"}, options)
+				Expect(err).To(HaveOccurred())
+
+				Expect(recordingFs.tempFiles).To(HaveLen(1))
+				Expect(recordingFs.tempFiles[0]).ToNot(BeAnExistingFile())
+			})
+		}
 	})
 
 	Describe("DecompressFileToDir", func() {
@@ -0,0 +1,259 @@
+package fileutil
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+
+	boshcrypto "github.com/cloudfoundry/bosh-utils/crypto"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+type MoveProgress struct {
+	// Path is the source file being copied
+	Path string
+
+	// CopiedBytes and TotalBytes count the content of every file being moved
+	CopiedBytes int64
+	TotalBytes  int64
+}
+
+type VerifiedMoverOptions struct {
+	// DigestAlgorithms additionally verify copies by their MultipleDigest
+	DigestAlgorithms []boshcrypto.Algorithm
+
+	// Progress is called as content is copied across file systems
+	Progress func(MoveProgress)
+}
+
+// verifiedFileMover renames files and directories, and moves them across
+// file systems by copying them to a temporary sibling of the destination,
+// verifying the copy and renaming it into place before removing the source,
+// so that neither a failure nor a crash leaves a partial destination behind
+type verifiedFileMover struct {
+	fs      boshsys.FileSystem
+	options VerifiedMoverOptions
+}
+
+func NewVerifiedFileMover(fs boshsys.FileSystem, options VerifiedMoverOptions) Mover {
+	return verifiedFileMover{fs: fs, options: options}
+}
+
+func (m verifiedFileMover) Move(oldPath, newPath string) error {
+	err := m.fs.Rename(oldPath, newPath)
+	if !isCrossDeviceError(err) {
+		return err
+	}
+
+	tempPath, err := tempSiblingPath(newPath)
+	if err != nil {
+		return err
+	}
+
+	err = m.copyVerified(oldPath, tempPath)
+	if err != nil {
+		_ = m.fs.RemoveAll(tempPath) //nolint:errcheck
+		return bosherr.WrapErrorf(err, "Copying '%s' to '%s'", oldPath, newPath)
+	}
+
+	err = m.fs.Rename(tempPath, newPath)
+	if err != nil {
+		_ = m.fs.RemoveAll(tempPath) //nolint:errcheck
+		return bosherr.WrapErrorf(err, "Renaming '%s' to '%s'", tempPath, newPath)
+	}
+
+	// Make sure the rename is on disk before the source is removed
+	err = syncDir(m.fs, filepath.Dir(newPath))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Syncing directory of '%s'", newPath)
+	}
+
+	err = m.fs.RemoveAll(oldPath)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Removing '%s'", oldPath)
+	}
+
+	return nil
+}
+
+// tempSiblingPath returns a hidden path in the directory of path
+// that can be renamed to path without crossing file systems
+func tempSiblingPath(path string) (string, error) {
+	suffix := make([]byte, 8)
+
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return "", bosherr.WrapError(err, "Generating temporary file name")
+	}
+
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+"-"+hex.EncodeToString(suffix)), nil
+}
+
+func (m verifiedFileMover) copyVerified(src, dst string) error {
+	var totalBytes int64
+
+	err := m.fs.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			totalBytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Walking '%s'", src)
+	}
+
+	progress := &moveProgressReporter{report: m.options.Progress, progress: MoveProgress{TotalBytes: totalBytes}}
+
+	// Directories are created accessible only to the owner and get the mode
+	// of the source once their contents are copied, since the mode of the
+	// source may not allow adding their contents
+	type copiedDir struct {
+		path string
+		mode os.FileMode
+	}
+
+	var dirs []copiedDir
+
+	err = m.fs.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Walking '%s'", path)
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Determining path of '%s'", path)
+		}
+
+		target := filepath.Join(dst, relPath)
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			linkTarget, err := m.fs.Readlink(path)
+			if err != nil {
+				return bosherr.WrapErrorf(err, "Reading symlink '%s'", path)
+			}
+
+			return m.fs.Symlink(linkTarget, target)
+
+		case info.IsDir():
+			err = m.fs.MkdirAll(target, 0700)
+			if err != nil {
+				return bosherr.WrapErrorf(err, "Creating directory '%s'", target)
+			}
+
+			dirs = append(dirs, copiedDir{path: target, mode: info.Mode().Perm()})
+
+			return nil
+
+		case info.Mode().IsRegular():
+			progress.progress.Path = path
+			return m.copyFileVerified(path, target, info, progress)
+
+		default:
+			return bosherr.Errorf("Unsupported file type of '%s'", path)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Directories are walked before their contents, so children come first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err = m.fs.Chmod(dirs[i].path, dirs[i].mode)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Changing mode of directory '%s'", dirs[i].path)
+		}
+	}
+
+	return nil
+}
+
+func (m verifiedFileMover) copyFileVerified(src, dst string, info os.FileInfo, progress *moveProgressReporter) error {
+	var expectedDigest boshcrypto.MultipleDigest
+
+	if len(m.options.DigestAlgorithms) > 0 {
+		var err error
+		expectedDigest, err = boshcrypto.NewMultipleDigestFromPath(src, m.fs, m.options.DigestAlgorithms)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Calculating digest of '%s'", src)
+		}
+	}
+
+	err := m.copyFile(src, dst, info, progress)
+	if err != nil {
+		return err
+	}
+
+	copiedInfo, err := m.fs.Stat(dst)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Checking copy of '%s'", src)
+	}
+
+	if copiedInfo.Size() != info.Size() {
+		return bosherr.Errorf("Verifying copy of '%s': Expected %d bytes but copied %d", src, info.Size(), copiedInfo.Size())
+	}
+
+	if len(m.options.DigestAlgorithms) > 0 {
+		err = expectedDigest.VerifyFilePath(dst, m.fs)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Verifying copy of '%s'", src)
+		}
+	}
+
+	err = m.fs.Chtimes(dst, info.ModTime(), info.ModTime())
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Changing modification time of '%s'", dst)
+	}
+
+	return nil
+}
+
+func (m verifiedFileMover) copyFile(src, dst string, info os.FileInfo, progress *moveProgressReporter) error {
+	srcFile, err := m.fs.OpenFile(src, os.O_RDONLY, 0)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Opening '%s'", src)
+	}
+	defer srcFile.Close() //nolint:errcheck
+
+	dstFile, err := m.fs.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Creating '%s'", dst)
+	}
+	defer dstFile.Close() //nolint:errcheck
+
+	_, err = io.Copy(io.MultiWriter(dstFile, progress), srcFile)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Copying '%s'", src)
+	}
+
+	// Make sure the content is on disk before the copy is renamed into place
+	if syncer, ok := dstFile.(interface{ Sync() error }); ok {
+		err = syncer.Sync()
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Syncing '%s'", dst)
+		}
+	}
+
+	return dstFile.Close()
+}
+
+type moveProgressReporter struct {
+	report   func(MoveProgress)
+	progress MoveProgress
+}
+
+func (r *moveProgressReporter) Write(p []byte) (int, error) {
+	r.progress.CopiedBytes += int64(len(p))
+
+	if r.report != nil {
+		r.report(r.progress)
+	}
+
+	return len(p), nil
+}
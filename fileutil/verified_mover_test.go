@@ -0,0 +1,201 @@
+package fileutil_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	boshcrypto "github.com/cloudfoundry/bosh-utils/crypto"
+	. "github.com/cloudfoundry/bosh-utils/fileutil"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// crossDeviceFileSystem fails renames of the source like renames across file
+// systems do, and optionally corrupts files written through it
+type crossDeviceFileSystem struct {
+	boshsys.FileSystem
+
+	source  string
+	corrupt func(p []byte) []byte
+}
+
+func (fs crossDeviceFileSystem) Rename(oldPath, newPath string) error {
+	if oldPath == fs.source {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: syscall.Errno(0x12)}
+	}
+	return fs.FileSystem.Rename(oldPath, newPath)
+}
+
+func (fs crossDeviceFileSystem) OpenFile(path string, flag int, perm os.FileMode) (boshsys.File, error) {
+	file, err := fs.FileSystem.OpenFile(path, flag, perm)
+	if err != nil || fs.corrupt == nil || flag&os.O_WRONLY == 0 {
+		return file, err
+	}
+	return corruptingFile{File: file, corrupt: fs.corrupt}, nil
+}
+
+type corruptingFile struct {
+	boshsys.File
+	corrupt func(p []byte) []byte
+}
+
+func (f corruptingFile) Write(p []byte) (int, error) {
+	_, err := f.File.Write(f.corrupt(p))
+	return len(p), err
+}
+
+var _ = Describe("verifiedFileMover", func() {
+	var (
+		osFs    boshsys.FileSystem
+		fs      crossDeviceFileSystem
+		srcDir  string
+		dstDir  string
+		src     string
+		dst     string
+		modTime time.Time
+	)
+
+	BeforeEach(func() {
+		osFs = boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+		srcDir = GinkgoT().TempDir()
+		dstDir = GinkgoT().TempDir()
+
+		src = filepath.Join(srcDir, "package.tgz")
+		dst = filepath.Join(dstDir, "package.tgz")
+
+		modTime = time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+		Expect(os.WriteFile(src, []byte("package content"), 0640)).To(Succeed())
+		Expect(os.Chtimes(src, modTime, modTime)).To(Succeed())
+
+		fs = crossDeviceFileSystem{FileSystem: osFs, source: src}
+	})
+
+	It("renames within a file system", func() {
+		var progress []MoveProgress
+		mover := NewVerifiedFileMover(osFs, VerifiedMoverOptions{Progress: func(p MoveProgress) { progress = append(progress, p) }})
+
+		Expect(mover.Move(src, dst)).To(Succeed())
+
+		Expect(src).ToNot(BeAnExistingFile())
+		Expect(dst).To(BeAnExistingFile())
+		Expect(progress).To(BeEmpty())
+	})
+
+	It("returns rename errors other than crossing file systems", func() {
+		err := NewVerifiedFileMover(osFs, VerifiedMoverOptions{}).Move(filepath.Join(srcDir, "missing"), dst)
+		Expect(err).To(HaveOccurred())
+		Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+	})
+
+	Context("across file systems", func() {
+		It("copies the file, renames the copy into place and removes the source", func() {
+			var progress []MoveProgress
+			mover := NewVerifiedFileMover(fs, VerifiedMoverOptions{
+				DigestAlgorithms: []boshcrypto.Algorithm{boshcrypto.DigestAlgorithmSHA256},
+				Progress:         func(p MoveProgress) { progress = append(progress, p) },
+			})
+
+			Expect(mover.Move(src, dst)).To(Succeed())
+
+			Expect(src).ToNot(BeAnExistingFile())
+
+			content, err := os.ReadFile(dst)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("package content"))
+
+			info, err := os.Stat(dst)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.ModTime()).To(BeTemporally("==", modTime))
+			if runtime.GOOS != "windows" {
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+			}
+
+			Expect(progress).ToNot(BeEmpty())
+			Expect(progress[len(progress)-1]).To(Equal(MoveProgress{Path: src, CopiedBytes: 15, TotalBytes: 15}))
+
+			entries, err := os.ReadDir(dstDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+
+		It("moves directories", func() {
+			dir := filepath.Join(srcDir, "job")
+			Expect(os.MkdirAll(filepath.Join(dir, "templates"), 0755)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "templates", "ctl.erb"), []byte("ctl"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "monit"), []byte("monit"), 0644)).To(Succeed())
+
+			var progress MoveProgress
+			fs.source = dir
+			mover := NewVerifiedFileMover(fs, VerifiedMoverOptions{Progress: func(p MoveProgress) { progress = p }})
+
+			Expect(mover.Move(dir, filepath.Join(dstDir, "job"))).To(Succeed())
+
+			Expect(dir).ToNot(BeAnExistingFile())
+			content, err := os.ReadFile(filepath.Join(dstDir, "job", "templates", "ctl.erb"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("ctl"))
+			Expect(progress.CopiedBytes).To(Equal(int64(8)))
+			Expect(progress.TotalBytes).To(Equal(int64(8)))
+		})
+
+		It("gives moved directories the modes of their sources", func() {
+			if runtime.GOOS == "windows" {
+				Skip("Directory modes are not supported on Windows")
+			}
+
+			dir := filepath.Join(srcDir, "job")
+			Expect(os.MkdirAll(filepath.Join(dir, "templates"), 0700)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "templates", "ctl.erb"), []byte("ctl"), 0644)).To(Succeed())
+			Expect(os.Chmod(filepath.Join(dir, "templates"), 0711)).To(Succeed())
+			Expect(os.Chmod(dir, 0750)).To(Succeed())
+
+			fs.source = dir
+			mover := NewVerifiedFileMover(fs, VerifiedMoverOptions{})
+
+			Expect(mover.Move(dir, filepath.Join(dstDir, "job"))).To(Succeed())
+
+			info, err := os.Stat(filepath.Join(dstDir, "job"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0750)))
+
+			info, err = os.Stat(filepath.Join(dstDir, "job", "templates"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0711)))
+		})
+
+		It("keeps the source and leaves nothing behind when the copy has the wrong size", func() {
+			fs.corrupt = func(p []byte) []byte { return p[:len(p)-1] }
+
+			err := NewVerifiedFileMover(fs, VerifiedMoverOptions{}).Move(src, dst)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Expected 15 bytes but copied 14"))
+
+			Expect(src).To(BeAnExistingFile())
+			entries, err := os.ReadDir(dstDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+
+		It("keeps the source when the digest of the copy does not match", func() {
+			fs.corrupt = func(p []byte) []byte {
+				corrupted := append([]byte{}, p...)
+				corrupted[0] ^= 0xff
+				return corrupted
+			}
+
+			err := NewVerifiedFileMover(fs, VerifiedMoverOptions{DigestAlgorithms: []boshcrypto.Algorithm{boshcrypto.DigestAlgorithmSHA256}}).Move(src, dst)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Verifying copy of '" + src + "'"))
+
+			Expect(src).To(BeAnExistingFile())
+			Expect(dst).ToNot(BeAnExistingFile())
+		})
+	})
+})
@@ -0,0 +1,449 @@
+package fileutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// maxZipSymlinkSize bounds how much of a symlink entry is read as its target
+const maxZipSymlinkSize = 4096
+
+const zipCompressorLogTag = "zipCompressor"
+
+// zipCompressor reads and writes zip archives. Zip archives have no notion of
+// ownership, hard links or special files, so SameOwner is ignored, hard links
+// are stored as regular files and FIFOs, sockets and devices are skipped.
+// Only CompressionFormatGzip (deflate) and CompressionFormatNone (store) are
+// supported as compression formats.
+type zipCompressor struct {
+	fs     boshsys.FileSystem
+	logger boshlog.Logger
+}
+
+func NewZipCompressor(fs boshsys.FileSystem, logger boshlog.Logger) Compressor {
+	return zipCompressor{fs: fs, logger: logger}
+}
+
+func (c zipCompressor) CompressFilesInDir(dir string, options CompressorOptions) (string, error) {
+	return c.CompressSpecificFilesInDir(dir, []string{"."}, options)
+}
+
+func (c zipCompressor) CompressSpecificFilesInDir(dir string, files []string, options CompressorOptions) (string, error) {
+	archive, err := c.fs.TempFile("bosh-platform-disk-ZipCompressor-CompressSpecificFilesInDir")
+	if err != nil {
+		return "", bosherr.WrapError(err, "Creating temporary file for zip archive")
+	}
+
+	defer archive.Close() //nolint:errcheck
+
+	archivePath := archive.Name()
+
+	err = c.CompressSpecificFilesInDirToWriter(dir, files, archive, options)
+	if err != nil {
+		_ = c.fs.RemoveAll(archivePath) //nolint:errcheck
+		return "", err
+	}
+
+	return archivePath, nil
+}
+
+func (c zipCompressor) CompressFilesInDirToWriter(dir string, w io.Writer, options CompressorOptions) error {
+	return c.CompressSpecificFilesInDirToWriter(dir, []string{"."}, w, options)
+}
+
+func (c zipCompressor) CompressSpecificFilesInDirToWriter(dir string, files []string, w io.Writer, options CompressorOptions) error {
+	err := c.writeZip(w, dir, files, options)
+	if err != nil {
+		return bosherr.WrapError(err, "Writing zip archive")
+	}
+
+	return nil
+}
+
+func (c zipCompressor) writeZip(w io.Writer, dir string, files []string, options CompressorOptions) error {
+	zipWriter := zip.NewWriter(w)
+	entryWriter := zipEntryWriter{zipWriter: zipWriter, method: zip.Deflate}
+
+	switch format := options.compressionFormat(); format {
+	case CompressionFormatNone:
+		entryWriter.method = zip.Store
+	case CompressionFormatGzip:
+		if options.CompressionLevel != 0 {
+			// Fail early on invalid levels rather than on the first file
+			_, err := flate.NewWriter(io.Discard, options.CompressionLevel)
+			if err != nil {
+				return bosherr.WrapErrorf(err, "Invalid compression level %d for zip", options.CompressionLevel)
+			}
+
+			zipWriter.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+				return flate.NewWriter(w, options.CompressionLevel)
+			})
+		}
+	default:
+		return bosherr.Errorf("Unsupported compression format '%s' for zip archives", format)
+	}
+
+	if options.Reproducible {
+		files = append([]string{}, files...)
+		sort.Strings(files)
+
+		modTime, err := reproducibleModTime()
+		if err != nil {
+			return err
+		}
+		entryWriter.reproducibleModTime = &modTime
+	}
+
+	for _, file := range files {
+		err := c.addToZip(entryWriter, dir, file)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := zipWriter.Close()
+	if err != nil {
+		return bosherr.WrapError(err, "Closing zip writer")
+	}
+
+	return nil
+}
+
+// addToZip adds file and everything below it, naming entries relative to dir
+// without the "./" prefix tar would use, e.g. "sub/" when file is "."
+func (c zipCompressor) addToZip(entryWriter zipEntryWriter, dir, file string) error {
+	root := filepath.Join(dir, file)
+	prefix := strings.TrimSuffix(cleanArchivePath(filepath.ToSlash(file)), "/")
+
+	return c.fs.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Walking '%s'", filePath)
+		}
+
+		relPath, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Determining path of '%s' in archive", filePath)
+		}
+
+		name := prefix
+		if relPath != "." {
+			name = cleanArchivePath(prefix + "/" + filepath.ToSlash(relPath))
+		}
+
+		if name == "." {
+			return nil
+		}
+
+		return c.addEntry(entryWriter, filePath, name, info)
+	})
+}
+
+// zipEntryWriter is the state shared by all entries of a zip archive being written
+type zipEntryWriter struct {
+	zipWriter *zip.Writer
+	method    uint16
+
+	// reproducibleModTime replaces modification times when set
+	reproducibleModTime *time.Time
+}
+
+func (c zipCompressor) addEntry(entryWriter zipEntryWriter, filePath, name string, info os.FileInfo) error {
+	// Special files cannot be stored in zip archives, so they are skipped like sockets are in tarballs
+	if !info.Mode().IsRegular() && !info.IsDir() && info.Mode()&os.ModeSymlink == 0 {
+		c.logger.Warn(zipCompressorLogTag, "Skipping special file '%s'", filePath)
+		return nil
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Creating zip header for '%s'", filePath)
+	}
+
+	header.Name = name
+	header.Method = entryWriter.method
+
+	if info.IsDir() {
+		header.Name += "/"
+		header.Method = zip.Store
+	}
+
+	if entryWriter.reproducibleModTime != nil {
+		header.Modified = *entryWriter.reproducibleModTime
+	}
+
+	w, err := entryWriter.zipWriter.CreateHeader(header)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing zip header for '%s'", filePath)
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := c.fs.Readlink(filePath)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Reading symlink '%s'", filePath)
+		}
+
+		_, err = io.WriteString(w, target)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Writing '%s' to zip archive", filePath)
+		}
+
+	case info.Mode().IsRegular():
+		f, err := c.fs.OpenFile(filePath, os.O_RDONLY, 0)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Opening '%s'", filePath)
+		}
+		defer f.Close() //nolint:errcheck
+
+		_, err = io.Copy(w, f)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Writing '%s' to zip archive", filePath)
+		}
+	}
+
+	return nil
+}
+
+func (c zipCompressor) DecompressFileToDir(archivePath string, dir string, options CompressorOptions) error {
+	dirInfo, err := c.fs.Stat(dir)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Checking destination directory '%s'", dir)
+	}
+	if !dirInfo.IsDir() {
+		return bosherr.Errorf("Checking destination directory '%s': Not a directory", dir)
+	}
+
+	zipReader, closeArchive, err := c.openZip(archivePath)
+	if err != nil {
+		return err
+	}
+	defer closeArchive()
+
+	// Zip archives carry no ownership to restore
+	options.SameOwner = false
+
+	return archiveExtractor{fs: c.fs}.extract(&zipEntryIterator{files: zipReader.File}, dir, options)
+}
+
+// DecompressReaderToDir stages r in a temporary file first, since zip
+// archives are read from their central directory at the end
+func (c zipCompressor) DecompressReaderToDir(r io.Reader, dir string, options CompressorOptions) error {
+	archive, err := c.fs.TempFile("bosh-platform-disk-ZipCompressor-DecompressReaderToDir")
+	if err != nil {
+		return bosherr.WrapError(err, "Creating temporary file for zip archive")
+	}
+
+	defer c.fs.RemoveAll(archive.Name()) //nolint:errcheck
+	defer archive.Close()                //nolint:errcheck
+
+	_, err = io.Copy(archive, r)
+	if err != nil {
+		return bosherr.WrapError(err, "Staging zip archive")
+	}
+
+	return c.DecompressFileToDir(archive.Name(), dir, options)
+}
+
+func (c zipCompressor) ListEntries(archivePath string) ([]ArchiveEntry, error) {
+	zipReader, closeArchive, err := c.openZip(archivePath)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Listing entries of '%s'", archivePath)
+	}
+	defer closeArchive()
+
+	iterator := &zipEntryIterator{files: zipReader.File}
+
+	var entries []ArchiveEntry
+	for {
+		header, _, err := iterator.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Listing entries of '%s'", archivePath)
+		}
+
+		entries = append(entries, newArchiveEntry(header))
+	}
+}
+
+func (c zipCompressor) OpenEntry(archivePath string, name string) (io.ReadCloser, error) {
+	zipReader, closeArchive, err := c.openZip(archivePath)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Reading '%s' from '%s'", name, archivePath)
+	}
+
+	wanted := cleanArchivePath(name)
+
+	for _, f := range zipReader.File {
+		if cleanArchivePath(zipEntryName(f)) != wanted {
+			continue
+		}
+
+		if !f.Mode().IsRegular() || strings.HasSuffix(f.Name, "/") {
+			closeArchive()
+			return nil, bosherr.Errorf("Reading '%s' from '%s': Not a regular file", name, archivePath)
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			closeArchive()
+			return nil, bosherr.WrapErrorf(err, "Reading '%s' from '%s'", name, archivePath)
+		}
+
+		return archiveEntryReader{Reader: r, closeFunc: func() {
+			r.Close() //nolint:errcheck
+			closeArchive()
+		}}, nil
+	}
+
+	closeArchive()
+	return nil, bosherr.Errorf("Reading '%s' from '%s': Not found", name, archivePath)
+}
+
+func (c zipCompressor) ReadEntry(archivePath string, name string) ([]byte, error) {
+	r, err := c.OpenEntry(archivePath, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() //nolint:errcheck
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Reading '%s' from '%s'", name, archivePath)
+	}
+
+	return content, nil
+}
+
+func (c zipCompressor) IsNonCompressedTarball(path string) bool {
+	return isNonCompressedTarball(c.fs, path)
+}
+
+func (c zipCompressor) DetectCompressionFormat(path string) (CompressionFormat, error) {
+	return detectCompressionFormat(c.fs, path)
+}
+
+func (c zipCompressor) CleanUp(archivePath string) error {
+	return c.fs.RemoveAll(archivePath)
+}
+
+func (c zipCompressor) openZip(archivePath string) (*zip.Reader, func(), error) {
+	resolvedArchivePath, err := c.fs.ReadAndFollowLink(archivePath)
+	if err != nil {
+		return nil, nil, bosherr.WrapError(err, "Resolving zip archive path")
+	}
+
+	archive, err := c.fs.OpenFile(resolvedArchivePath, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, nil, bosherr.WrapError(err, "Opening zip archive")
+	}
+
+	info, err := archive.Stat()
+	if err != nil {
+		archive.Close() //nolint:errcheck
+		return nil, nil, bosherr.WrapError(err, "Stating zip archive")
+	}
+
+	zipReader, err := zip.NewReader(archive, info.Size())
+	if err != nil {
+		archive.Close() //nolint:errcheck
+		return nil, nil, bosherr.WrapError(err, "Reading zip archive")
+	}
+
+	return zipReader, func() { archive.Close() }, nil //nolint:errcheck
+}
+
+// zipEntryIterator presents zip entries as tar headers for archiveExtractor
+type zipEntryIterator struct {
+	files   []*zip.File
+	next    int
+	current io.ReadCloser
+}
+
+func (i *zipEntryIterator) Next() (*tar.Header, io.Reader, error) {
+	if i.current != nil {
+		i.current.Close() //nolint:errcheck
+		i.current = nil
+	}
+
+	if i.next >= len(i.files) {
+		return nil, nil, io.EOF
+	}
+
+	f := i.files[i.next]
+	i.next++
+
+	header := &tar.Header{
+		Name:     zipEntryName(f),
+		Typeflag: tar.TypeReg,
+		Size:     int64(f.UncompressedSize64),
+		Mode:     int64(f.Mode().Perm()),
+		ModTime:  f.Modified,
+	}
+
+	switch {
+	case f.Mode().IsDir() || strings.HasSuffix(header.Name, "/"):
+		header.Typeflag = tar.TypeDir
+		header.Size = 0
+		return header, nil, nil
+
+	case f.Mode()&os.ModeSymlink != 0:
+		target, err := readZipSymlink(f)
+		if err != nil {
+			return nil, nil, bosherr.WrapErrorf(err, "Reading symlink '%s'", f.Name)
+		}
+
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = target
+		header.Size = 0
+		return header, nil, nil
+
+	case !f.Mode().IsRegular():
+		header.Typeflag = tar.TypeChar
+		return header, nil, nil
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return nil, nil, bosherr.WrapErrorf(err, "Reading '%s'", f.Name)
+	}
+	i.current = r
+
+	return header, r, nil
+}
+
+// zipEntryName uses forward slashes even for archives written by tools that do not
+func zipEntryName(f *zip.File) string {
+	return strings.ReplaceAll(f.Name, `\`, "/")
+}
+
+func readZipSymlink(f *zip.File) (string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close() //nolint:errcheck
+
+	target, err := io.ReadAll(io.LimitReader(r, maxZipSymlinkSize+1))
+	if err != nil {
+		return "", err
+	}
+
+	if len(target) > maxZipSymlinkSize {
+		return "", bosherr.Errorf("Symlink target is longer than %d bytes", maxZipSymlinkSize)
+	}
+
+	return string(target), nil
+}
@@ -0,0 +1,381 @@
+package fileutil_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/bosh-utils/fileutil"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	"github.com/cloudfoundry/bosh-utils/logger/loggerfakes"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+type testZipEntry struct {
+	name    string
+	mode    os.FileMode
+	content string
+}
+
+func writeTestZip(path string, entries []testZipEntry) {
+	f, err := os.Create(path)
+	Expect(err).ToNot(HaveOccurred())
+	defer f.Close() //nolint:errcheck
+
+	zipWriter := zip.NewWriter(f)
+
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		header.SetMode(entry.mode)
+
+		w, err := zipWriter.CreateHeader(header)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = w.Write([]byte(entry.content))
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	Expect(zipWriter.Close()).To(Succeed())
+}
+
+var _ = Describe("zipCompressor", func() {
+	var (
+		fs         boshsys.FileSystem
+		compressor Compressor
+		dstDir     string
+		zipPath    string
+	)
+
+	BeforeEach(func() {
+		fs = boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+		compressor = NewZipCompressor(fs, boshlog.NewLogger(boshlog.LevelNone))
+
+		var err error
+		dstDir, err = filepath.EvalSymlinks(GinkgoT().TempDir())
+		Expect(err).ToNot(HaveOccurred())
+		zipPath = filepath.Join(GinkgoT().TempDir(), "archive.zip")
+	})
+
+	Describe("CompressFilesInDir", func() {
+		It("round trips the contents of the directory", func() {
+			archivePath, err := compressor.CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(archivePath) //nolint:errcheck
+
+			format, err := compressor.DetectCompressionFormat(archivePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(format).To(Equal(CompressionFormatZip))
+
+			err = compressor.DecompressFileToDir(archivePath, dstDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			content, err := fs.ReadFileString(filepath.Join(dstDir, "other_logs", "other_app.stderr.log"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(content).To(ContainSubstring("this is other app stderr"))
+			Expect(filepath.Join(dstDir, "other_logs", "more_logs")).To(BeADirectory())
+			Expect(filepath.Join(dstDir, ".keep")).To(BeAnExistingFile())
+		})
+
+		It("names entries relative to the directory", func() {
+			archivePath, err := compressor.CompressSpecificFilesInDir(testAssetsFixtureDir, []string{"other_logs", "app.stdout.log"}, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(archivePath) //nolint:errcheck
+
+			entries, err := compressor.ListEntries(archivePath)
+			Expect(err).ToNot(HaveOccurred())
+
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name)
+			}
+			Expect(names).To(ContainElements("other_logs/", "other_logs/other_app.stderr.log", "app.stdout.log"))
+			Expect(names).ToNot(ContainElement("some_directory/"))
+		})
+
+		It("stores entries without compression when asked to", func() {
+			var stored, deflated bytes.Buffer
+			Expect(compressor.CompressFilesInDirToWriter(testAssetsFixtureDir, &stored, CompressorOptions{NoCompression: true})).To(Succeed())
+			Expect(compressor.CompressFilesInDirToWriter(testAssetsFixtureDir, &deflated, CompressorOptions{CompressionLevel: 9})).To(Succeed())
+
+			zipReader, err := zip.NewReader(bytes.NewReader(stored.Bytes()), int64(stored.Len()))
+			Expect(err).ToNot(HaveOccurred())
+			for _, f := range zipReader.File {
+				Expect(f.Method).To(Equal(zip.Store))
+			}
+		})
+
+		It("rejects compression formats other than deflate and store", func() {
+			_, err := compressor.CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{CompressionFormat: CompressionFormatXz})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Unsupported compression format 'xz' for zip archives"))
+		})
+
+		It("creates identical archives when reproducible", func() {
+			var first, second bytes.Buffer
+			Expect(compressor.CompressFilesInDirToWriter(testAssetsFixtureDir, &first, CompressorOptions{Reproducible: true})).To(Succeed())
+
+			Expect(os.Chtimes(filepath.Join(testAssetsFixtureDir, "app.stdout.log"), time.Unix(1000000000, 0), time.Unix(1000000000, 0))).To(Succeed())
+			Expect(compressor.CompressFilesInDirToWriter(testAssetsFixtureDir, &second, CompressorOptions{Reproducible: true})).To(Succeed())
+
+			Expect(first.Bytes()).To(Equal(second.Bytes()))
+		})
+
+		It("skips special files with a warning", func() {
+			if runtime.GOOS == "windows" {
+				Skip("Sockets are only skipped on POSIX file systems")
+			}
+
+			srcDir := GinkgoT().TempDir()
+			Expect(os.WriteFile(filepath.Join(srcDir, "file"), []byte("content"), 0644)).To(Succeed())
+
+			listener, err := net.Listen("unix", filepath.Join(srcDir, "socket"))
+			Expect(err).ToNot(HaveOccurred())
+			defer listener.Close() //nolint:errcheck
+
+			logger := &loggerfakes.FakeLogger{}
+			compressor := NewZipCompressor(fs, logger)
+
+			archivePath, err := compressor.CompressFilesInDir(srcDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(archivePath) //nolint:errcheck
+
+			entries, err := compressor.ListEntries(archivePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Name).To(Equal("file"))
+
+			Expect(logger.WarnCallCount()).To(Equal(1))
+			_, message, args := logger.WarnArgsForCall(0)
+			Expect(fmt.Sprintf(message, args...)).To(ContainSubstring(filepath.Join(srcDir, "socket")))
+		})
+
+		It("can be extracted by unzip", func() {
+			if _, err := exec.LookPath("unzip"); err != nil {
+				Skip("unzip is not installed")
+			}
+
+			archivePath, err := compressor.CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(archivePath) //nolint:errcheck
+
+			output, err := exec.Command("unzip", "-q", archivePath, "-d", dstDir).CombinedOutput()
+			Expect(err).ToNot(HaveOccurred(), string(output))
+
+			content, err := fs.ReadFileString(filepath.Join(dstDir, "app.stdout.log"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(content).To(ContainSubstring("this is app stdout"))
+		})
+	})
+
+	Describe("DecompressFileToDir", func() {
+		BeforeEach(func() {
+			writeTestZip(zipPath, []testZipEntry{
+				{name: "release/", mode: os.ModeDir | 0755},
+				{name: "release/jobs/", mode: os.ModeDir | 0755},
+				{name: "release/jobs/job.tgz", mode: 0644, content: "job"},
+				{name: "release/release.MF", mode: 0600, content: "manifest"},
+			})
+		})
+
+		It("extracts files with their permissions", func() {
+			err := compressor.DecompressFileToDir(zipPath, dstDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			info, err := os.Stat(filepath.Join(dstDir, "release", "release.MF"))
+			Expect(err).ToNot(HaveOccurred())
+			if runtime.GOOS != "windows" {
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+			}
+		})
+
+		It("strips leading path components", func() {
+			err := compressor.DecompressFileToDir(zipPath, dstDir, CompressorOptions{StripComponents: 1})
+			Expect(err).ToNot(HaveOccurred())
+
+			content, err := fs.ReadFileString(filepath.Join(dstDir, "jobs", "job.tgz"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(content).To(Equal("job"))
+		})
+
+		It("extracts only the given path in the archive", func() {
+			err := compressor.DecompressFileToDir(zipPath, dstDir, CompressorOptions{PathInArchive: "release/jobs"})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(filepath.Join(dstDir, "release", "jobs", "job.tgz")).To(BeAnExistingFile())
+			Expect(filepath.Join(dstDir, "release", "release.MF")).ToNot(BeAnExistingFile())
+		})
+
+		It("returns an error if the path in the archive is missing", func() {
+			err := compressor.DecompressFileToDir(zipPath, dstDir, CompressorOptions{PathInArchive: "missing"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Finding 'missing' in archive: Not found"))
+		})
+
+		It("extracts symlinks", func() {
+			if runtime.GOOS == "windows" {
+				Skip("Symlinks are not extracted on Windows")
+			}
+
+			writeTestZip(zipPath, []testZipEntry{
+				{name: "file", mode: 0644, content: "content"},
+				{name: "link", mode: os.ModeSymlink | 0777, content: "file"},
+			})
+
+			err := compressor.DecompressFileToDir(zipPath, dstDir, CompressorOptions{})
+			Expect(err).ToNot(HaveOccurred())
+
+			target, err := os.Readlink(filepath.Join(dstDir, "link"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(target).To(Equal("file"))
+		})
+
+		DescribeTable("rejects unsafe entries",
+			func(entries []testZipEntry, expectedErr string) {
+				if runtime.GOOS == "windows" {
+					Skip("Extraction safety is exercised with POSIX paths and symlinks")
+				}
+
+				writeTestZip(zipPath, entries)
+				Expect(os.Mkdir(filepath.Join(dstDir, "dst"), 0755)).To(Succeed())
+
+				err := compressor.DecompressFileToDir(zipPath, filepath.Join(dstDir, "dst"), CompressorOptions{})
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring(expectedErr))
+
+				Expect(filepath.Join(dstDir, "evil")).ToNot(BeAnExistingFile())
+			},
+			Entry("parent directory references",
+				[]testZipEntry{{name: "../evil", mode: 0644, content: "evil"}},
+				"Validating '../evil': Path escapes the destination directory",
+			),
+			Entry("absolute paths",
+				[]testZipEntry{{name: "/evil", mode: 0644, content: "evil"}},
+				"Validating '/evil': Absolute paths are not allowed",
+			),
+			Entry("backslash separated parent directory references",
+				[]testZipEntry{{name: `..\evil`, mode: 0644, content: "evil"}},
+				"Validating '../evil': Path escapes the destination directory",
+			),
+			Entry("writes through a symlink pointing outside",
+				[]testZipEntry{
+					{name: "escape", mode: os.ModeSymlink | 0777, content: ".."},
+					{name: "escape/evil", mode: 0644, content: "evil"},
+				},
+				"Validating 'escape/evil': Path traverses symlink 'escape' pointing outside of the archive",
+			),
+		)
+	})
+
+	Describe("DecompressReaderToDir", func() {
+		It("extracts a zip archive from a stream", func() {
+			writeTestZip(zipPath, []testZipEntry{{name: "file", mode: 0644, content: "content"}})
+
+			f, err := os.Open(zipPath)
+			Expect(err).ToNot(HaveOccurred())
+			defer f.Close() //nolint:errcheck
+
+			Expect(compressor.DecompressReaderToDir(f, dstDir, CompressorOptions{})).To(Succeed())
+
+			content, err := fs.ReadFileString(filepath.Join(dstDir, "file"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(content).To(Equal("content"))
+		})
+	})
+
+	Describe("ReadEntry", func() {
+		BeforeEach(func() {
+			writeTestZip(zipPath, []testZipEntry{
+				{name: "dir/", mode: os.ModeDir | 0755},
+				{name: "dir/file", mode: 0644, content: "content"},
+			})
+		})
+
+		It("reads a single file regardless of a leading ./", func() {
+			content, err := compressor.ReadEntry(zipPath, "./dir/file")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("content"))
+		})
+
+		It("returns an error for directories and missing entries", func() {
+			_, err := compressor.ReadEntry(zipPath, "dir")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HaveSuffix("Not a regular file"))
+
+			_, err = compressor.ReadEntry(zipPath, "missing")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HaveSuffix("Not found"))
+		})
+	})
+})
+
+var _ = Describe("detectingCompressor", func() {
+	var (
+		fs         boshsys.FileSystem
+		compressor Compressor
+		dstDir     string
+	)
+
+	BeforeEach(func() {
+		fs = boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+		compressor = NewDetectingCompressor(NewNativeTarballCompressor(fs, boshlog.NewLogger(boshlog.LevelNone)), NewZipCompressor(fs, boshlog.NewLogger(boshlog.LevelNone)), fs)
+		dstDir = GinkgoT().TempDir()
+	})
+
+	for name, newCompressor := range map[string]func(boshsys.FileSystem) Compressor{
+		"tarballs": func(fs boshsys.FileSystem) Compressor {
+			return NewNativeTarballCompressor(fs, boshlog.NewLogger(boshlog.LevelNone))
+		},
+		"zip archives": func(fs boshsys.FileSystem) Compressor {
+			return NewZipCompressor(fs, boshlog.NewLogger(boshlog.LevelNone))
+		},
+	} {
+		Context("with "+name, func() {
+			var archivePath string
+
+			BeforeEach(func() {
+				var err error
+				archivePath, err = newCompressor(fs).CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{})
+				Expect(err).ToNot(HaveOccurred())
+				DeferCleanup(os.Remove, archivePath)
+			})
+
+			It("extracts files", func() {
+				Expect(compressor.DecompressFileToDir(archivePath, dstDir, CompressorOptions{})).To(Succeed())
+				Expect(filepath.Join(dstDir, "other_logs", "other_app.stderr.log")).To(BeAnExistingFile())
+			})
+
+			It("extracts streams", func() {
+				f, err := os.Open(archivePath)
+				Expect(err).ToNot(HaveOccurred())
+				defer f.Close() //nolint:errcheck
+
+				Expect(compressor.DecompressReaderToDir(f, dstDir, CompressorOptions{})).To(Succeed())
+				Expect(filepath.Join(dstDir, "other_logs", "other_app.stderr.log")).To(BeAnExistingFile())
+			})
+
+			It("reads single entries", func() {
+				content, err := compressor.ReadEntry(archivePath, "app.stdout.log")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(content)).To(ContainSubstring("this is app stdout"))
+			})
+		})
+	}
+
+	It("creates tarballs", func() {
+		archivePath, err := compressor.CompressFilesInDir(testAssetsFixtureDir, CompressorOptions{})
+		Expect(err).ToNot(HaveOccurred())
+		defer os.Remove(archivePath) //nolint:errcheck
+
+		format, err := compressor.DetectCompressionFormat(archivePath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(format).To(Equal(CompressionFormatGzip))
+	})
+})
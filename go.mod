@@ -7,12 +7,15 @@ require (
 	code.cloudfoundry.org/tlsconfig v0.53.0
 	github.com/bmatcuk/doublestar v1.3.4
 	github.com/cloudfoundry/socks5-proxy v0.2.185
+	github.com/dsnet/compress v0.0.1
 	github.com/jessevdk/go-flags v1.6.1
 	github.com/jpillora/backoff v1.0.0
+	github.com/klauspost/compress v1.20.1
 	github.com/nu7hatch/gouuid v0.0.0-20131221200532-179d4d0c4d8d
 	github.com/onsi/ginkgo/v2 v2.32.1
 	github.com/onsi/gomega v1.40.0
 	github.com/stretchr/testify v1.12.1
+	github.com/ulikunitz/xz v0.5.17
 	golang.org/x/net v0.58.0
 	golang.org/x/sys v0.47.0
 	gopkg.in/yaml.v2 v2.4.0
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	boshcrypto "github.com/cloudfoundry/bosh-utils/crypto"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+type VerifyDirDigestArgs struct {
+	Dir    string
+	Digest string
+}
+
+type VerifyDirDigestCommand struct {
+	Args VerifyDirDigestArgs `positional-args:"yes"`
+}
+
+func (c VerifyDirDigestCommand) Execute(args []string) error {
+	multipleDigest, err := boshcrypto.ParseMultipleDigest(c.Args.Digest)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Parsing digest '%s'", c.Args.Digest)
+	}
+
+	fs := boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+	return boshcrypto.VerifyDirectory(multipleDigest, c.Args.Dir, fs)
+}
+
+type CreateDirDigestArgs struct {
+	Algorithms string
+	Dir        string
+}
+
+type CreateDirDigestCommand struct {
+	Args CreateDirDigestArgs `positional-args:"yes"`
+}
+
+func (c CreateDirDigestCommand) Execute(args []string) error {
+	algos, err := parseAlgorithms(c.Args.Algorithms)
+	if err != nil {
+		return err
+	}
+
+	fs := boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+	multipleDigest, err := boshcrypto.NewMultipleDigestFromDir(c.Args.Dir, fs, algos)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s", multipleDigest.String())
+	return nil
+}
+
+type ChecksumManifestArgs struct {
+	Algorithm string
+	Dir       string
+}
+
+type CreateChecksumManifestCommand struct {
+	Output string               `long:"output" short:"o" description:"Write manifest to file instead of stdout"`
+	Args   ChecksumManifestArgs `positional-args:"yes"`
+}
+
+func (c CreateChecksumManifestCommand) Execute(args []string) error {
+	algo, err := parseAlgorithm(c.Args.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	fs := boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+	manifest, err := boshcrypto.NewChecksumManifest(c.Args.Dir, fs, algo)
+	if err != nil {
+		return err
+	}
+
+	if c.Output == "" {
+		fmt.Print(manifest.String())
+		return nil
+	}
+
+	manifest = withoutChecksumManifestEntry(manifest, c.Args.Dir, c.Output)
+
+	return fs.WriteFileString(c.Output, manifest.String())
+}
+
+type VerifyChecksumManifestArgs struct {
+	Algorithm string
+	Dir       string
+	Manifest  string
+}
+
+type VerifyChecksumManifestCommand struct {
+	Args VerifyChecksumManifestArgs `positional-args:"yes"`
+}
+
+func (c VerifyChecksumManifestCommand) Execute(args []string) error {
+	algo, err := parseAlgorithm(c.Args.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	fs := boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+
+	content, err := fs.ReadFileString(c.Args.Manifest)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := boshcrypto.ParseChecksumManifest(content, algo)
+	if err != nil {
+		return err
+	}
+
+	report, err := manifest.Verify(c.Args.Dir, fs)
+	if err != nil {
+		return err
+	}
+
+	manifestPath, ok := relativeManifestPath(c.Args.Dir, c.Args.Manifest)
+	if ok {
+		report.Extra = withoutPath(report.Extra, manifestPath)
+	}
+
+	for _, path := range report.Missing {
+		fmt.Printf("%s: MISSING\n", path)
+	}
+	for _, path := range report.Extra {
+		fmt.Printf("%s: EXTRA\n", path)
+	}
+	for _, path := range report.Modified {
+		fmt.Printf("%s: FAILED\n", path)
+	}
+
+	return report.Err()
+}
+
+func parseAlgorithm(algorithm string) (boshcrypto.Algorithm, error) {
+	if strings.Contains(algorithm, ",") {
+		return nil, bosherr.Errorf("expected a single algorithm but got '%s'", algorithm)
+	}
+
+	algos, err := parseAlgorithms(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	return algos[0], nil
+}
+
+// relativeManifestPath returns the manifest path relative to dir when the manifest is stored inside dir
+func relativeManifestPath(dir, manifest string) (string, bool) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+
+	absManifest, err := filepath.Abs(manifest)
+	if err != nil {
+		return "", false
+	}
+
+	relPath, err := filepath.Rel(absDir, absManifest)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return "", false
+	}
+
+	return filepath.ToSlash(relPath), true
+}
+
+func withoutChecksumManifestEntry(manifest boshcrypto.ChecksumManifest, dir, manifestPath string) boshcrypto.ChecksumManifest {
+	relPath, ok := relativeManifestPath(dir, manifestPath)
+	if !ok {
+		return manifest
+	}
+
+	entries := []boshcrypto.ChecksumManifestEntry{}
+	for _, entry := range manifest.Entries {
+		if entry.Path != relPath {
+			entries = append(entries, entry)
+		}
+	}
+	manifest.Entries = entries
+
+	return manifest
+}
+
+func withoutPath(paths []string, path string) []string {
+	result := []string{}
+	for _, p := range paths {
+		if p != path {
+			result = append(result, p)
+		}
+	}
+	return result
+}
@@ -0,0 +1,115 @@
+package main_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("DirectoryDigest", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+
+		Expect(os.MkdirAll(filepath.Join(dir, "sub"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "test"), []byte("sample content"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "sub", "other"), []byte("other content"), 0644)).To(Succeed())
+	})
+
+	createDirDigest := func(algorithms string) string {
+		session, err := runVerifyMultidigest("create-dir-digest", algorithms, dir)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(session).Should(gexec.Exit(0))
+		return string(session.Out.Contents())
+	}
+
+	Context("directory digests", func() {
+		It("creates a digest that verifies", func() {
+			digest := createDirDigest("sha1,sha256")
+			Expect(digest).To(MatchRegexp(`\A[0-9a-f]{40};sha256:[0-9a-f]{64}\z`))
+
+			session, err := runVerifyMultidigest("verify-dir-digest", dir, digest)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("exits 1 when the directory changed", func() {
+			digest := createDirDigest("sha256")
+
+			Expect(os.WriteFile(filepath.Join(dir, "sub", "other"), []byte("changed"), 0644)).To(Succeed())
+
+			session, err := runVerifyMultidigest("verify-dir-digest", dir, digest)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(1))
+			Eventually(session.Err).Should(gbytes.Say("Expected directory '.*' to have digest '" + digest + "' but was 'sha256:"))
+		})
+
+		It("exits 1 when the digest is malformed", func() {
+			session, err := runVerifyMultidigest("verify-dir-digest", dir, "sha1:!")
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(1))
+			Eventually(session.Err).Should(gbytes.Say("Parsing digest 'sha1:!'"))
+		})
+
+		It("exits 1 when the algorithm is unknown", func() {
+			session, err := runVerifyMultidigest("create-dir-digest", "potato", dir)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(1))
+			Eventually(session.Err).Should(gbytes.Say("unknown algorithm 'potato'"))
+		})
+	})
+
+	Context("checksum manifests", func() {
+		It("prints a sha256sum compatible manifest", func() {
+			session, err := runVerifyMultidigest("create-checksum-manifest", "sha256", dir)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal(
+				"923b805711041e23a99f07e146591c500261d1c289f62a9d39f8581ceb8a10ca  sub/other\n" +
+					"571ca3b4ef92a81f8c062f2c2437b9116435d1575589a7b64a5c607d058fde0d  test\n",
+			))
+		})
+
+		It("verifies a manifest stored inside the directory", func() {
+			manifestPath := filepath.Join(dir, "SHA256SUMS")
+
+			session, err := runVerifyMultidigest("create-checksum-manifest", "-o", manifestPath, "sha256", dir)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(0))
+
+			session, err = runVerifyMultidigest("verify-checksum-manifest", "sha256", dir, manifestPath)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("reports mismatching files and exits 1", func() {
+			manifestPath := filepath.Join(GinkgoT().TempDir(), "SHA256SUMS")
+
+			session, err := runVerifyMultidigest("create-checksum-manifest", "-o", manifestPath, "sha256", dir)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(0))
+
+			Expect(os.Remove(filepath.Join(dir, "test"))).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "sub", "other"), []byte("changed"), 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(dir, "new"), []byte("new"), 0644)).To(Succeed())
+
+			session, err = runVerifyMultidigest("verify-checksum-manifest", "sha256", dir, manifestPath)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(1))
+			Expect(string(session.Out.Contents())).To(Equal("test: MISSING\nnew: EXTRA\nsub/other: FAILED\n"))
+			Eventually(session.Err).Should(gbytes.Say("Missing file 'test'"))
+		})
+
+		It("exits 1 when more than one algorithm is given", func() {
+			session, err := runVerifyMultidigest("create-checksum-manifest", "sha1,sha256", dir)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(1))
+			Eventually(session.Err).Should(gbytes.Say("expected a single algorithm but got 'sha1,sha256'"))
+		})
+	})
+})
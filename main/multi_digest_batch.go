@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	boshcrypto "github.com/cloudfoundry/bosh-utils/crypto"
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+	"github.com/cloudfoundry/bosh-utils/work"
+)
+
+const (
+	digestResultStatusOK     = "ok"
+	digestResultStatusFailed = "failed"
+	digestResultStatusError  = "error"
+)
+
+type checksumListEntry struct {
+	File   string
+	Digest string
+}
+
+type digestResult struct {
+	File     string `json:"file"`
+	Digest   string `json:"digest,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+
+	verify bool
+}
+
+func verifyMultiDigests(entries []checksumListEntry, parallel int) ([]digestResult, error) {
+	results := make([]digestResult, len(entries))
+
+	tasks := make([]func() error, len(entries))
+	for i, entry := range entries {
+		tasks[i] = func() error {
+			results[i] = verifyMultiDigest(entry)
+			return nil
+		}
+	}
+
+	err := runDigestTasks(tasks, parallel)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func verifyMultiDigest(entry checksumListEntry) digestResult {
+	result := digestResult{File: entry.File, Expected: entry.Digest, verify: true}
+
+	multipleDigest, err := boshcrypto.ParseMultipleDigest(entry.Digest)
+	if err != nil {
+		return result.withError(digestResultStatusError, bosherr.WrapErrorf(err, "Parsing digest '%s'", entry.Digest))
+	}
+
+	file, err := os.Open(entry.File)
+	if err != nil {
+		return result.withError(digestResultStatusError, err)
+	}
+	defer file.Close() //nolint:errcheck
+
+	err = multipleDigest.Verify(file)
+	if err != nil {
+		return result.withError(digestResultStatusFailed, err)
+	}
+
+	result.Status = digestResultStatusOK
+	return result
+}
+
+func createMultiDigests(files []string, algos []boshcrypto.Algorithm, fs boshsys.FileSystem, parallel int) ([]digestResult, error) {
+	results := make([]digestResult, len(files))
+
+	tasks := make([]func() error, len(files))
+	for i, file := range files {
+		tasks[i] = func() error {
+			result := digestResult{File: file}
+
+			multipleDigest, err := boshcrypto.NewMultipleDigestFromPath(file, fs, algos)
+			if err != nil {
+				results[i] = result.withError(digestResultStatusError, err)
+				return nil
+			}
+
+			result.Digest = multipleDigest.String()
+			result.Status = digestResultStatusOK
+			results[i] = result
+			return nil
+		}
+	}
+
+	err := runDigestTasks(tasks, parallel)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// runDigestTasks runs tasks that record their own failures,
+// so that one bad file does not stop the remaining files from being processed
+func runDigestTasks(tasks []func() error, parallel int) error {
+	if parallel < 1 {
+		return bosherr.Errorf("expected --parallel to be at least 1 but was %d", parallel)
+	}
+
+	return work.Pool{Count: parallel}.ParallelDo(tasks...)
+}
+
+func (r digestResult) withError(status string, err error) digestResult {
+	r.Status = status
+	r.Error = err.Error()
+	return r
+}
+
+// printDigestResults prints results in input order and returns an error if any of them did not succeed
+func printDigestResults(results []digestResult, asJSON bool) error {
+	failed := 0
+
+	for _, result := range results {
+		if result.Status != digestResultStatusOK {
+			failed++
+		}
+
+		if asJSON {
+			bytes, err := json.Marshal(result)
+			if err != nil {
+				return bosherr.WrapError(err, "Marshalling result")
+			}
+			fmt.Println(string(bytes))
+			continue
+		}
+
+		switch {
+		case result.Status == digestResultStatusOK && !result.verify:
+			fmt.Printf("%s  %s\n", result.Digest, result.File)
+		case result.Status == digestResultStatusOK:
+			fmt.Printf("%s: OK\n", result.File)
+		default:
+			fmt.Printf("%s: %s\n", result.File, strings.ToUpper(result.Status))
+			fmt.Fprintf(os.Stderr, "%s: %s\n", result.File, result.Error)
+		}
+	}
+
+	if failed > 0 {
+		return bosherr.Errorf("%d of %d files failed", failed, len(results))
+	}
+
+	return nil
+}
+
+// readChecksumList reads '<digest>  <path>' lines, as written by create-multi-digest or sha*sum.
+// Unprefixed 64 and 128 character digests are treated as sha256 and sha512 respectively.
+func readChecksumList(path string) ([]checksumListEntry, error) {
+	var entries []checksumListEntry
+
+	err := readLines(path, func(lineNum int, line string) error {
+		digest, file, found := strings.Cut(line, " ")
+		if !found || len(file) < 2 || (file[0] != ' ' && file[0] != '*') {
+			return bosherr.Errorf("Parsing checksum file '%s' line %d: Expected '<digest>  <path>'", path, lineNum)
+		}
+
+		entries = append(entries, checksumListEntry{File: file[1:], Digest: inferDigestAlgorithms(digest)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func readFileList(path string) ([]string, error) {
+	var files []string
+
+	err := readLines(path, func(_ int, line string) error {
+		files = append(files, line)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func readLines(path string, lineFunc func(lineNum int, line string) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Opening '%s'", path)
+	}
+	defer file.Close() //nolint:errcheck
+
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		err = lineFunc(lineNum, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Reading '%s'", path)
+	}
+
+	return nil
+}
+
+func inferDigestAlgorithms(multipleDigest string) string {
+	pieces := strings.Split(multipleDigest, ";")
+
+	for i, piece := range pieces {
+		if strings.Contains(piece, ":") {
+			continue
+		}
+
+		switch len(piece) {
+		case 64:
+			pieces[i] = boshcrypto.DigestAlgorithmSHA256.Name() + ":" + piece
+		case 128:
+			pieces[i] = boshcrypto.DigestAlgorithmSHA512.Name() + ":" + piece
+		}
+	}
+
+	return strings.Join(pieces, ";")
+}
@@ -0,0 +1,170 @@
+package main_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("MultiDigestBatch", func() {
+	const (
+		sampleSHA256 = "571ca3b4ef92a81f8c062f2c2437b9116435d1575589a7b64a5c607d058fde0d"
+		otherSHA256  = "923b805711041e23a99f07e146591c500261d1c289f62a9d39f8581ceb8a10ca"
+	)
+
+	var (
+		dir, samplePath, otherPath string
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		samplePath = filepath.Join(dir, "sample")
+		otherPath = filepath.Join(dir, "other")
+
+		Expect(os.WriteFile(samplePath, []byte("sample content"), 0644)).To(Succeed())
+		Expect(os.WriteFile(otherPath, []byte("other content"), 0644)).To(Succeed())
+	})
+
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		Expect(os.WriteFile(path, []byte(content), 0644)).To(Succeed())
+		return path
+	}
+
+	Context("create-multi-digest", func() {
+		It("prints a line per file in the order given", func() {
+			session, err := runVerifyMultidigest("create-multi-digest", "sha256", samplePath, otherPath)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal(
+				"sha256:" + sampleSHA256 + "  " + samplePath + "\n" +
+					"sha256:" + otherSHA256 + "  " + otherPath + "\n",
+			))
+		})
+
+		It("reads additional files from --files-from", func() {
+			listPath := writeFile("list", otherPath+"\n\n")
+
+			session, err := runVerifyMultidigest("create-multi-digest", "--files-from", listPath, "sha256", samplePath)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(strings.Split(strings.TrimSpace(string(session.Out.Contents())), "\n")).To(HaveLen(2))
+		})
+
+		It("prints JSON results and exits 1 if any file failed", func() {
+			missingPath := filepath.Join(dir, "missing")
+
+			session, err := runVerifyMultidigest("create-multi-digest", "--json", "--parallel", "1", "sha256", missingPath, samplePath)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(1))
+			Eventually(session.Err).Should(gbytes.Say("1 of 2 files failed"))
+
+			lines := strings.Split(strings.TrimSpace(string(session.Out.Contents())), "\n")
+			Expect(lines).To(HaveLen(2))
+
+			var result map[string]string
+			Expect(json.Unmarshal([]byte(lines[0]), &result)).To(Succeed())
+			Expect(result["file"]).To(Equal(missingPath))
+			Expect(result["status"]).To(Equal("error"))
+			Expect(result["error"]).To(ContainSubstring("calculating digest of '" + missingPath + "'"))
+
+			var okResult map[string]string
+			Expect(json.Unmarshal([]byte(lines[1]), &okResult)).To(Succeed())
+			Expect(okResult).To(Equal(map[string]string{"file": samplePath, "digest": "sha256:" + sampleSHA256, "status": "ok"}))
+		})
+
+		It("exits 1 when --parallel is less than 1", func() {
+			session, err := runVerifyMultidigest("create-multi-digest", "--parallel", "0", "sha256", samplePath, otherPath)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(1))
+			Eventually(session.Err).Should(gbytes.Say("expected --parallel to be at least 1 but was 0"))
+		})
+	})
+
+	Context("verify-multi-digest", func() {
+		It("verifies every line of a sha256sum style --checksum-file", func() {
+			checksumPath := writeFile("SHA256SUMS",
+				sampleSHA256+"  "+samplePath+"\n"+
+					"sha256:"+otherSHA256+" *"+otherPath+"\n",
+			)
+
+			session, err := runVerifyMultidigest("verify-multi-digest", "--checksum-file", checksumPath)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(string(session.Out.Contents())).To(Equal(samplePath + ": OK\n" + otherPath + ": OK\n"))
+		})
+
+		It("verifies the remaining files after a failure and exits 1", func() {
+			checksumPath := writeFile("SHA256SUMS",
+				"sha256:"+otherSHA256+"  "+samplePath+"\n"+
+					"sha256:!  "+otherPath+"\n"+
+					"sha256:"+otherSHA256+"  "+otherPath+"\n",
+			)
+
+			session, err := runVerifyMultidigest("verify-multi-digest", "--checksum-file", checksumPath)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(1))
+			Expect(string(session.Out.Contents())).To(Equal(
+				samplePath + ": FAILED\n" + otherPath + ": ERROR\n" + otherPath + ": OK\n",
+			))
+			Eventually(session.Err).Should(gbytes.Say("Parsing digest 'sha256:!'"))
+			Eventually(session.Err).Should(gbytes.Say("2 of 3 files failed"))
+		})
+
+		It("reports malformed checksum file lines", func() {
+			checksumPath := writeFile("SHA256SUMS", "not-a-checksum-line\n")
+
+			session, err := runVerifyMultidigest("verify-multi-digest", "--checksum-file", checksumPath)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(1))
+			Eventually(session.Err).Should(gbytes.Say("line 1: Expected '<digest>  <path>'"))
+		})
+
+		It("prints JSON results for the positional file", func() {
+			session, err := runVerifyMultidigest("verify-multi-digest", "--json", samplePath, "sha256:"+sampleSHA256)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(0))
+
+			var result map[string]string
+			Expect(json.Unmarshal(session.Out.Contents(), &result)).To(Succeed())
+			Expect(result).To(Equal(map[string]string{"file": samplePath, "expected": "sha256:" + sampleSHA256, "status": "ok"}))
+		})
+
+		It("verifies several positional files, each followed by its digest", func() {
+			session, err := runVerifyMultidigest("verify-multi-digest", samplePath, "sha256:"+sampleSHA256, otherPath, "sha256:"+sampleSHA256)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(1))
+			Expect(string(session.Out.Contents())).To(Equal(samplePath + ": OK\n" + otherPath + ": FAILED\n"))
+			Eventually(session.Err).Should(gbytes.Say("1 of 2 files failed"))
+		})
+
+		It("exits 1 with a usage error when a file lacks a digest", func() {
+			session, err := runVerifyMultidigest("verify-multi-digest", samplePath, "sha256:"+sampleSHA256, otherPath)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(1))
+			Eventually(session.Err).Should(gbytes.Say("expected a digest after every file"))
+		})
+
+		It("exits 1 with a usage error when --json is given without files or --checksum-file", func() {
+			session, err := runVerifyMultidigest("verify-multi-digest", "--json")
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(1))
+			Eventually(session.Err).Should(gbytes.Say("expected at least one file and digest, or --checksum-file"))
+			Expect(session.Out.Contents()).To(BeEmpty())
+		})
+
+		It("exits 1 instead of panicking when the digest is malformed", func() {
+			session, err := runVerifyMultidigest("verify-multi-digest", samplePath, "sha256:!")
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(session).Should(gexec.Exit(1))
+			Eventually(session.Err).Should(gbytes.Say("Parsing digest 'sha256:!'"))
+			Expect(string(session.Err.Contents())).ToNot(ContainSubstring("panic"))
+		})
+	})
+})
@@ -14,9 +14,13 @@ import (
 )
 
 type opts struct {
-	VerifyMultiDigestCommand MultiDigestCommand  `command:"verify-multi-digest"`
-	CreateMultiDigestCommand CreateDigestCommand `command:"create-multi-digest"`
-	VersionFlag              func() error        `long:"version"`
+	VerifyMultiDigestCommand      MultiDigestCommand            `command:"verify-multi-digest"`
+	CreateMultiDigestCommand      CreateDigestCommand           `command:"create-multi-digest"`
+	VerifyDirDigestCommand        VerifyDirDigestCommand        `command:"verify-dir-digest"`
+	CreateDirDigestCommand        CreateDirDigestCommand        `command:"create-dir-digest"`
+	VerifyChecksumManifestCommand VerifyChecksumManifestCommand `command:"verify-checksum-manifest"`
+	CreateChecksumManifestCommand CreateChecksumManifestCommand `command:"create-checksum-manifest"`
+	VersionFlag                   func() error                  `long:"version"`
 }
 
 func main() {
@@ -42,36 +46,126 @@ func main() {
 }
 
 type MultiDigestArgs struct {
-	File   string
-	Digest string
+	FilesAndDigests []string `positional-arg-name:"FILE DIGEST" description:"Files to verify, each followed by its expected digest"`
 }
 
 type MultiDigestCommand struct {
+	ChecksumFile string `long:"checksum-file" description:"Verify every '<digest>  <path>' line of the given file"`
+	JSON         bool   `long:"json" description:"Print one JSON result per file"`
+	Parallel     int    `long:"parallel" default:"4" description:"Number of files to verify concurrently"`
+
 	Args MultiDigestArgs `positional-args:"yes"`
 }
 
 func (m MultiDigestCommand) Execute(args []string) error {
-	multipleDigest := boshcrypto.MustParseMultipleDigest(m.Args.Digest)
-	file, err := os.Open(m.Args.File)
+	if len(m.Args.FilesAndDigests)%2 != 0 {
+		return bosherr.Error("expected a digest after every file")
+	}
+
+	var entries []checksumListEntry
+
+	for i := 0; i < len(m.Args.FilesAndDigests); i += 2 {
+		entries = append(entries, checksumListEntry{File: m.Args.FilesAndDigests[i], Digest: m.Args.FilesAndDigests[i+1]})
+	}
+
+	if m.ChecksumFile == "" {
+		if len(entries) == 0 {
+			return bosherr.Error("expected at least one file and digest, or --checksum-file")
+		}
+
+		if len(entries) == 1 && !m.JSON {
+			return verifySingleMultiDigest(entries[0])
+		}
+	}
+
+	if m.ChecksumFile != "" {
+		listEntries, err := readChecksumList(m.ChecksumFile)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, listEntries...)
+	}
+
+	results, err := verifyMultiDigests(entries, m.Parallel)
 	if err != nil {
 		return err
 	}
+
+	return printDigestResults(results, m.JSON)
+}
+
+// verifySingleMultiDigest verifies a single file without printing a result,
+// like verify-multi-digest always did before it accepted several files
+func verifySingleMultiDigest(entry checksumListEntry) error {
+	multipleDigest, err := boshcrypto.ParseMultipleDigest(entry.Digest)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Parsing digest '%s'", entry.Digest)
+	}
+
+	file, err := os.Open(entry.File)
+	if err != nil {
+		return err
+	}
+	defer file.Close() //nolint:errcheck
+
 	return multipleDigest.Verify(file)
 }
 
 type CreateDigestArgs struct {
 	Algorithms string
-	File       string
+	Files      []string
 }
 
 type CreateDigestCommand struct {
+	FilesFrom string `long:"files-from" description:"Read paths to digest from the given file, one per line"`
+	JSON      bool   `long:"json" description:"Print one JSON result per file"`
+	Parallel  int    `long:"parallel" default:"4" description:"Number of files to digest concurrently"`
+
 	Args CreateDigestArgs `positional-args:"yes"`
 }
 
 func (c CreateDigestCommand) Execute(args []string) error {
-	algorithmStrs := strings.Split(c.Args.Algorithms, ",")
+	algos, err := parseAlgorithms(c.Args.Algorithms)
+	if err != nil {
+		return err
+	}
+
+	fs := boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+
+	if c.FilesFrom == "" && !c.JSON && len(c.Args.Files) == 1 {
+		multipleDigest, err := boshcrypto.NewMultipleDigestFromPath(c.Args.Files[0], fs, algos)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s", multipleDigest.String())
+		return nil
+	}
+
+	files := c.Args.Files
+
+	if c.FilesFrom != "" {
+		listedFiles, err := readFileList(c.FilesFrom)
+		if err != nil {
+			return err
+		}
+		files = append(files, listedFiles...)
+	}
+
+	if len(files) == 0 {
+		return bosherr.Error("expected at least one file")
+	}
+
+	results, err := createMultiDigests(files, algos, fs, c.Parallel)
+	if err != nil {
+		return err
+	}
+
+	return printDigestResults(results, c.JSON)
+}
+
+func parseAlgorithms(algorithms string) ([]boshcrypto.Algorithm, error) {
 	algos := []boshcrypto.Algorithm{}
-	for _, algorithmStr := range algorithmStrs {
+	for _, algorithmStr := range strings.Split(algorithms, ",") {
 		switch algorithmStr {
 		case "sha1":
 			algos = append(algos, boshcrypto.DigestAlgorithmSHA1)
@@ -80,15 +174,8 @@ func (c CreateDigestCommand) Execute(args []string) error {
 		case "sha512":
 			algos = append(algos, boshcrypto.DigestAlgorithmSHA512)
 		default:
-			return bosherr.Errorf("unknown algorithm '%s'", algorithmStr)
+			return nil, bosherr.Errorf("unknown algorithm '%s'", algorithmStr)
 		}
 	}
-
-	fs := boshsys.NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
-	multipleDigest, err := boshcrypto.NewMultipleDigestFromPath(c.Args.File, fs, algos)
-	if err != nil {
-		return err
-	}
-	fmt.Printf("%s", multipleDigest.String())
-	return nil
+	return algos, nil
 }
@@ -0,0 +1,236 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+)
+
+const auditCmdRunnerLogTag = "auditCmdRunner"
+
+// CmdAuditEntry is written as a line of JSON to the audit log
+// for every command run by AuditCmdRunner
+type CmdAuditEntry struct {
+	Time       time.Time         `json:"time"`
+	Name       string            `json:"name,omitempty"`
+	Args       []string          `json:"args,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+	WorkingDir string            `json:"working_dir,omitempty"`
+	User       string            `json:"user,omitempty"`
+
+	// Pipeline holds the entries of the commands of a pipeline,
+	// in which case the fields describing a command above are empty
+	Pipeline []CmdAuditEntry `json:"pipeline,omitempty"`
+
+	DurationSeconds float64 `json:"duration_seconds"`
+	ExitStatus      int     `json:"exit_status"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// AuditCmdRunner runs commands with another CmdRunner and writes an entry to
+// the audit log for every command once it finished. The args, Env values and
+// errors of commands are redacted with a SecretRedactor using the secret patterns.
+type AuditCmdRunner struct {
+	runner      CmdRunner
+	out         io.Writer
+	redactor    SecretRedactor
+	timeService clock.Clock
+	logger      boshlog.Logger
+
+	lock sync.Mutex
+}
+
+func NewAuditCmdRunner(
+	runner CmdRunner,
+	out io.Writer,
+	secretPatterns []*regexp.Regexp,
+	timeService clock.Clock,
+	logger boshlog.Logger,
+) *AuditCmdRunner {
+	return &AuditCmdRunner{
+		runner:      runner,
+		out:         out,
+		redactor:    NewSecretRedactor(secretPatterns),
+		timeService: timeService,
+		logger:      logger,
+	}
+}
+
+func (r *AuditCmdRunner) RunComplexCommand(cmd Command) (string, string, int, error) {
+	startTime := r.timeService.Now()
+
+	stdout, stderr, exitStatus, err := r.runner.RunComplexCommand(cmd)
+
+	r.audit(r.newEntry(cmd, startTime, exitStatus, err))
+
+	return stdout, stderr, exitStatus, err
+}
+
+func (r *AuditCmdRunner) RunComplexCommandContext(ctx context.Context, cmd Command) (string, string, int, error) {
+	startTime := r.timeService.Now()
+
+	stdout, stderr, exitStatus, err := r.runner.RunComplexCommandContext(ctx, cmd)
+
+	r.audit(r.newEntry(cmd, startTime, exitStatus, err))
+
+	return stdout, stderr, exitStatus, err
+}
+
+func (r *AuditCmdRunner) RunComplexCommandAsync(cmd Command) (Process, error) {
+	startTime := r.timeService.Now()
+
+	process, err := r.runner.RunComplexCommandAsync(cmd)
+
+	return r.auditProcess(cmd, startTime, process, err)
+}
+
+func (r *AuditCmdRunner) RunComplexCommandAsyncContext(ctx context.Context, cmd Command) (Process, error) {
+	startTime := r.timeService.Now()
+
+	process, err := r.runner.RunComplexCommandAsyncContext(ctx, cmd)
+
+	return r.auditProcess(cmd, startTime, process, err)
+}
+
+func (r *AuditCmdRunner) RunPipeline(ctx context.Context, cmds ...Command) (PipelineResult, error) {
+	startTime := r.timeService.Now()
+
+	result, err := r.runner.RunPipeline(ctx, cmds...)
+
+	entry := r.newEntry(Command{}, startTime, result.ExitStatus, err)
+
+	for i, cmd := range cmds {
+		var cmdResult Result
+		if i < len(result.Results) {
+			cmdResult = result.Results[i]
+		}
+
+		cmdEntry := r.newEntry(cmd, startTime, cmdResult.ExitStatus, cmdResult.Error)
+		cmdEntry.DurationSeconds = entry.DurationSeconds
+
+		entry.Pipeline = append(entry.Pipeline, cmdEntry)
+	}
+
+	r.audit(entry)
+
+	return result, err
+}
+
+func (r *AuditCmdRunner) RunCommand(cmdName string, args ...string) (string, string, int, error) {
+	startTime := r.timeService.Now()
+
+	stdout, stderr, exitStatus, err := r.runner.RunCommand(cmdName, args...)
+
+	r.audit(r.newEntry(Command{Name: cmdName, Args: args}, startTime, exitStatus, err))
+
+	return stdout, stderr, exitStatus, err
+}
+
+func (r *AuditCmdRunner) RunCommandContext(ctx context.Context, cmdName string, args ...string) (string, string, int, error) {
+	startTime := r.timeService.Now()
+
+	stdout, stderr, exitStatus, err := r.runner.RunCommandContext(ctx, cmdName, args...)
+
+	r.audit(r.newEntry(Command{Name: cmdName, Args: args}, startTime, exitStatus, err))
+
+	return stdout, stderr, exitStatus, err
+}
+
+func (r *AuditCmdRunner) RunCommandQuietly(cmdName string, args ...string) (string, string, int, error) {
+	startTime := r.timeService.Now()
+
+	stdout, stderr, exitStatus, err := r.runner.RunCommandQuietly(cmdName, args...)
+
+	r.audit(r.newEntry(Command{Name: cmdName, Args: args}, startTime, exitStatus, err))
+
+	return stdout, stderr, exitStatus, err
+}
+
+func (r *AuditCmdRunner) RunCommandWithInput(input, cmdName string, args ...string) (string, string, int, error) {
+	startTime := r.timeService.Now()
+
+	stdout, stderr, exitStatus, err := r.runner.RunCommandWithInput(input, cmdName, args...)
+
+	r.audit(r.newEntry(Command{Name: cmdName, Args: args}, startTime, exitStatus, err))
+
+	return stdout, stderr, exitStatus, err
+}
+
+func (r *AuditCmdRunner) CommandExists(cmdName string) bool {
+	return r.runner.CommandExists(cmdName)
+}
+
+func (r *AuditCmdRunner) auditProcess(cmd Command, startTime time.Time, process Process, err error) (Process, error) {
+	if err != nil {
+		r.audit(r.newEntry(cmd, startTime, -1, err))
+		return nil, err
+	}
+
+	return &auditProcess{Process: process, onResult: func(result Result) {
+		r.audit(r.newEntry(cmd, startTime, result.ExitStatus, result.Error))
+	}}, nil
+}
+
+func (r *AuditCmdRunner) newEntry(cmd Command, startTime time.Time, exitStatus int, err error) CmdAuditEntry {
+	entry := CmdAuditEntry{
+		Time:            startTime,
+		Name:            cmd.Name,
+		Args:            r.redactor.RedactArgs(cmd),
+		Env:             r.redactor.RedactEnv(cmd),
+		WorkingDir:      cmd.WorkingDir,
+		User:            cmd.User,
+		DurationSeconds: r.timeService.Since(startTime).Seconds(),
+		ExitStatus:      exitStatus,
+	}
+
+	if err != nil {
+		entry.Error = r.redactor.Redact(cmd, err.Error())
+	}
+
+	return entry
+}
+
+func (r *AuditCmdRunner) audit(entry CmdAuditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		r.logger.Error(auditCmdRunnerLogTag, "Marshalling audit entry: %s", err.Error())
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	_, err = r.out.Write(append(line, '\n'))
+	if err != nil {
+		r.logger.Error(auditCmdRunnerLogTag, "Writing audit entry of command '%s': %s", strings.Join(append([]string{entry.Name}, entry.Args...), " "), err.Error())
+	}
+}
+
+// auditProcess audits the result of the process it wraps
+// when it is received from Wait
+type auditProcess struct {
+	Process
+
+	onResult func(Result)
+}
+
+func (p *auditProcess) Wait() <-chan Result {
+	resultCh := make(chan Result, 1)
+	processResultCh := p.Process.Wait()
+
+	go func() {
+		result := <-processResultCh
+		p.onResult(result)
+		resultCh <- result
+	}()
+
+	return resultCh
+}
@@ -0,0 +1,179 @@
+package system_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-utils/logger/loggerfakes"
+	. "github.com/cloudfoundry/bosh-utils/system"
+	fakesys "github.com/cloudfoundry/bosh-utils/system/fakes"
+)
+
+var _ = Describe("AuditCmdRunner", func() {
+	var (
+		cmdRunner   *fakesys.FakeCmdRunner
+		out         *bytes.Buffer
+		timeService *fakeclock.FakeClock
+		startTime   time.Time
+		runner      *AuditCmdRunner
+	)
+
+	BeforeEach(func() {
+		cmdRunner = fakesys.NewFakeCmdRunner()
+		out = &bytes.Buffer{}
+		startTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		timeService = fakeclock.NewFakeClock(startTime)
+
+		secretPatterns := []*regexp.Regexp{
+			regexp.MustCompile(`--password=\S+`),
+			regexp.MustCompile(`^s3cr3t$`),
+		}
+
+		runner = NewAuditCmdRunner(cmdRunner, out, secretPatterns, timeService, &loggerfakes.FakeLogger{})
+	})
+
+	entries := func() []CmdAuditEntry {
+		var entries []CmdAuditEntry
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			var entry CmdAuditEntry
+			Expect(json.Unmarshal([]byte(line), &entry)).To(Succeed())
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+
+	It("writes an entry with the duration and exit status of every command it runs", func() {
+		cmdRunner.AddCmdResult("mount /dev/sdb /mnt", fakesys.FakeCmdResult{ExitStatus: 32, Error: errors.New("fake-err")})
+		cmdRunner.SetCmdCallback("mount /dev/sdb /mnt", func() { timeService.Increment(1500 * time.Millisecond) })
+
+		_, _, exitStatus, err := runner.RunComplexCommand(Command{
+			Name:       "mount",
+			Args:       []string{"/dev/sdb", "/mnt"},
+			WorkingDir: "/tmp",
+			User:       "vcap",
+		})
+		Expect(err).To(MatchError("fake-err"))
+		Expect(exitStatus).To(Equal(32))
+
+		_, _, _, err = runner.RunCommand("sync")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(entries()).To(Equal([]CmdAuditEntry{
+			{
+				Time:            startTime,
+				Name:            "mount",
+				Args:            []string{"/dev/sdb", "/mnt"},
+				WorkingDir:      "/tmp",
+				User:            "vcap",
+				DurationSeconds: 1.5,
+				ExitStatus:      32,
+				Error:           "fake-err",
+			},
+			{
+				Time:       startTime.Add(1500 * time.Millisecond),
+				Name:       "sync",
+				ExitStatus: -1,
+			},
+		}))
+	})
+
+	It("redacts args, env values and errors matching the secret patterns", func() {
+		cmdRunner.AddCmdResult("mysql --password=s3cr3t --user root", fakesys.FakeCmdResult{
+			Error: errors.New("Running 'mysql --password=s3cr3t --user root' failed"),
+		})
+
+		_, _, _, err := runner.RunComplexCommand(Command{
+			Name: "mysql",
+			Args: []string{"--password=s3cr3t", "--user", "root"},
+			Env:  map[string]string{"MYSQL_PWD": "s3cr3t", "HOME": "/root"},
+		})
+		Expect(err).To(HaveOccurred())
+
+		entry := entries()[0]
+		Expect(entry.Args).To(Equal([]string{"<redacted>", "--user", "root"}))
+		Expect(entry.Env).To(Equal(map[string]string{"MYSQL_PWD": "<redacted>", "HOME": "/root"}))
+		Expect(entry.Error).To(Equal("Running 'mysql <redacted> --user root' failed"))
+		Expect(out.String()).ToNot(ContainSubstring("s3cr3t"))
+	})
+
+	It("redacts the values of env variables named like secrets", func() {
+		_, _, _, err := runner.RunComplexCommand(Command{
+			Name: "aws",
+			Env: map[string]string{
+				"AWS_SECRET_ACCESS_KEY": "abc",
+				"VAULT_TOKEN":           "def",
+				"db_password":           "ghi",
+				"AWS_REGION":            "us-east-1",
+				"KEYBOARD":              "us",
+				"MONKEY_PATH":           "/opt/monkey",
+				"TOKENIZER_DIR":         "/opt/tokenizer",
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(entries()[0].Env).To(Equal(map[string]string{
+			"AWS_SECRET_ACCESS_KEY": "<redacted>",
+			"VAULT_TOKEN":           "<redacted>",
+			"db_password":           "<redacted>",
+			"AWS_REGION":            "us-east-1",
+			"KEYBOARD":              "us",
+			"MONKEY_PATH":           "/opt/monkey",
+			"TOKENIZER_DIR":         "/opt/tokenizer",
+		}))
+	})
+
+	It("applies the redaction of the command", func() {
+		_, _, _, err := runner.RunComplexCommand(Command{
+			Name:   "curl",
+			Args:   []string{"-u", "admin:hunter2"},
+			Redact: func(s string) string { return strings.ReplaceAll(s, "hunter2", "***") },
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(entries()[0].Args).To(Equal([]string{"-u", "admin:***"}))
+	})
+
+	It("writes entries for async commands once they finished", func() {
+		cmdRunner.AddProcess("sleep 1", &fakesys.FakeProcess{WaitResult: Result{ExitStatus: 0}})
+
+		process, err := runner.RunComplexCommandAsyncContext(context.Background(), Command{Name: "sleep", Args: []string{"1"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out.String()).To(BeEmpty())
+
+		timeService.Increment(time.Second)
+		<-process.Wait()
+
+		Expect(entries()).To(Equal([]CmdAuditEntry{
+			{Time: startTime, Name: "sleep", Args: []string{"1"}, DurationSeconds: 1},
+		}))
+	})
+
+	It("writes a single entry for pipelines", func() {
+		cmdRunner.AddCmdResult("tar -cf -", fakesys.FakeCmdResult{})
+		cmdRunner.AddCmdResult("gzip", fakesys.FakeCmdResult{ExitStatus: 1, Error: errors.New("fake-err")})
+
+		_, err := runner.RunPipeline(context.Background(), Command{Name: "tar", Args: []string{"-cf", "-"}}, Command{Name: "gzip"})
+		Expect(err).To(HaveOccurred())
+
+		Expect(entries()).To(Equal([]CmdAuditEntry{
+			{
+				Time: startTime,
+				Pipeline: []CmdAuditEntry{
+					{Time: startTime, Name: "tar", Args: []string{"-cf", "-"}},
+					{Time: startTime, Name: "gzip", ExitStatus: 1, Error: "fake-err"},
+				},
+				ExitStatus: 1,
+				Error:      "fake-err",
+			},
+		}))
+	})
+})
@@ -1,10 +1,16 @@
 package system
 
 import (
+	"context"
 	"io"
+	"os"
 	"time"
 )
 
+// DefaultKillGracePeriod is how long a command that timed out or was canceled
+// is given to exit after SIGTERM before it is killed
+const DefaultKillGracePeriod = 10 * time.Second
+
 type Command struct {
 	Name string
 	Args []string
@@ -12,7 +18,21 @@ type Command struct {
 
 	WorkingDir string
 
-	// On Linux when enabled inherits process group
+	// User runs the command as the user with the given name or uid, in Group
+	// and SupplementaryGroups, which are group names or gids. Group defaults to
+	// the primary group of User and SupplementaryGroups to the groups of User.
+	// HOME, USER and LOGNAME are set for User unless Env overrides them.
+	// Requires privileges and is not supported on Windows.
+	User                string
+	Group               string
+	SupplementaryGroups []string
+
+	// CleanEnv only passes PATH and the variables describing the user
+	// from the environment of the parent to the command, in addition to Env
+	CleanEnv bool
+
+	// On Linux when enabled inherits process group. Terminating the command
+	// then only signals the command, not the processes in its group.
 	KeepAttached bool
 
 	// Don't echo stdout/stderr
@@ -24,12 +44,52 @@ type Command struct {
 	// If the parent is already at the minimum priority, the child will run at the same level.
 	SpawnWithLowerPriority bool
 
+	// ResourceLimits limit the resources the command may use
+	ResourceLimits ResourceLimits
+
+	// PseudoTerminal attaches the command to a new pseudo-terminal as its
+	// controlling terminal, in a session of its own. Stdin is written to the
+	// terminal without being echoed, followed by an end-of-file character,
+	// twice if stdin does not end with a newline. Stdout and stderr are merged into Stdout, so
+	// OnStderrLine is never called. Only supported on Linux.
+	PseudoTerminal *PseudoTerminal
+
 	Stdin io.Reader
 
 	// Full stdout and stderr will be captured to memory
 	// and returned in the Result unless custom Stdout/Stderr are specified.
 	Stdout io.Writer
 	Stderr io.Writer
+
+	// MaxOutputSize limits how many bytes of stdout and of stderr are captured
+	// to memory. When exceeded, the beginning and the end of the output are kept
+	// around a marker stating how many bytes were dropped. Unlimited when zero.
+	MaxOutputSize int
+
+	// OnStdoutLine and OnStderrLine are called with every line of output,
+	// without the line separator, as the command writes it.
+	// They are called with custom Stdout/Stderr as well. Lines longer than
+	// MaxOutputSize, or than 1 MiB when it is zero, are passed on in parts.
+	OnStdoutLine func(line string)
+	OnStderrLine func(line string)
+
+	// Redact is applied to the command line and to captured output
+	// before they are logged or included in errors.
+	Redact func(s string) string
+
+	// Timeout terminates the command nicely when it runs for longer,
+	// the same way canceling the context of the command does.
+	Timeout time.Duration
+
+	// KillGracePeriod is how long a command that timed out or was canceled
+	// is given to exit before it is killed. Defaults to DefaultKillGracePeriod.
+	KillGracePeriod time.Duration
+}
+
+type PseudoTerminal struct {
+	// Rows and Cols of the window; default to 24 rows and 80 columns
+	Rows uint16
+	Cols uint16
 }
 
 type Process interface {
@@ -40,6 +100,13 @@ type Process interface {
 	// TerminateNicely can be called multiple times.
 	// It must only be called after Wait().
 	TerminateNicely(killGracePeriod time.Duration) error
+
+	// PID of the started process
+	PID() int
+
+	// Signal sends sig to the process.
+	// On Windows only os.Kill is supported.
+	Signal(sig os.Signal) error
 }
 
 type Result struct {
@@ -47,8 +114,43 @@ type Result struct {
 	Stdout string
 	Stderr string
 
+	// ExitStatus is 128 plus the signal when the process was terminated by one
 	ExitStatus int
 	Error      error
+
+	// Signal that terminated the process; nil when the process exited
+	Signal os.Signal
+
+	StartTime time.Time
+	EndTime   time.Time
+
+	Usage ResourceUsage
+}
+
+func (r Result) Duration() time.Duration {
+	return r.EndTime.Sub(r.StartTime)
+}
+
+// ResourceUsage of a process and its waited-for children
+type ResourceUsage struct {
+	// MaxRSS is the maximum resident set size in bytes.
+	// Always zero on Windows.
+	MaxRSS int64
+
+	UserTime   time.Duration
+	SystemTime time.Duration
+}
+
+type PipelineResult struct {
+	// Stdout of the last command
+	Stdout string
+
+	// ExitStatus of the first command that did not succeed, or 0
+	ExitStatus int
+
+	// Results of every command in the order of the pipeline.
+	// Only the last one has Stdout.
+	Results []Result
 }
 
 type CmdRunner interface {
@@ -59,10 +161,30 @@ type CmdRunner interface {
 	//  - command does not run
 	RunComplexCommand(cmd Command) (stdout, stderr string, exitStatus int, err error)
 
+	// RunComplexCommandContext terminates the command nicely when ctx is done
+	// or cmd.Timeout passes. Unless the command succeeds, the returned error
+	// is a CommandError describing whether it timed out, was canceled or
+	// exited with a non-zero exit status.
+	RunComplexCommandContext(ctx context.Context, cmd Command) (stdout, stderr string, exitStatus int, err error)
+
 	RunComplexCommandAsync(cmd Command) (Process, error)
 
+	// RunComplexCommandAsyncContext returns a Process whose Result.Error is a
+	// CommandError, like RunComplexCommandContext.
+	RunComplexCommandAsyncContext(ctx context.Context, cmd Command) (Process, error)
+
+	// RunPipeline runs cmds connecting the stdout of each to the stdin of the
+	// next, like a shell pipeline with pipefail: the error and exit status are
+	// those of the first command that did not succeed, returned as a CommandError.
+	// Stdin of the first and Stdout of the last command are used, and all
+	// commands are terminated nicely together when ctx is done or the Timeout of
+	// the first command passes.
+	RunPipeline(ctx context.Context, cmds ...Command) (PipelineResult, error)
+
 	RunCommand(cmdName string, args ...string) (stdout, stderr string, exitStatus int, err error)
 
+	RunCommandContext(ctx context.Context, cmdName string, args ...string) (stdout, stderr string, exitStatus int, err error)
+
 	RunCommandQuietly(cmdName string, args ...string) (stdout, stderr string, exitStatus int, err error)
 
 	RunCommandWithInput(input, cmdName string, args ...string) (stdout, stderr string, exitStatus int, err error)
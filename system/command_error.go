@@ -0,0 +1,72 @@
+package system
+
+import (
+	"context"
+	"fmt"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+type CommandErrorReason string
+
+const (
+	CommandExited   CommandErrorReason = "exited"
+	CommandTimedOut CommandErrorReason = "timed out"
+	CommandCanceled CommandErrorReason = "canceled"
+)
+
+// CommandError is returned when a command run with a context or a timeout
+// does not succeed. Commands that timed out match context.DeadlineExceeded
+// and canceled commands match context.Canceled with errors.Is.
+type CommandError struct {
+	Reason CommandErrorReason
+
+	// ExitStatus is the exit status of the command, including commands that
+	// exited after being terminated when they timed out or were canceled
+	ExitStatus int
+
+	// Err is the error running the command; nil if a command that timed out
+	// or was canceled still exited successfully
+	Err error
+}
+
+func (e CommandError) Error() string {
+	if e.Reason == CommandExited && e.Err != nil {
+		return e.Err.Error()
+	}
+
+	msg := fmt.Sprintf("Command %s (exit status %d)", e.Reason, e.ExitStatus)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+func (e CommandError) ShortError() string {
+	shortenableErr, ok := e.Err.(bosherr.ShortenableError)
+	if !ok {
+		return e.Error()
+	}
+
+	if e.Reason == CommandExited {
+		return shortenableErr.ShortError()
+	}
+
+	return fmt.Sprintf("Command %s (exit status %d): %s", e.Reason, e.ExitStatus, shortenableErr.ShortError())
+}
+
+func (e CommandError) Unwrap() error {
+	return e.Err
+}
+
+func (e CommandError) Is(target error) bool {
+	switch e.Reason {
+	case CommandTimedOut:
+		return target == context.DeadlineExceeded
+	case CommandCanceled:
+		return target == context.Canceled
+	default:
+		return false
+	}
+}
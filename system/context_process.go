@@ -0,0 +1,107 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+)
+
+// contextProcess terminates a process nicely when its context is done
+// and reports why it did not succeed with a CommandError
+type contextProcess struct {
+	ctx             context.Context
+	cancel          context.CancelFunc
+	process         Process
+	killGracePeriod time.Duration
+	logger          boshlog.Logger
+}
+
+func newContextProcess(
+	ctx context.Context,
+	process Process,
+	timeout time.Duration,
+	killGracePeriod time.Duration,
+	logger boshlog.Logger,
+) Process {
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	if killGracePeriod <= 0 {
+		killGracePeriod = DefaultKillGracePeriod
+	}
+
+	return contextProcess{
+		ctx:             ctx,
+		cancel:          cancel,
+		process:         process,
+		killGracePeriod: killGracePeriod,
+		logger:          logger,
+	}
+}
+
+func (p contextProcess) Wait() <-chan Result {
+	resultCh := p.process.Wait()
+
+	// Use buffer=1 to allow goroutine below to finish
+	waitCh := make(chan Result, 1)
+
+	go func() {
+		defer p.cancel()
+
+		select {
+		case result := <-resultCh:
+			waitCh <- p.commandResult(result, CommandExited)
+
+		case <-p.ctx.Done():
+			reason := contextErrorReason(p.ctx.Err())
+			p.logger.Debug(execProcessLogTag, "Terminating command that %s", reason)
+
+			err := p.process.TerminateNicely(p.killGracePeriod)
+			if err != nil {
+				p.logger.Error(execProcessLogTag, "Terminating command that %s: %s", reason, err.Error())
+			}
+
+			waitCh <- p.commandResult(<-resultCh, reason)
+		}
+	}()
+
+	return waitCh
+}
+
+func (p contextProcess) TerminateNicely(killGracePeriod time.Duration) error {
+	return p.process.TerminateNicely(killGracePeriod)
+}
+
+func (p contextProcess) PID() int {
+	return p.process.PID()
+}
+
+func (p contextProcess) Signal(sig os.Signal) error {
+	return p.process.Signal(sig)
+}
+
+func (p contextProcess) commandResult(result Result, reason CommandErrorReason) Result {
+	if result.Error == nil && reason == CommandExited {
+		return result
+	}
+
+	result.Error = CommandError{
+		Reason:     reason,
+		ExitStatus: result.ExitStatus,
+		Err:        result.Error,
+	}
+
+	return result
+}
+
+func contextErrorReason(err error) CommandErrorReason {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CommandTimedOut
+	}
+	return CommandCanceled
+}
@@ -0,0 +1,226 @@
+package system
+
+import (
+	"context"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+)
+
+const dryRunCmdRunnerLogTag = "dryRunCmdRunner"
+
+// DryRunCmdRunner records and logs commands instead of running them, so that
+// the commands an operation would run can be previewed. Commands succeed with
+// no output unless a result was added for them. CommandExists is answered
+// by the wrapped CmdRunner, which never runs commands. Commands are logged
+// redacted with a SecretRedactor using the secret patterns.
+type DryRunCmdRunner struct {
+	runner   CmdRunner
+	redactor SecretRedactor
+	logger   boshlog.Logger
+
+	results  map[string]Result
+	commands []Command
+	lock     sync.Mutex
+}
+
+func NewDryRunCmdRunner(runner CmdRunner, secretPatterns []*regexp.Regexp, logger boshlog.Logger) *DryRunCmdRunner {
+	return &DryRunCmdRunner{
+		runner:   runner,
+		redactor: NewSecretRedactor(secretPatterns),
+		logger:   logger,
+		results:  map[string]Result{},
+	}
+}
+
+// AddResult sets the result returned for a command. The full command line
+// (name and args joined with spaces) is matched first, then the command name.
+func (r *DryRunCmdRunner) AddResult(cmd string, result Result) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.results[cmd] = result
+}
+
+// Commands returns the commands that would have been run, in order
+func (r *DryRunCmdRunner) Commands() []Command {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]Command{}, r.commands...)
+}
+
+func (r *DryRunCmdRunner) RunComplexCommand(cmd Command) (string, string, int, error) {
+	result := r.run(cmd)
+
+	return result.Stdout, result.Stderr, result.ExitStatus, result.Error
+}
+
+func (r *DryRunCmdRunner) RunComplexCommandContext(ctx context.Context, cmd Command) (string, string, int, error) {
+	if ctx.Err() != nil {
+		return "", "", -1, CommandError{
+			Reason:     contextErrorReason(ctx.Err()),
+			ExitStatus: -1,
+			Err:        bosherr.Errorf("Not starting command '%s'", cmd.Name),
+		}
+	}
+
+	stdout, stderr, exitStatus, err := r.RunComplexCommand(cmd)
+	if err != nil {
+		err = CommandError{Reason: CommandExited, ExitStatus: exitStatus, Err: err}
+	}
+
+	return stdout, stderr, exitStatus, err
+}
+
+func (r *DryRunCmdRunner) RunComplexCommandAsync(cmd Command) (Process, error) {
+	return &dryRunProcess{result: r.run(cmd)}, nil
+}
+
+func (r *DryRunCmdRunner) RunComplexCommandAsyncContext(ctx context.Context, cmd Command) (Process, error) {
+	if ctx.Err() != nil {
+		return nil, CommandError{
+			Reason:     contextErrorReason(ctx.Err()),
+			ExitStatus: -1,
+			Err:        bosherr.Errorf("Not starting command '%s'", cmd.Name),
+		}
+	}
+
+	result := r.run(cmd)
+	if result.Error != nil {
+		result.Error = CommandError{Reason: CommandExited, ExitStatus: result.ExitStatus, Err: result.Error}
+	}
+
+	return &dryRunProcess{result: result}, nil
+}
+
+func (r *DryRunCmdRunner) RunPipeline(ctx context.Context, cmds ...Command) (PipelineResult, error) {
+	if len(cmds) == 0 {
+		return PipelineResult{}, bosherr.Error("Running pipeline: No commands")
+	}
+
+	if ctx.Err() != nil {
+		return PipelineResult{ExitStatus: -1}, CommandError{
+			Reason:     contextErrorReason(ctx.Err()),
+			ExitStatus: -1,
+			Err:        bosherr.Errorf("Not starting pipeline '%s'", r.redactor.CommandString(cmds...)),
+		}
+	}
+
+	r.logger.Info(dryRunCmdRunnerLogTag, "Not running pipeline '%s' in dry run", r.redactor.CommandString(cmds...))
+
+	var pipelineResult PipelineResult
+
+	for i, cmd := range cmds {
+		result := r.record(cmd)
+
+		// Only the output of the last command is not piped to the next one
+		if i < len(cmds)-1 {
+			result.Stdout = ""
+		} else {
+			result.Stdout = writeDryRunOutput(cmd.Stdout, cmd.OnStdoutLine, result.Stdout)
+		}
+
+		result.Stderr = writeDryRunOutput(cmd.Stderr, cmd.OnStderrLine, result.Stderr)
+
+		pipelineResult.Results = append(pipelineResult.Results, result)
+	}
+
+	pipelineResult.Stdout = pipelineResult.Results[len(cmds)-1].Stdout
+
+	for _, result := range pipelineResult.Results {
+		if result.Error != nil {
+			pipelineResult.ExitStatus = result.ExitStatus
+			return pipelineResult, CommandError{Reason: CommandExited, ExitStatus: result.ExitStatus, Err: result.Error}
+		}
+	}
+
+	return pipelineResult, nil
+}
+
+func (r *DryRunCmdRunner) RunCommand(cmdName string, args ...string) (string, string, int, error) {
+	return r.RunComplexCommand(Command{Name: cmdName, Args: args})
+}
+
+func (r *DryRunCmdRunner) RunCommandContext(ctx context.Context, cmdName string, args ...string) (string, string, int, error) {
+	return r.RunComplexCommandContext(ctx, Command{Name: cmdName, Args: args})
+}
+
+func (r *DryRunCmdRunner) RunCommandQuietly(cmdName string, args ...string) (string, string, int, error) {
+	return r.RunComplexCommand(Command{Name: cmdName, Args: args, Quiet: true})
+}
+
+func (r *DryRunCmdRunner) RunCommandWithInput(input, cmdName string, args ...string) (string, string, int, error) {
+	return r.RunComplexCommand(Command{Name: cmdName, Args: args, Stdin: strings.NewReader(input)})
+}
+
+func (r *DryRunCmdRunner) CommandExists(cmdName string) bool {
+	return r.runner.CommandExists(cmdName)
+}
+
+func (r *DryRunCmdRunner) run(cmd Command) Result {
+	r.logger.Info(dryRunCmdRunnerLogTag, "Not running command '%s' in dry run", r.redactor.CommandString(cmd))
+
+	result := r.record(cmd)
+	result.Stdout = writeDryRunOutput(cmd.Stdout, cmd.OnStdoutLine, result.Stdout)
+	result.Stderr = writeDryRunOutput(cmd.Stderr, cmd.OnStderrLine, result.Stderr)
+
+	return result
+}
+
+func (r *DryRunCmdRunner) record(cmd Command) Result {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.commands = append(r.commands, cmd)
+
+	result, found := r.results[strings.Join(append([]string{cmd.Name}, cmd.Args...), " ")]
+	if !found {
+		result = r.results[cmd.Name]
+	}
+
+	now := time.Now()
+	result.StartTime = now
+	result.EndTime = now
+
+	return result
+}
+
+// writeDryRunOutput writes output to the custom writer and line callback of a
+// command, and returns the output captured by the runner
+func writeDryRunOutput(w io.Writer, onLine func(string), output string) string {
+	if onLine != nil {
+		lines := newLineWriter(onLine, 0)
+		lines.Write([]byte(output)) //nolint:errcheck
+		lines.Flush()
+	}
+
+	if w != nil {
+		w.Write([]byte(output)) //nolint:errcheck
+		return ""
+	}
+
+	return output
+}
+
+type dryRunProcess struct {
+	result Result
+}
+
+func (p *dryRunProcess) Wait() <-chan Result {
+	resultCh := make(chan Result, 1)
+	resultCh <- p.result
+	return resultCh
+}
+
+func (p *dryRunProcess) TerminateNicely(_ time.Duration) error { return nil }
+
+func (p *dryRunProcess) PID() int { return 0 }
+
+func (p *dryRunProcess) Signal(_ os.Signal) error { return nil }
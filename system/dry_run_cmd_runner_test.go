@@ -0,0 +1,151 @@
+package system_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry/bosh-utils/logger/loggerfakes"
+	. "github.com/cloudfoundry/bosh-utils/system"
+	fakesys "github.com/cloudfoundry/bosh-utils/system/fakes"
+)
+
+var _ = Describe("DryRunCmdRunner", func() {
+	var (
+		cmdRunner *fakesys.FakeCmdRunner
+		logger    *loggerfakes.FakeLogger
+		runner    *DryRunCmdRunner
+	)
+
+	BeforeEach(func() {
+		cmdRunner = fakesys.NewFakeCmdRunner()
+		logger = &loggerfakes.FakeLogger{}
+		runner = NewDryRunCmdRunner(cmdRunner, []*regexp.Regexp{regexp.MustCompile(`^s3cr3t$`)}, logger)
+	})
+
+	It("records and logs commands instead of running them", func() {
+		stdout, stderr, exitStatus, err := runner.RunCommand("iptables", "-F")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stdout).To(BeEmpty())
+		Expect(stderr).To(BeEmpty())
+		Expect(exitStatus).To(Equal(0))
+
+		_, _, _, err = runner.RunComplexCommand(Command{
+			Name:   "mkfs",
+			Args:   []string{"/dev/sdb", "--password", "secret"},
+			Redact: func(s string) string { return s[:len(s)-len("secret")] + "***" },
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(cmdRunner.RunCommands).To(BeEmpty())
+		Expect(cmdRunner.RunComplexCommands).To(BeEmpty())
+
+		Expect(runner.Commands()).To(HaveLen(2))
+		Expect(runner.Commands()[0].Name).To(Equal("iptables"))
+		Expect(runner.Commands()[1].Args).To(Equal([]string{"/dev/sdb", "--password", "secret"}))
+
+		Expect(logger.InfoCallCount()).To(Equal(2))
+		tag, msg, args := logger.InfoArgsForCall(1)
+		Expect(tag).To(Equal("dryRunCmdRunner"))
+		Expect(fmt.Sprintf(msg, args...)).To(Equal("Not running command 'mkfs /dev/sdb --password ***' in dry run"))
+	})
+
+	It("does not log args matching the secret patterns", func() {
+		_, _, _, err := runner.RunCommand("mysql", "--password", "s3cr3t")
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = runner.RunPipeline(context.Background(), Command{Name: "echo", Args: []string{"s3cr3t"}}, Command{Name: "chpasswd"})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(logger.InfoCallCount()).To(Equal(2))
+
+		_, msg, args := logger.InfoArgsForCall(0)
+		Expect(fmt.Sprintf(msg, args...)).To(Equal("Not running command 'mysql --password <redacted>' in dry run"))
+
+		_, msg, args = logger.InfoArgsForCall(1)
+		Expect(fmt.Sprintf(msg, args...)).To(Equal("Not running pipeline 'echo <redacted> | chpasswd' in dry run"))
+	})
+
+	It("returns the results added for the full command line or the command name", func() {
+		runner.AddResult("sfdisk -l /dev/sdb", Result{Stdout: "partitions\n"})
+		runner.AddResult("sfdisk", Result{Stdout: "other", ExitStatus: 1, Error: errors.New("fake-err")})
+
+		stdout, _, _, err := runner.RunCommand("sfdisk", "-l", "/dev/sdb")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stdout).To(Equal("partitions\n"))
+
+		stdout, _, exitStatus, err := runner.RunCommand("sfdisk", "-l", "/dev/sdc")
+		Expect(err).To(MatchError("fake-err"))
+		Expect(stdout).To(Equal("other"))
+		Expect(exitStatus).To(Equal(1))
+	})
+
+	It("writes results to custom writers and line callbacks", func() {
+		runner.AddResult("ls", Result{Stdout: "a\nb\n"})
+
+		var stdout bytes.Buffer
+		var lines []string
+
+		captured, _, _, err := runner.RunComplexCommand(Command{
+			Name:         "ls",
+			Stdout:       &stdout,
+			OnStdoutLine: func(line string) { lines = append(lines, line) },
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(captured).To(BeEmpty())
+		Expect(stdout.String()).To(Equal("a\nb\n"))
+		Expect(lines).To(Equal([]string{"a", "b"}))
+	})
+
+	It("returns processes with the results of async commands", func() {
+		runner.AddResult("sleep", Result{ExitStatus: 2, Error: errors.New("fake-err")})
+
+		process, err := runner.RunComplexCommandAsyncContext(context.Background(), Command{Name: "sleep", Args: []string{"10"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		result := <-process.Wait()
+		Expect(result.ExitStatus).To(Equal(2))
+		Expect(result.Error).To(MatchError("fake-err"))
+
+		var cmdErr CommandError
+		Expect(errors.As(result.Error, &cmdErr)).To(BeTrue())
+		Expect(cmdErr.Reason).To(Equal(CommandExited))
+	})
+
+	It("does not record commands once the context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, _, _, err := runner.RunCommandContext(ctx, "iptables", "-F")
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(runner.Commands()).To(BeEmpty())
+	})
+
+	It("records the commands of pipelines", func() {
+		runner.AddResult("gzip", Result{Stdout: "compressed"})
+		runner.AddResult("tar", Result{Stdout: "archive"})
+
+		result, err := runner.RunPipeline(context.Background(), Command{Name: "tar", Args: []string{"-cf", "-"}}, Command{Name: "gzip"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Stdout).To(Equal("compressed"))
+		Expect(result.Results[0].Stdout).To(BeEmpty())
+
+		Expect(runner.Commands()).To(HaveLen(2))
+
+		tag, msg, args := logger.InfoArgsForCall(0)
+		Expect(tag).To(Equal("dryRunCmdRunner"))
+		Expect(fmt.Sprintf(msg, args...)).To(Equal("Not running pipeline 'tar -cf - | gzip' in dry run"))
+	})
+
+	It("asks the wrapped runner whether commands exist", func() {
+		cmdRunner.AvailableCommands["iptables"] = true
+
+		Expect(runner.CommandExists("iptables")).To(BeTrue())
+		Expect(runner.CommandExists("sfdisk")).To(BeFalse())
+	})
+})
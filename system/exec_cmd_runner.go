@@ -1,10 +1,12 @@
 package system
 
 import (
+	"context"
 	"os"
 	"os/exec"
 	"strings"
 
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
 )
 
@@ -17,15 +19,24 @@ func NewExecCmdRunner(logger boshlog.Logger) CmdRunner {
 }
 
 func (r execCmdRunner) RunComplexCommand(cmd Command) (string, string, int, error) {
-	process := NewExecProcess(r.buildComplexCommand(cmd), cmd.KeepAttached, cmd.Quiet, r.logger)
+	if cmd.Timeout > 0 {
+		return r.RunComplexCommandContext(context.Background(), cmd)
+	}
 
-	err := process.Start()
+	process, err := r.RunComplexCommandAsync(cmd)
 	if err != nil {
 		return "", "", -1, err
 	}
 
-	if cmd.SpawnWithLowerPriority {
-		r.lowerProcessPriority(cmd.Name, process.cmd.Process.Pid) //nolint:errcheck
+	result := <-process.Wait()
+
+	return result.Stdout, result.Stderr, result.ExitStatus, result.Error
+}
+
+func (r execCmdRunner) RunComplexCommandContext(ctx context.Context, cmd Command) (string, string, int, error) {
+	process, err := r.RunComplexCommandAsyncContext(ctx, cmd)
+	if err != nil {
+		return "", "", -1, err
 	}
 
 	result := <-process.Wait()
@@ -34,9 +45,45 @@ func (r execCmdRunner) RunComplexCommand(cmd Command) (string, string, int, erro
 }
 
 func (r execCmdRunner) RunComplexCommandAsync(cmd Command) (Process, error) {
-	process := NewExecProcess(r.buildComplexCommand(cmd), cmd.KeepAttached, cmd.Quiet, r.logger)
+	if cmd.Timeout > 0 {
+		return r.RunComplexCommandAsyncContext(context.Background(), cmd)
+	}
 
-	err := process.Start()
+	process, err := r.startProcess(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return process, nil
+}
+
+func (r execCmdRunner) RunComplexCommandAsyncContext(ctx context.Context, cmd Command) (Process, error) {
+	// Commands are not started once the context is done
+	if ctx.Err() != nil {
+		return nil, CommandError{
+			Reason:     contextErrorReason(ctx.Err()),
+			ExitStatus: -1,
+			Err:        bosherr.Errorf("Not starting command '%s'", cmd.Name),
+		}
+	}
+
+	process, err := r.startProcess(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return newContextProcess(ctx, process, cmd.Timeout, cmd.KillGracePeriod, r.logger), nil
+}
+
+func (r execCmdRunner) startProcess(cmd Command) (*execProcess, error) {
+	execCmd, err := r.buildComplexCommand(cmd)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Building command '%s'", cmd.Name)
+	}
+
+	process := newExecProcess(execCmd, cmd, r.logger)
+
+	err = process.Start()
 	if err != nil {
 		return nil, err
 	}
@@ -52,6 +99,10 @@ func (r execCmdRunner) RunCommand(cmdName string, args ...string) (string, strin
 	return r.RunComplexCommand(Command{Name: cmdName, Args: args})
 }
 
+func (r execCmdRunner) RunCommandContext(ctx context.Context, cmdName string, args ...string) (string, string, int, error) {
+	return r.RunComplexCommandContext(ctx, Command{Name: cmdName, Args: args})
+}
+
 func (r execCmdRunner) RunCommandQuietly(cmdName string, args ...string) (string, string, int, error) {
 	return r.RunComplexCommand(Command{Name: cmdName, Args: args, Quiet: true})
 }
@@ -70,7 +121,7 @@ func (r execCmdRunner) CommandExists(cmdName string) bool {
 	return err == nil
 }
 
-func (r execCmdRunner) buildComplexCommand(cmd Command) *exec.Cmd {
+func (r execCmdRunner) buildComplexCommand(cmd Command) (*exec.Cmd, error) {
 	execCmd := newExecCmd(cmd.Name, cmd.Args...)
 
 	if cmd.Stdin != nil {
@@ -87,9 +138,28 @@ func (r execCmdRunner) buildComplexCommand(cmd Command) *exec.Cmd {
 
 	execCmd.Dir = cmd.WorkingDir
 
-	execCmd.Env = mergeEnv(os.Environ(), cmd.Env)
+	userEnv, err := setCommandUser(execCmd, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	sysEnv := os.Environ()
+	if cmd.CleanEnv {
+		sysEnv = cleanEnv(sysEnv)
+	}
+
+	// Variables of the command override those describing its user
+	env := map[string]string{}
+	for k, v := range userEnv {
+		env[k] = v
+	}
+	for k, v := range cmd.Env {
+		env[k] = v
+	}
+
+	execCmd.Env = mergeEnv(sysEnv, env)
 
-	return execCmd
+	return execCmd, nil
 }
 
 func newExecCmd(name string, args ...string) *exec.Cmd {
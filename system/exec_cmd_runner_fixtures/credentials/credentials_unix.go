@@ -0,0 +1,23 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	groups, err := os.Getgroups()
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("uid=%d\n", os.Getuid())
+	fmt.Printf("gid=%d\n", os.Getgid())
+	fmt.Printf("groups=%v\n", groups)
+
+	for _, kv := range os.Environ() {
+		fmt.Println(kv)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	for _, kv := range os.Environ() {
+		fmt.Println(kv)
+	}
+}
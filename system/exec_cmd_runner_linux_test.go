@@ -0,0 +1,223 @@
+package system_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+	. "github.com/cloudfoundry/bosh-utils/system"
+)
+
+var _ = Describe("execCmdRunner on Linux", func() {
+	var (
+		runner CmdRunner
+	)
+
+	BeforeEach(func() {
+		runner = NewExecCmdRunner(boshlog.NewLogger(boshlog.LevelNone))
+	})
+
+	Describe("PseudoTerminal", func() {
+		It("runs the command in a terminal of the given size and merges its output", func() {
+			cmd := Command{
+				Name:           "bash",
+				Args:           []string{"-c", "test -t 0 && test -t 1 && test -t 2 && echo tty; stty size; echo err >&2"},
+				PseudoTerminal: &PseudoTerminal{Rows: 40, Cols: 100},
+			}
+
+			stdout, stderr, _, err := runner.RunComplexCommand(cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("tty\r\n40 100\r\nerr\r\n"))
+			Expect(stderr).To(BeEmpty())
+		})
+
+		It("defaults to 24 rows and 80 columns", func() {
+			stdout, _, _, err := runner.RunComplexCommand(Command{Name: "stty", Args: []string{"size"}, PseudoTerminal: &PseudoTerminal{}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("24 80\r\n"))
+		})
+
+		It("writes stdin to the terminal and passes output to custom writers", func() {
+			stdoutBuffer := gbytes.NewBuffer()
+			var lines []string
+
+			cmd := Command{
+				Name:           "bash",
+				Args:           []string{"-c", "read -r answer; echo \"answer=$answer\"; cat"},
+				Stdin:          strings.NewReader("yes\n"),
+				Stdout:         stdoutBuffer,
+				OnStdoutLine:   func(line string) { lines = append(lines, line) },
+				PseudoTerminal: &PseudoTerminal{},
+			}
+
+			_, _, _, err := runner.RunComplexCommand(cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(stdoutBuffer.Contents())).To(Equal("answer=yes\r\n"))
+			Expect(lines).To(ContainElement("answer=yes"))
+		})
+
+		It("ends stdin without a trailing newline", func() {
+			cmd := Command{
+				Name:           "bash",
+				Args:           []string{"-c", "echo \"input=$(cat)\""},
+				Stdin:          strings.NewReader("no newline"),
+				PseudoTerminal: &PseudoTerminal{},
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			stdout, _, _, err := runner.RunComplexCommandContext(ctx, cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("input=no newline\r\n"))
+		})
+
+		It("terminates the session of the command", func() {
+			process, err := runner.RunComplexCommandAsync(Command{
+				Name:           "bash",
+				Args:           []string{"-c", "sleep 60 & sleep 60"},
+				PseudoTerminal: &PseudoTerminal{},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			waitCh := process.Wait()
+			Expect(process.TerminateNicely(10 * time.Second)).To(Succeed())
+
+			var result Result
+			Eventually(waitCh, 5*time.Second).Should(Receive(&result))
+			Expect(result.Signal).ToNot(BeNil())
+		})
+	})
+
+	Describe("ResourceLimits", func() {
+		limitsCommand := func(script string, limits ResourceLimits) Command {
+			return Command{
+				Name:           "bash",
+				Args:           []string{"-c", script},
+				ResourceLimits: limits,
+			}
+		}
+
+		It("limits open files, CPU time and core size of the command", func() {
+			cmd := limitsCommand("ulimit -Sn; ulimit -Hn; ulimit -t; ulimit -c", ResourceLimits{
+				OpenFiles:        64,
+				CPUTime:          1500 * time.Millisecond,
+				DisableCoreDumps: true,
+			})
+
+			stdout, _, _, err := runner.RunComplexCommand(cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("64\n64\n2\n0\n"))
+		})
+
+		It("limits processes the command forks right after it starts", func() {
+			cmd := limitsCommand("bash -c 'ulimit -Sn' & wait", ResourceLimits{OpenFiles: 64})
+
+			stdout, _, _, err := runner.RunComplexCommand(cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("64\n"))
+		})
+
+		It("passes the args and env of the command on unchanged", func() {
+			cmd := limitsCommand(`echo "$0 $1 $FOO"; env | grep -c BOSH_UTILS || true`, ResourceLimits{OpenFiles: 64})
+			cmd.Args = append(cmd.Args, "fake-arg0", "fake-arg1")
+			cmd.Env = map[string]string{"FOO": "bar"}
+
+			stdout, _, _, err := runner.RunComplexCommand(cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("fake-arg0 fake-arg1 bar\n0\n"))
+		})
+
+		It("does not pass the pipe it waits on for the limits to the command", func() {
+			cmd := limitsCommand("if [ -e /dev/fd/3 ]; then echo open; else echo closed; fi", ResourceLimits{OpenFiles: 64})
+
+			stdout, _, _, err := runner.RunComplexCommand(cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("closed\n"))
+		})
+
+		It("fails to start the command when its limits cannot be set", func() {
+			// Open files cannot be limited above nr_open, even by root
+			nrOpen, err := os.ReadFile("/proc/sys/fs/nr_open")
+			Expect(err).ToNot(HaveOccurred())
+
+			maxOpenFiles, err := strconv.ParseUint(strings.TrimSpace(string(nrOpen)), 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, _, _, err = runner.RunComplexCommand(limitsCommand("true", ResourceLimits{OpenFiles: maxOpenFiles + 1}))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Limiting open files"))
+		})
+
+		It("limits the address space of the command", func() {
+			cmd := limitsCommand("ulimit -v", ResourceLimits{AddressSpace: 4 * 1024 * 1024 * 1024})
+
+			stdout, _, _, err := runner.RunComplexCommand(cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal(fmt.Sprintf("%d\n", 4*1024*1024)))
+		})
+
+		It("leaves other limits of the parent in place", func() {
+			parentStdout, _, _, err := runner.RunComplexCommand(limitsCommand("ulimit -v", ResourceLimits{}))
+			Expect(err).ToNot(HaveOccurred())
+
+			stdout, _, _, err := runner.RunComplexCommand(limitsCommand("ulimit -v", ResourceLimits{OpenFiles: 64}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal(parentStdout))
+		})
+
+		Context("with a cgroup", func() {
+			var cgroupPath string
+
+			BeforeEach(func() {
+				cgroupPath = fmt.Sprintf("bosh-utils-test-%d", GinkgoParallelProcess())
+			})
+
+			It("runs the command in the cgroup and removes the cgroup afterwards, or fails cleanly", func() {
+				cmd := Command{
+					Name:           "cat",
+					Args:           []string{"/proc/self/cgroup"},
+					ResourceLimits: ResourceLimits{Cgroup: &CgroupLimits{Path: cgroupPath}},
+				}
+
+				stdout, _, _, err := runner.RunComplexCommand(cmd)
+
+				if !isCgroup2Mounted() {
+					Expect(err).To(HaveOccurred())
+					Expect(err.Error()).To(ContainSubstring("'/sys/fs/cgroup' is not a cgroup v2 file system"))
+					return
+				}
+
+				if err != nil && strings.Contains(err.Error(), "permission denied") {
+					Skip("Creating cgroups requires permission to write to /sys/fs/cgroup")
+				}
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(stdout).To(HaveSuffix("/" + cgroupPath + "\n"))
+				Expect("/sys/fs/cgroup/" + cgroupPath).ToNot(BeAnExistingFile())
+			})
+		})
+	})
+})
+
+func isCgroup2Mounted() bool {
+	mounts, err := os.ReadFile("/proc/mounts")
+	Expect(err).ToNot(HaveOccurred())
+
+	for _, line := range strings.Split(string(mounts), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 2 && fields[1] == "/sys/fs/cgroup" && fields[2] == "cgroup2" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -4,6 +4,7 @@
 package system
 
 import (
+	"slices"
 	"strings"
 )
 
@@ -25,3 +26,16 @@ func mergeEnv(sysEnv []string, cmdEnv map[string]string) []string {
 	}
 	return env
 }
+
+// cleanEnvKeys are kept from the system environment of commands with CleanEnv
+var cleanEnvKeys = []string{"PATH", "HOME", "USER", "LOGNAME"}
+
+func cleanEnv(sysEnv []string) []string {
+	var env []string
+	for _, s := range sysEnv {
+		if n := strings.IndexByte(s, '='); n != -1 && slices.Contains(cleanEnvKeys, s[:n]) {
+			env = append(env, s)
+		}
+	}
+	return env
+}
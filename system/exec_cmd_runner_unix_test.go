@@ -3,14 +3,19 @@
 package system_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
 	"github.com/cloudfoundry/bosh-utils/logger/loggerfakes"
@@ -203,6 +208,201 @@ var _ = Describe("execCmdRunner", func() {
 		})
 	})
 
+	Describe("running as another user", func() {
+		var credentialsCmdPath string
+
+		BeforeEach(func() {
+			if os.Getuid() != 0 {
+				Skip("Running commands as another user requires root")
+			}
+
+			// The fixture must be executable by the other user
+			dir := GinkgoT().TempDir()
+			Expect(os.Chmod(dir, 0755)).To(Succeed())
+
+			content, err := os.ReadFile(credentialsPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			credentialsCmdPath = filepath.Join(dir, "credentials")
+			Expect(os.WriteFile(credentialsCmdPath, content, 0755)).To(Succeed())
+		})
+
+		It("runs the command as the user in its groups and describes the user in the environment", func() {
+			stdout, _, _, err := runner.RunComplexCommand(Command{Name: credentialsCmdPath, User: "daemon", WorkingDir: "/"})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(stdout).To(ContainSubstring("uid=1\n"))
+			Expect(stdout).To(ContainSubstring("gid=1\n"))
+			Expect(stdout).To(ContainSubstring("groups=[1]\n"))
+
+			env := parseEnvFields(stdout, false)
+			Expect(env["HOME"]).To(Equal("/usr/sbin"))
+			Expect(env["USER"]).To(Equal("daemon"))
+			Expect(env["LOGNAME"]).To(Equal("daemon"))
+			Expect(env).To(HaveKey("PATH"))
+		})
+
+		It("runs the command in the given group and supplementary groups", func() {
+			cmd := Command{
+				Name:                credentialsCmdPath,
+				User:                "1",
+				Group:               "2",
+				SupplementaryGroups: []string{"daemon", "3"},
+				Env:                 map[string]string{"HOME": "/tmp"},
+				WorkingDir:          "/",
+			}
+
+			stdout, _, _, err := runner.RunComplexCommand(cmd)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(stdout).To(ContainSubstring("uid=1\n"))
+			Expect(stdout).To(ContainSubstring("gid=2\n"))
+			Expect(stdout).To(ContainSubstring("groups=[1 3]\n"))
+
+			env := parseEnvFields(stdout, false)
+			Expect(env["HOME"]).To(Equal("/tmp"))
+			Expect(env["USER"]).To(Equal("daemon"))
+		})
+
+		It("returns an error when the user does not exist", func() {
+			_, _, _, err := runner.RunComplexCommand(Command{Name: credentialsCmdPath, User: "garbage-foo"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Looking up user 'garbage-foo'"))
+		})
+
+		It("returns an error when the group does not exist", func() {
+			_, _, _, err := runner.RunComplexCommand(Command{Name: credentialsCmdPath, User: "daemon", Group: "garbage-foo"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Looking up group 'garbage-foo'"))
+		})
+	})
+
+	Describe("CleanEnv", func() {
+		It("only passes PATH and the variables describing the user to the command", func() {
+			GinkgoT().Setenv("BOSH_UTILS_TEST_VAR", "inherited")
+
+			stdout, _, _, err := runner.RunComplexCommand(Command{
+				Name:     credentialsPath,
+				Env:      map[string]string{"FOO": "BAR"},
+				CleanEnv: true,
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			env := parseEnvFields(stdout, false)
+			for _, credential := range []string{"uid", "gid", "groups"} {
+				delete(env, credential)
+			}
+
+			Expect(env).ToNot(HaveKey("BOSH_UTILS_TEST_VAR"))
+			Expect(env).To(HaveKeyWithValue("FOO", "BAR"))
+			Expect(env).To(HaveKeyWithValue("PATH", os.Getenv("PATH")))
+			for key := range env {
+				Expect(key).To(BeElementOf("PATH", "HOME", "USER", "LOGNAME", "FOO"))
+			}
+		})
+
+		It("returns an error for groups without a user", func() {
+			_, _, _, err := runner.RunComplexCommand(Command{Name: credentialsPath, Group: "daemon"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Running command with groups requires a user"))
+		})
+	})
+
+	Describe("output options", func() {
+		It("keeps the beginning and the end of output larger than MaxOutputSize", func() {
+			cmd := Command{
+				Name:          "bash",
+				Args:          []string{"-c", "printf 'begin-'; head -c 1000 /dev/zero | tr '\\0' x; printf -- '-end'; printf 'err%.0s' {1..100} >&2"},
+				MaxOutputSize: 20,
+			}
+
+			stdout, stderr, _, err := runner.RunComplexCommand(cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("begin-xxxx\n[... 990 bytes truncated ...]\nxxxxxx-end"))
+			Expect(stderr).To(HavePrefix("errerrerre\n[... 280 bytes truncated ...]\n"))
+			Expect(stderr).To(HaveSuffix("rrerrerr"))
+		})
+
+		It("captures output smaller than MaxOutputSize in full", func() {
+			stdout, _, _, err := runner.RunComplexCommand(Command{Name: "echo", Args: []string{"Hello World!"}, MaxOutputSize: 100})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("Hello World!\n"))
+		})
+
+		It("calls line callbacks as output is written, including to custom writers", func() {
+			var stdoutLines, stderrLines []string
+			stdoutBuffer := gbytes.NewBuffer()
+
+			cmd := Command{
+				Name:         "bash",
+				Args:         []string{"-c", "echo one; echo two >&2; printf 'three\\nfour'"},
+				Stdout:       stdoutBuffer,
+				OnStdoutLine: func(line string) { stdoutLines = append(stdoutLines, line) },
+				OnStderrLine: func(line string) { stderrLines = append(stderrLines, line) },
+			}
+
+			_, stderr, _, err := runner.RunComplexCommand(cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdoutLines).To(Equal([]string{"one", "three", "four"}))
+			Expect(stderrLines).To(Equal([]string{"two"}))
+			Expect(string(stdoutBuffer.Contents())).To(Equal("one\nthree\nfour"))
+			Expect(stderr).To(Equal("two\n"))
+		})
+
+		It("passes on long lines in parts of MaxOutputSize", func() {
+			var stdoutLines []string
+
+			cmd := Command{
+				Name:          "bash",
+				Args:          []string{"-c", "head -c 25 /dev/zero | tr '\\0' x"},
+				MaxOutputSize: 10,
+				OnStdoutLine:  func(line string) { stdoutLines = append(stdoutLines, line) },
+			}
+
+			_, _, _, err := runner.RunComplexCommand(cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdoutLines).To(Equal([]string{"xxxxxxxxxx", "xxxxxxxxxx", "xxxxx"}))
+		})
+
+		It("passes on long terminated lines in parts of MaxOutputSize", func() {
+			var stdoutLines []string
+
+			cmd := Command{
+				Name:          "bash",
+				Args:          []string{"-c", "printf 'xxxxxxxxxxxxxxxxxxxxxxxxx\\nend\\n'"},
+				MaxOutputSize: 10,
+				OnStdoutLine:  func(line string) { stdoutLines = append(stdoutLines, line) },
+			}
+
+			_, _, _, err := runner.RunComplexCommand(cmd)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdoutLines).To(Equal([]string{"xxxxxxxxxx", "xxxxxxxxxx", "xxxxx", "end"}))
+		})
+
+		It("redacts the command line and output before logging them and returning errors", func() {
+			logger := &loggerfakes.FakeLogger{}
+			runner = NewExecCmdRunner(logger)
+
+			cmd := Command{
+				Name:   "bash",
+				Args:   []string{"-c", "echo password=s3cret; exit 1", "s3cret"},
+				Redact: func(s string) string { return strings.ReplaceAll(s, "s3cret", "<redacted>") },
+			}
+
+			stdout, _, _, err := runner.RunComplexCommand(cmd)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).ToNot(ContainSubstring("s3cret"))
+			Expect(err.Error()).To(ContainSubstring("password=<redacted>"))
+
+			Expect(stdout).To(Equal("password=s3cret\n"))
+
+			for i := 0; i < logger.DebugCallCount(); i++ {
+				_, msg, args := logger.DebugArgsForCall(i)
+				Expect(fmt.Sprintf(msg, args...)).ToNot(ContainSubstring("s3cret"))
+			}
+		})
+	})
+
 	Describe("RunComplexCommandAsync", func() {
 		It("populates stdout and stderr", func() {
 			cmd := unixCommand("ls")
@@ -238,6 +438,54 @@ var _ = Describe("execCmdRunner", func() {
 			Expect(result.ExitStatus).To(Equal(ErrExitCode))
 		})
 
+		It("reports start and end times and resource usage", func() {
+			startedAt := time.Now()
+
+			process, err := runner.RunComplexCommandAsync(Command{
+				Name: "bash",
+				Args: []string{"-c", "sleep 0.2; head -c 20000000 /dev/zero | tail -c 1 >/dev/null"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			result := <-process.Wait()
+			Expect(result.Error).ToNot(HaveOccurred())
+			Expect(result.Signal).To(BeNil())
+
+			Expect(result.StartTime).To(BeTemporally(">=", startedAt))
+			Expect(result.EndTime).To(BeTemporally(">", result.StartTime))
+			Expect(result.Duration()).To(BeNumerically(">=", 200*time.Millisecond))
+
+			Expect(result.Usage.MaxRSS).To(BeNumerically(">", 1024*1024))
+			Expect(result.Usage.UserTime + result.Usage.SystemTime).To(BeNumerically(">", 0))
+		})
+
+		It("exposes the PID and sends signals to the process", func() {
+			startedCh := make(chan struct{})
+
+			process, err := runner.RunComplexCommandAsync(Command{
+				Name:         "bash",
+				Args:         []string{"-c", "echo $$; exec sleep 60"},
+				OnStdoutLine: func(string) { close(startedCh) },
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(process.PID()).To(BeNumerically(">", 0))
+
+			waitCh := process.Wait()
+			Eventually(startedCh).Should(BeClosed())
+			Expect(process.Signal(syscall.SIGUSR1)).To(Succeed())
+
+			result := <-waitCh
+			Expect(result.Stdout).To(Equal(fmt.Sprintf("%d\n", process.PID())))
+			Expect(result.Signal).To(Equal(syscall.SIGUSR1))
+			Expect(result.ExitStatus).To(Equal(128 + int(syscall.SIGUSR1)))
+
+			var execErr ExecError
+			Expect(errors.As(result.Error, &execErr)).To(BeTrue())
+			Expect(execErr.Signal).To(Equal(syscall.SIGUSR1))
+			Expect(execErr.ExitStatus).To(Equal(128 + int(syscall.SIGUSR1)))
+		})
+
 		It("allows setting custom env variable in addition to inheriting process env variables", func() {
 			cmd := unixCommand("env")
 
@@ -341,6 +589,187 @@ var _ = Describe("execCmdRunner", func() {
 		})
 	})
 
+	Describe("RunComplexCommandContext", func() {
+		It("returns nil error when the command succeeds", func() {
+			stdout, _, status, err := runner.RunComplexCommandContext(context.Background(), unixCommand("echo"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("Hello World!\n"))
+			Expect(status).To(Equal(0))
+		})
+
+		It("returns a CommandError when the command exits with non-0 status", func() {
+			_, _, status, err := runner.RunComplexCommandContext(context.Background(), unixCommand("exit"))
+			Expect(err).To(HaveOccurred())
+			Expect(status).To(Equal(ErrExitCode))
+
+			var execErr ExecError
+			Expect(errors.As(err, &execErr)).To(BeTrue())
+			Expect(execErr.ExitStatus).To(Equal(ErrExitCode))
+			Expect(execErr.Signal).To(BeNil())
+
+			var cmdErr CommandError
+			Expect(errors.As(err, &cmdErr)).To(BeTrue())
+			Expect(cmdErr.Reason).To(Equal(CommandExited))
+			Expect(cmdErr.ExitStatus).To(Equal(ErrExitCode))
+			Expect(err.Error()).To(Equal(fmt.Sprintf("Running command: 'bash -c exit %d', stdout: '', stderr: '': exit status %d", ErrExitCode, ErrExitCode)))
+		})
+
+		It("terminates the process group when the context is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(500*time.Millisecond, cancel)
+
+			cmd := Command{
+				Name: "bash",
+				Args: []string{"-c", "trap 'echo terminated; exit 3' TERM; sleep 60 & wait"},
+			}
+
+			startedAt := time.Now()
+			stdout, _, status, err := runner.RunComplexCommandContext(ctx, cmd)
+			Expect(time.Since(startedAt)).To(BeNumerically("<", 10*time.Second))
+
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeFalse())
+			Expect(err.Error()).To(HavePrefix("Command canceled (exit status 3): Running command: 'bash -c"))
+			Expect(stdout).To(Equal("terminated\n"))
+			Expect(status).To(Equal(3))
+		})
+
+		It("kills the process group after the grace period when it ignores SIGTERM", func() {
+			cmd := Command{
+				Name:            "bash",
+				Args:            []string{"-c", "trap '' TERM; sleep 60 & wait"},
+				Timeout:         500 * time.Millisecond,
+				KillGracePeriod: 500 * time.Millisecond,
+			}
+
+			_, _, status, err := runner.RunComplexCommandContext(context.Background(), cmd)
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+			Expect(status).To(Equal(128 + int(syscall.SIGKILL)))
+
+			var cmdErr CommandError
+			Expect(errors.As(err, &cmdErr)).To(BeTrue())
+			Expect(cmdErr.Reason).To(Equal(CommandTimedOut))
+		})
+
+		It("reports a context deadline as a timeout", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			_, _, _, err := runner.RunCommandContext(ctx, "sleep", "60")
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		})
+
+		It("does not start the command when the context is already done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, _, status, err := runner.RunComplexCommandContext(ctx, Command{Name: "bash", Args: []string{"-c", "exit 0"}})
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+			Expect(err.Error()).To(Equal("Command canceled (exit status -1): Not starting command 'bash'"))
+			Expect(status).To(Equal(-1))
+		})
+	})
+
+	Describe("RunPipeline", func() {
+		It("connects the stdout of every command to the stdin of the next", func() {
+			result, err := runner.RunPipeline(context.Background(),
+				Command{Name: "cat", Stdin: strings.NewReader("b\na\n")},
+				Command{Name: "sort"},
+				Command{Name: "tr", Args: []string{"a-z", "A-Z"}},
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Stdout).To(Equal("A\nB\n"))
+			Expect(result.ExitStatus).To(Equal(0))
+
+			Expect(result.Results).To(HaveLen(3))
+			Expect(result.Results[0].Stdout).To(BeEmpty())
+			Expect(result.Results[2].Stdout).To(Equal("A\nB\n"))
+		})
+
+		It("captures stderr of every command", func() {
+			result, err := runner.RunPipeline(context.Background(),
+				Command{Name: "bash", Args: []string{"-c", "echo one >&2; echo out"}},
+				Command{Name: "bash", Args: []string{"-c", "cat; echo two >&2"}},
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Stdout).To(Equal("out\n"))
+			Expect(result.Results[0].Stderr).To(Equal("one\n"))
+			Expect(result.Results[1].Stderr).To(Equal("two\n"))
+		})
+
+		It("reports the first command that did not succeed", func() {
+			result, err := runner.RunPipeline(context.Background(),
+				Command{Name: "bash", Args: []string{"-c", "echo x; exit 3"}},
+				Command{Name: "cat"},
+				Command{Name: "bash", Args: []string{"-c", "cat; exit 4"}},
+			)
+			Expect(err).To(HaveOccurred())
+			Expect(result.Stdout).To(Equal("x\n"))
+			Expect(result.ExitStatus).To(Equal(3))
+			Expect(result.Results[2].ExitStatus).To(Equal(4))
+
+			var cmdErr CommandError
+			Expect(errors.As(err, &cmdErr)).To(BeTrue())
+			Expect(cmdErr.Reason).To(Equal(CommandExited))
+			Expect(err.Error()).To(ContainSubstring("Running command: 'bash -c echo x; exit 3'"))
+		})
+
+		It("terminates all commands when the context is done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			startedAt := time.Now()
+			result, err := runner.RunPipeline(ctx,
+				Command{Name: "sleep", Args: []string{"60"}},
+				Command{Name: "sleep", Args: []string{"60"}},
+			)
+			Expect(time.Since(startedAt)).To(BeNumerically("<", 10*time.Second))
+
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+			for _, stageResult := range result.Results {
+				Expect(stageResult.Signal).To(Equal(syscall.SIGTERM))
+			}
+		})
+
+		It("kills started commands when a command cannot be started", func() {
+			startedAt := time.Now()
+			_, err := runner.RunPipeline(context.Background(),
+				Command{Name: "sleep", Args: []string{"60"}},
+				Command{Name: "something that does not exist"},
+			)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Starting command 'something that does not exist'"))
+			Expect(time.Since(startedAt)).To(BeNumerically("<", 10*time.Second))
+		})
+
+		It("returns an error without commands", func() {
+			_, err := runner.RunPipeline(context.Background())
+			Expect(err).To(MatchError("Running pipeline: No commands"))
+		})
+	})
+
+	Describe("Timeout", func() {
+		It("terminates commands run without a context", func() {
+			_, _, _, err := runner.RunComplexCommand(Command{Name: "sleep", Args: []string{"60"}, Timeout: 500 * time.Millisecond})
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		})
+
+		It("terminates async commands", func() {
+			process, err := runner.RunComplexCommandAsync(Command{Name: "sleep", Args: []string{"60"}, Timeout: 500 * time.Millisecond})
+			Expect(err).ToNot(HaveOccurred())
+
+			result := <-process.Wait()
+			Expect(errors.Is(result.Error, context.DeadlineExceeded)).To(BeTrue())
+			Expect(result.ExitStatus).To(Equal(128 + int(syscall.SIGTERM)))
+		})
+
+		It("does not affect commands that finish in time", func() {
+			stdout, _, _, err := runner.RunComplexCommand(Command{Name: "echo", Args: []string{"done"}, Timeout: time.Minute})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("done\n"))
+		})
+	})
+
 	Describe("CommandExists", func() {
 		It("command exists", func() {
 			Expect(runner.CommandExists("env")).To(BeTrue())
@@ -0,0 +1,74 @@
+//go:build !windows
+
+package system
+
+import (
+	"os/exec"
+	"syscall"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+// setCommandUser makes execCmd run as the user and groups of cmd,
+// and returns the environment variables describing that user
+func setCommandUser(execCmd *exec.Cmd, cmd Command) (map[string]string, error) {
+	if cmd.User == "" {
+		if cmd.Group != "" || len(cmd.SupplementaryGroups) > 0 {
+			return nil, bosherr.Error("Running command with groups requires a user")
+		}
+		return nil, nil
+	}
+
+	name, err := lookupUserName(cmd.User)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Looking up user '%s'", cmd.User)
+	}
+
+	uid, err := lookupUserID(name)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Looking up user '%s'", cmd.User)
+	}
+
+	group := cmd.Group
+	if group == "" {
+		group, err = lookupPrimaryGroupID(name)
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Looking up group of user '%s'", cmd.User)
+		}
+	}
+
+	gid, err := lookupGroupID(group)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Looking up group '%s'", group)
+	}
+
+	var groups []uint32
+
+	if cmd.SupplementaryGroups == nil {
+		groups, err = lookupGroupIDs(name)
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Looking up groups of user '%s'", cmd.User)
+		}
+	} else {
+		for _, supplementaryGroup := range cmd.SupplementaryGroups {
+			id, err := lookupGroupID(supplementaryGroup)
+			if err != nil {
+				return nil, bosherr.WrapErrorf(err, "Looking up group '%s'", supplementaryGroup)
+			}
+			groups = append(groups, id)
+		}
+	}
+
+	homeDir, err := lookupHomeDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if execCmd.SysProcAttr == nil {
+		execCmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	execCmd.SysProcAttr.Credential = &syscall.Credential{Uid: uid, Gid: gid, Groups: groups}
+
+	return map[string]string{"HOME": homeDir, "USER": name, "LOGNAME": name}, nil
+}
@@ -0,0 +1,14 @@
+package system
+
+import (
+	"os/exec"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+func setCommandUser(execCmd *exec.Cmd, cmd Command) (map[string]string, error) {
+	if cmd.User != "" || cmd.Group != "" || len(cmd.SupplementaryGroups) > 0 {
+		return nil, bosherr.Error("Running commands as another user is not supported on Windows")
+	}
+	return nil, nil
+}
@@ -1,6 +1,7 @@
 package system
 
 import (
+	"slices"
 	"sort"
 	"strings"
 )
@@ -41,3 +42,21 @@ func mergeEnv(sysEnv []string, cmdEnv map[string]string) []string {
 	}
 	return env
 }
+
+// cleanEnvKeys are kept from the system environment of commands with CleanEnv,
+// since many programs do not run on Windows without them
+var cleanEnvKeys = []string{
+	"PATH", "PATHEXT", "SYSTEMROOT", "SYSTEMDRIVE", "COMSPEC", "WINDIR", "TEMP", "TMP",
+	"USERNAME", "USERPROFILE", "HOMEDRIVE", "HOMEPATH", "APPDATA", "LOCALAPPDATA",
+}
+
+// cleanEnv compares keys case-insensitively like mergeEnv
+func cleanEnv(sysEnv []string) []string {
+	var env []string
+	for _, kv := range sysEnv {
+		if n := strings.IndexByte(kv, '='); n != -1 && slices.Contains(cleanEnvKeys, strings.ToUpper(kv[:n])) {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
@@ -2,6 +2,7 @@ package system
 
 import (
 	"fmt"
+	"os"
 	"strings"
 )
 
@@ -14,6 +15,12 @@ type ExecError struct {
 	Command string
 	StdOut  string
 	StdErr  string
+
+	// ExitStatus is 128 plus the signal when the command was terminated by one
+	ExitStatus int
+
+	// Signal that terminated the command; nil when the command exited
+	Signal os.Signal
 }
 
 func NewExecError(cmd, stdout, stderr string) ExecError {
@@ -21,6 +28,8 @@ func NewExecError(cmd, stdout, stderr string) ExecError {
 		Command: cmd,
 		StdOut:  stdout,
 		StdErr:  stderr,
+
+		ExitStatus: -1,
 	}
 }
 
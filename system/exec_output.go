@@ -0,0 +1,144 @@
+package system
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+const (
+	execOutputTruncatedMarkerFmt = "\n[... %d bytes truncated ...]\n"
+
+	// defaultMaxLineSize limits lines passed to line callbacks
+	// when the output of a command is not limited
+	defaultMaxLineSize = 1024 * 1024
+)
+
+// boundedBuffer captures at most maxSize bytes of output, keeping the
+// beginning and the end of it when more is written. It captures everything
+// when maxSize is not positive.
+type boundedBuffer struct {
+	maxSize int
+
+	head bytes.Buffer
+	tail []byte
+
+	truncated int64
+}
+
+func newBoundedBuffer(maxSize int) *boundedBuffer {
+	return &boundedBuffer{maxSize: maxSize}
+}
+
+func (b *boundedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+
+	if b.maxSize <= 0 {
+		return b.head.Write(p)
+	}
+
+	headSize := b.maxSize / 2
+	tailSize := b.maxSize - headSize
+
+	if room := headSize - b.head.Len(); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		b.head.Write(p[:room])
+		p = p[room:]
+	}
+
+	b.tail = append(b.tail, p...)
+
+	// Trim once the tail doubled to avoid copying it on every write
+	if len(b.tail) > 2*tailSize {
+		b.trimTail(tailSize)
+	}
+
+	return n, nil
+}
+
+func (b *boundedBuffer) String() string {
+	if b.maxSize <= 0 {
+		return b.head.String()
+	}
+
+	b.trimTail(b.maxSize - b.maxSize/2)
+
+	if b.truncated == 0 {
+		return b.head.String() + string(b.tail)
+	}
+
+	return b.head.String() + fmt.Sprintf(execOutputTruncatedMarkerFmt, b.truncated) + string(b.tail)
+}
+
+func (b *boundedBuffer) trimTail(tailSize int) {
+	if excess := len(b.tail) - tailSize; excess > 0 {
+		b.truncated += int64(excess)
+		b.tail = append([]byte{}, b.tail[excess:]...)
+	}
+}
+
+// lineWriter calls onLine with every line written to it, without the line
+// separator, as soon as the line is complete. Lines longer than maxLineSize
+// are passed on in parts of maxLineSize bytes, so that output without
+// line separators is not buffered indefinitely.
+type lineWriter struct {
+	onLine      func(line string)
+	maxLineSize int
+
+	partial []byte
+	lock    sync.Mutex
+}
+
+// newLineWriter limits lines to maxOutputSize like boundedBuffer,
+// or to defaultMaxLineSize when maxOutputSize is not positive
+func newLineWriter(onLine func(line string), maxOutputSize int) *lineWriter {
+	maxLineSize := maxOutputSize
+	if maxLineSize <= 0 {
+		maxLineSize = defaultMaxLineSize
+	}
+
+	return &lineWriter{onLine: onLine, maxLineSize: maxLineSize}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.partial = append(w.partial, p...)
+
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := bytes.TrimSuffix(w.partial[:i], []byte("\r"))
+		for len(line) > w.maxLineSize {
+			w.onLine(string(line[:w.maxLineSize]))
+			line = line[w.maxLineSize:]
+		}
+
+		w.onLine(string(line))
+		w.partial = w.partial[i+1:]
+	}
+
+	for len(w.partial) >= w.maxLineSize {
+		w.onLine(string(w.partial[:w.maxLineSize]))
+		w.partial = w.partial[w.maxLineSize:]
+	}
+
+	return len(p), nil
+}
+
+// Flush calls onLine with the last line if it was not terminated
+func (w *lineWriter) Flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if len(w.partial) > 0 {
+		w.onLine(string(w.partial))
+		w.partial = nil
+	}
+}
@@ -0,0 +1,224 @@
+package system
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+func (r execCmdRunner) RunPipeline(ctx context.Context, cmds ...Command) (PipelineResult, error) {
+	if len(cmds) == 0 {
+		return PipelineResult{}, bosherr.Error("Running pipeline: No commands")
+	}
+
+	if cmds[0].Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cmds[0].Timeout)
+		defer cancel()
+	}
+
+	if ctx.Err() != nil {
+		return PipelineResult{ExitStatus: -1}, CommandError{
+			Reason:     contextErrorReason(ctx.Err()),
+			ExitStatus: -1,
+			Err:        bosherr.Errorf("Not starting pipeline '%s'", pipelineString(cmds)),
+		}
+	}
+
+	stages, err := r.startPipeline(cmds)
+	if err != nil {
+		return PipelineResult{ExitStatus: -1}, err
+	}
+
+	resultChs := make([]<-chan Result, len(stages))
+	for i, stage := range stages {
+		resultChs[i] = stage.wait()
+	}
+
+	doneCh := make(chan []Result, 1)
+
+	go func() {
+		results := make([]Result, len(resultChs))
+		for i, resultCh := range resultChs {
+			results[i] = <-resultCh
+		}
+		doneCh <- results
+	}()
+
+	reason := CommandExited
+	var results []Result
+
+	select {
+	case results = <-doneCh:
+	case <-ctx.Done():
+		reason = contextErrorReason(ctx.Err())
+		r.logger.Debug(execProcessLogTag, "Terminating pipeline that %s", reason)
+
+		killGracePeriod := cmds[0].KillGracePeriod
+		if killGracePeriod <= 0 {
+			killGracePeriod = DefaultKillGracePeriod
+		}
+
+		// All commands share the process group of the first one where supported
+		for _, stage := range stages {
+			err := stage.process.TerminateNicely(killGracePeriod)
+			if err != nil {
+				r.logger.Error(execProcessLogTag, "Terminating pipeline that %s: %s", reason, err.Error())
+			}
+		}
+
+		results = <-doneCh
+	}
+
+	return pipelineResult(results, reason)
+}
+
+type pipelineStage struct {
+	process *execProcess
+
+	// pipeEnds are closed once the command exits
+	pipeEnds []*os.File
+}
+
+func (s pipelineStage) wait() <-chan Result {
+	waitCh := s.process.Wait()
+	resultCh := make(chan Result, 1)
+
+	go func() {
+		result := <-waitCh
+		for _, pipeEnd := range s.pipeEnds {
+			pipeEnd.Close() //nolint:errcheck
+		}
+		resultCh <- result
+	}()
+
+	return resultCh
+}
+
+func (r execCmdRunner) startPipeline(cmds []Command) ([]pipelineStage, error) {
+	var stages []pipelineStage
+	var stdin *os.File
+
+	for i, cmd := range cmds {
+		// Commands are grouped with the first one
+		cmd.KeepAttached = false
+
+		if i > 0 {
+			cmd.Stdin = nil
+		}
+
+		if i < len(cmds)-1 {
+			cmd.Stdout = nil
+		}
+
+		execCmd, err := r.buildComplexCommand(cmd)
+		if err != nil {
+			r.abortPipeline(stages, stdin)
+			return nil, bosherr.WrapErrorf(err, "Building command '%s'", cmd.Name)
+		}
+
+		var stage pipelineStage
+
+		if stdin != nil {
+			execCmd.Stdin = stdin
+			stage.pipeEnds = append(stage.pipeEnds, stdin)
+			stdin = nil
+		}
+
+		if i < len(cmds)-1 {
+			pipeReader, pipeWriter, err := os.Pipe()
+			if err != nil {
+				r.abortPipeline(stages, stage.pipeEnds...)
+				return nil, bosherr.WrapError(err, "Creating pipe")
+			}
+
+			execCmd.Stdout = pipeWriter
+			stage.pipeEnds = append(stage.pipeEnds, pipeWriter)
+			stdin = pipeReader
+		}
+
+		if i > 0 {
+			joinProcessGroup(execCmd, stages[0].process.pid)
+		}
+
+		stage.process = newExecProcess(execCmd, cmd, r.logger)
+
+		err = stage.process.Start()
+		if err != nil {
+			r.abortPipeline(stages, append(stage.pipeEnds, stdin)...)
+			return nil, err
+		}
+
+		if cmd.SpawnWithLowerPriority {
+			r.lowerProcessPriority(cmd.Name, stage.process.pid) //nolint:errcheck
+		}
+
+		stages = append(stages, stage)
+	}
+
+	return stages, nil
+}
+
+// abortPipeline kills the commands that were started before a command failed to start
+func (r execCmdRunner) abortPipeline(stages []pipelineStage, pipeEnds ...*os.File) {
+	for _, pipeEnd := range pipeEnds {
+		if pipeEnd != nil {
+			pipeEnd.Close() //nolint:errcheck
+		}
+	}
+
+	var resultChs []<-chan Result
+
+	for _, stage := range stages {
+		resultChs = append(resultChs, stage.wait())
+	}
+
+	for _, stage := range stages {
+		stage.process.Signal(os.Kill) //nolint:errcheck
+	}
+
+	for _, resultCh := range resultChs {
+		<-resultCh
+	}
+}
+
+func pipelineResult(results []Result, reason CommandErrorReason) (PipelineResult, error) {
+	pipelineResult := PipelineResult{
+		Stdout:  results[len(results)-1].Stdout,
+		Results: results,
+	}
+
+	var err error
+
+	for _, result := range results {
+		if result.Error != nil {
+			pipelineResult.ExitStatus = result.ExitStatus
+			err = result.Error
+			break
+		}
+	}
+
+	if err == nil && reason == CommandExited {
+		return pipelineResult, nil
+	}
+
+	return pipelineResult, CommandError{
+		Reason:     reason,
+		ExitStatus: pipelineResult.ExitStatus,
+		Err:        err,
+	}
+}
+
+func pipelineString(cmds []Command) string {
+	var cmdStrings []string
+	for _, cmd := range cmds {
+		cmdString := strings.Join(append([]string{cmd.Name}, cmd.Args...), " ")
+		if cmd.Redact != nil {
+			cmdString = cmd.Redact(cmdString)
+		}
+		cmdStrings = append(cmdStrings, cmdString)
+	}
+	return strings.Join(cmdStrings, " | ")
+}
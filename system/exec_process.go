@@ -1,10 +1,12 @@
 package system
 
 import (
-	"bytes"
+	"io"
+	"os"
 	"os/exec"
 	"strings"
 	"syscall"
+	"time"
 
 	bosherr "github.com/cloudfoundry/bosh-utils/errors"
 	boshlog "github.com/cloudfoundry/bosh-utils/logger"
@@ -16,25 +18,87 @@ const (
 
 type execProcess struct {
 	cmd          *exec.Cmd
-	stdoutWriter *bytes.Buffer
-	stderrWriter *bytes.Buffer
+	stdoutWriter *boundedBuffer
+	stderrWriter *boundedBuffer
+	stdoutLines  *lineWriter
+	stderrLines  *lineWriter
+	redact       func(string) string
+	limits       ResourceLimits
 	keepAttached bool
 	quiet        bool
 	pid          int
 	pgid         int //nolint:unused
+	startTime    time.Time
 	logger       boshlog.Logger
 	waitCh       chan Result
+
+	pty         *PseudoTerminal
+	ptyMaster   *os.File      //nolint:unused
+	ptyCopyDone chan struct{} //nolint:unused
+
+	cgroupDir         string         //nolint:unused
+	cgroupFile        *os.File       //nolint:unused
+	createdCgroupDirs []string       //nolint:unused
+	rlimits           []rlimitConfig //nolint:unused
+	rlimitGateReader  *os.File       //nolint:unused
+	rlimitGateWriter  *os.File       //nolint:unused
 }
 
 func NewExecProcess(cmd *exec.Cmd, keepAttached bool, quiet bool, logger boshlog.Logger) *execProcess {
-	return &execProcess{
+	return newExecProcess(cmd, Command{KeepAttached: keepAttached, Quiet: quiet}, logger)
+}
+
+// newExecProcess takes the output and logging options of command
+func newExecProcess(cmd *exec.Cmd, command Command, logger boshlog.Logger) *execProcess {
+	p := &execProcess{
 		cmd:          cmd,
-		stdoutWriter: bytes.NewBufferString(""),
-		stderrWriter: bytes.NewBufferString(""),
-		keepAttached: keepAttached,
-		quiet:        quiet,
+		stdoutWriter: newBoundedBuffer(command.MaxOutputSize),
+		stderrWriter: newBoundedBuffer(command.MaxOutputSize),
+		redact:       command.Redact,
+		limits:       command.ResourceLimits,
+		pty:          command.PseudoTerminal,
+		keepAttached: command.KeepAttached && command.PseudoTerminal == nil,
+		quiet:        command.Quiet,
 		logger:       logger,
 	}
+
+	if command.OnStdoutLine != nil {
+		p.stdoutLines = newLineWriter(command.OnStdoutLine, command.MaxOutputSize)
+	}
+
+	if command.OnStderrLine != nil {
+		p.stderrLines = newLineWriter(command.OnStderrLine, command.MaxOutputSize)
+	}
+
+	if p.redact == nil {
+		p.redact = func(s string) string { return s }
+	}
+
+	return p
+}
+
+// setUpOutput captures output that does not go to custom writers
+// and passes all of it to line callbacks
+func (p *execProcess) setUpOutput() {
+	if p.cmd.Stdout == nil {
+		p.cmd.Stdout = p.stdoutWriter
+	}
+
+	if p.cmd.Stderr == nil {
+		p.cmd.Stderr = p.stderrWriter
+	}
+
+	if p.stdoutLines != nil {
+		p.cmd.Stdout = io.MultiWriter(p.cmd.Stdout, p.stdoutLines)
+	}
+
+	if p.stderrLines != nil {
+		p.cmd.Stderr = io.MultiWriter(p.cmd.Stderr, p.stderrLines)
+	}
+}
+
+func (p *execProcess) cmdString() string {
+	return p.redact(strings.Join(p.cmd.Args, " "))
 }
 
 func (p *execProcess) Wait() <-chan Result {
@@ -52,34 +116,60 @@ func (p *execProcess) Wait() <-chan Result {
 	return p.waitCh
 }
 
+func (p *execProcess) PID() int {
+	return p.pid
+}
+
+func (p *execProcess) Signal(sig os.Signal) error {
+	return p.cmd.Process.Signal(sig)
+}
+
 func (p *execProcess) wait() Result {
 	// err will be non-nil if command exits with non-0 status
 	err := p.cmd.Wait()
 
+	p.closePty()
+	p.cleanUpResourceLimits()
+
+	if p.stdoutLines != nil {
+		p.stdoutLines.Flush()
+	}
+
+	if p.stderrLines != nil {
+		p.stderrLines.Flush()
+	}
+
 	stdout := p.stdoutWriter.String()
 	if !p.quiet {
-		p.logger.Debug(execProcessLogTag, "Stdout: %s", stdout)
+		p.logger.Debug(execProcessLogTag, "Stdout: %s", p.redact(stdout))
 	}
 
 	stderr := p.stderrWriter.String()
 	if !p.quiet {
-		p.logger.Debug(execProcessLogTag, "Stderr: %s", stderr)
+		p.logger.Debug(execProcessLogTag, "Stderr: %s", p.redact(stderr))
 	}
 
+	endTime := time.Now()
+
 	exitStatus := -1
+	var signal os.Signal
 	waitStatus := p.cmd.ProcessState.Sys().(syscall.WaitStatus)
 
 	if waitStatus.Exited() {
 		exitStatus = waitStatus.ExitStatus()
 	} else if waitStatus.Signaled() {
 		exitStatus = 128 + int(waitStatus.Signal())
+		signal = waitStatus.Signal()
 	}
 
 	p.logger.Debug(execProcessLogTag, "Successful: %t (%d)", err == nil, exitStatus)
 
 	if err != nil {
-		cmdString := strings.Join(p.cmd.Args, " ")
-		err = bosherr.WrapComplexError(err, NewExecError(cmdString, stdout, stderr))
+		execErr := NewExecError(p.cmdString(), p.redact(stdout), p.redact(stderr))
+		execErr.ExitStatus = exitStatus
+		execErr.Signal = signal
+
+		err = bosherr.WrapComplexError(err, execErr)
 	}
 
 	return Result{
@@ -87,5 +177,13 @@ func (p *execProcess) wait() Result {
 		Stderr:     stderr,
 		ExitStatus: exitStatus,
 		Error:      err,
+		Signal:     signal,
+		StartTime:  p.startTime,
+		EndTime:    endTime,
+		Usage: ResourceUsage{
+			MaxRSS:     maxRSS(p.cmd.ProcessState),
+			UserTime:   p.cmd.ProcessState.UserTime(),
+			SystemTime: p.cmd.ProcessState.SystemTime(),
+		},
 	}
 }
@@ -0,0 +1,224 @@
+package system
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+const (
+	ptyDefaultRows = 24
+	ptyDefaultCols = 80
+
+	// ptyDrainTimeout bounds reading the remaining output of a command that
+	// exited while processes it started keep the terminal open
+	ptyDrainTimeout = 1 * time.Second
+
+	ptyEOF = "\x04"
+)
+
+// preparePty attaches the command to a new pseudo-terminal, from which its
+// output is copied to the Stdout it was set up with. The returned function
+// must be called once the command started or failed to start.
+func (p *execProcess) preparePty() (func(started bool), error) {
+	if p.pty == nil {
+		return func(bool) {}, nil
+	}
+
+	master, slave, err := openPty()
+	if err != nil {
+		return nil, bosherr.WrapError(err, "Opening pseudo-terminal")
+	}
+
+	rows, cols := p.pty.Rows, p.pty.Cols
+	if rows == 0 {
+		rows = ptyDefaultRows
+	}
+	if cols == 0 {
+		cols = ptyDefaultCols
+	}
+
+	err = ptyControl(master, func(fd int) error {
+		err := unix.IoctlSetWinsize(fd, unix.TIOCSWINSZ, &unix.Winsize{Row: rows, Col: cols})
+		if err != nil {
+			return bosherr.WrapError(err, "Setting pseudo-terminal window size")
+		}
+
+		// Stdin is not echoed, so that it does not show up in the output,
+		// even when it is written before the command is able to turn off echo
+		termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+		if err != nil {
+			return bosherr.WrapError(err, "Getting pseudo-terminal attributes")
+		}
+
+		termios.Lflag &^= unix.ECHO
+
+		err = unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+		if err != nil {
+			return bosherr.WrapError(err, "Turning off pseudo-terminal echo")
+		}
+
+		return nil
+	})
+	if err != nil {
+		master.Close() //nolint:errcheck
+		slave.Close()  //nolint:errcheck
+		return nil, bosherr.WrapError(err, "Setting up pseudo-terminal")
+	}
+
+	p.ptyMaster = master
+
+	stdin, stdout := p.cmd.Stdin, p.cmd.Stdout
+	p.cmd.Stdin, p.cmd.Stdout, p.cmd.Stderr = slave, slave, slave
+
+	if p.cmd.SysProcAttr == nil {
+		p.cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	// A new session is also a new process group
+	p.cmd.SysProcAttr.Setpgid = false
+	p.cmd.SysProcAttr.Setsid = true
+	p.cmd.SysProcAttr.Setctty = true
+	p.cmd.SysProcAttr.Ctty = 0
+
+	return func(started bool) {
+		// Reading from the terminal fails once the command and the processes
+		// it started closed the terminal
+		slave.Close() //nolint:errcheck
+
+		if !started {
+			p.closePty()
+			return
+		}
+
+		p.startPtyCopy(stdin, stdout)
+	}, nil
+}
+
+func (p *execProcess) startPtyCopy(stdin io.Reader, stdout io.Writer) {
+	p.ptyCopyDone = make(chan struct{})
+
+	go func() {
+		io.Copy(stdout, p.ptyMaster) //nolint:errcheck
+		close(p.ptyCopyDone)
+	}()
+
+	if stdin != nil {
+		go func() {
+			master := &lastByteWriter{w: p.ptyMaster}
+
+			_, err := io.Copy(master, stdin)
+			if err != nil {
+				return
+			}
+
+			// An end-of-file character only ends the input at the start of
+			// a line, elsewhere it passes on the pending line without a newline
+			eof := ptyEOF
+			if master.written && master.last != '\n' {
+				eof += ptyEOF
+			}
+
+			p.ptyMaster.Write([]byte(eof)) //nolint:errcheck
+		}()
+	}
+}
+
+// lastByteWriter remembers the last byte written through it
+type lastByteWriter struct {
+	w io.Writer
+
+	last    byte
+	written bool
+}
+
+func (w *lastByteWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if n > 0 {
+		w.last = p[n-1]
+		w.written = true
+	}
+	return n, err
+}
+
+// closePty reads the remaining output of the exited command before closing its terminal
+func (p *execProcess) closePty() {
+	if p.ptyMaster == nil {
+		return
+	}
+
+	if p.ptyCopyDone != nil {
+		select {
+		case <-p.ptyCopyDone:
+		case <-time.After(ptyDrainTimeout):
+			p.logger.Debug(execProcessLogTag, "Stopped reading output of pseudo-terminal still in use")
+		}
+	}
+
+	p.ptyMaster.Close() //nolint:errcheck
+
+	if p.ptyCopyDone != nil {
+		<-p.ptyCopyDone
+	}
+}
+
+func openPty() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ptyNumber uint32
+
+	err = ptyControl(master, func(fd int) error {
+		err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0)
+		if err != nil {
+			return bosherr.WrapError(err, "Unlocking pseudo-terminal")
+		}
+
+		ptyNumber, err = unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+		if err != nil {
+			return bosherr.WrapError(err, "Getting pseudo-terminal number")
+		}
+
+		return nil
+	})
+	if err != nil {
+		master.Close() //nolint:errcheck
+		return nil, nil, err
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", ptyNumber), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close() //nolint:errcheck
+		return nil, nil, err
+	}
+
+	return master, slave, nil
+}
+
+// ptyControl runs ioctls on the terminal without making it blocking,
+// so that closing it stops reading from it
+func ptyControl(master *os.File, control func(fd int) error) error {
+	rawConn, err := master.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var controlErr error
+
+	err = rawConn.Control(func(fd uintptr) {
+		controlErr = control(int(fd))
+	})
+	if err != nil {
+		return err
+	}
+
+	return controlErr
+}
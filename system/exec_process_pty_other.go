@@ -0,0 +1,16 @@
+//go:build !linux
+
+package system
+
+import (
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+func (p *execProcess) preparePty() (func(started bool), error) {
+	if p.pty != nil {
+		return nil, bosherr.Error("Pseudo-terminals are only supported on Linux")
+	}
+	return func(bool) {}, nil
+}
+
+func (p *execProcess) closePty() {}
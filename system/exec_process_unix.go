@@ -4,7 +4,10 @@
 package system
 
 import (
-	"strings"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
 	"syscall"
 	"time"
 
@@ -12,33 +15,54 @@ import (
 )
 
 func (p *execProcess) Start() error {
-	if p.cmd.Stdout == nil {
-		p.cmd.Stdout = p.stdoutWriter
+	p.setUpOutput()
+
+	cmdString := p.cmdString()
+	p.logger.Debug(execProcessLogTag, "Running command '%s'", cmdString)
+
+	if !p.keepAttached {
+		if p.cmd.SysProcAttr == nil {
+			p.cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		p.cmd.SysProcAttr.Setpgid = true
 	}
 
-	if p.cmd.Stderr == nil {
-		p.cmd.Stderr = p.stderrWriter
+	err := p.prepareResourceLimits()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Starting command '%s'", cmdString)
 	}
 
-	cmdString := strings.Join(p.cmd.Args, " ")
-	p.logger.Debug(execProcessLogTag, "Running command '%s'", cmdString)
+	ptyStarted, err := p.preparePty()
+	if err != nil {
+		p.cleanUpResourceLimits()
+		return bosherr.WrapErrorf(err, "Starting command '%s'", cmdString)
+	}
 
-	if !p.keepAttached {
-		p.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	p.startTime = time.Now()
+
+	err = p.cmd.Start()
+	ptyStarted(err == nil)
+	if err != nil {
+		p.cleanUpResourceLimits()
+		return bosherr.WrapErrorf(err, "Starting command '%s'", cmdString)
 	}
 
-	err := p.cmd.Start()
+	p.pid = p.cmd.Process.Pid
+
+	err = p.awaitResourceLimits()
 	if err != nil {
+		// The command must not keep running without its limits
+		p.cmd.Process.Kill() //nolint:errcheck
+		p.cmd.Wait()         //nolint:errcheck
+		p.closePty()
+		p.cleanUpResourceLimits()
 		return bosherr.WrapErrorf(err, "Starting command '%s'", cmdString)
 	}
 
 	if !p.keepAttached {
 		p.pgid = p.cmd.Process.Pid
-	} else {
-		p.pgid, err = syscall.Getpgid(p.pid)
-		if err != nil {
-			p.logger.Error(execProcessLogTag, "Failed to retrieve pgid for command '%s'", cmdString)
-			p.pgid = -1
+		if p.cmd.SysProcAttr.Pgid != 0 {
+			p.pgid = p.cmd.SysProcAttr.Pgid
 		}
 	}
 
@@ -55,7 +79,7 @@ func (p *execProcess) TerminateNicely(killGracePeriod time.Duration) error {
 
 	err := p.signalGroup(syscall.SIGTERM)
 	if err != nil {
-		return bosherr.WrapErrorf(err, "Sending SIGTERM to process group %d", p.pgid)
+		return bosherr.WrapErrorf(err, "Sending SIGTERM to %s", p.signalTargetDescription())
 	}
 
 	terminatedCh := make(chan struct{})
@@ -83,7 +107,7 @@ func (p *execProcess) TerminateNicely(killGracePeriod time.Duration) error {
 
 		err = p.signalGroup(syscall.SIGKILL)
 		if err != nil {
-			return bosherr.WrapErrorf(err, "Sending SIGKILL to process group %d", p.pgid)
+			return bosherr.WrapErrorf(err, "Sending SIGKILL to %s", p.signalTargetDescription())
 		}
 	}
 
@@ -98,9 +122,26 @@ func (p *execProcess) TerminateNicely(killGracePeriod time.Duration) error {
 	return bosherr.Errorf("Failed to kill process after grace timeout (PID %d)", p.pid)
 }
 
+// signalTarget is the process group of the command, or only the command when
+// it stays attached to the process group of its parent, which it shares with
+// the caller and other commands that must not be signalled
+func (p *execProcess) signalTarget() int {
+	if p.keepAttached {
+		return p.pid
+	}
+	return -p.pgid
+}
+
+func (p *execProcess) signalTargetDescription() string {
+	if p.keepAttached {
+		return fmt.Sprintf("process %d", p.pid)
+	}
+	return fmt.Sprintf("process group %d", p.pgid)
+}
+
 // signalGroup does not return an error if the process group does not exist
 func (p *execProcess) signalGroup(sig syscall.Signal) error {
-	err := syscall.Kill(-p.pgid, sig)
+	err := syscall.Kill(p.signalTarget(), sig)
 	if p.isGroupDoesNotExistError(err) {
 		return nil
 	}
@@ -108,7 +149,7 @@ func (p *execProcess) signalGroup(sig syscall.Signal) error {
 }
 
 func (p *execProcess) groupExists() bool {
-	err := syscall.Kill(-p.pgid, syscall.Signal(0))
+	err := syscall.Kill(p.signalTarget(), syscall.Signal(0))
 
 	return !p.isGroupDoesNotExistError(err)
 }
@@ -123,3 +164,27 @@ func (p *execProcess) isGroupDoesNotExistError(err error) bool {
 	}
 	return false
 }
+
+// maxRSS is reported in kilobytes on Linux and in bytes on macOS
+func maxRSS(state *os.ProcessState) int64 {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+
+	if runtime.GOOS == "darwin" {
+		return int64(rusage.Maxrss)
+	}
+
+	return int64(rusage.Maxrss) * 1024
+}
+
+// joinProcessGroup makes cmd start in the process group of another process
+// rather than in a group of its own
+func joinProcessGroup(cmd *exec.Cmd, pgid int) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.SysProcAttr.Pgid = pgid
+}
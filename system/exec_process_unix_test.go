@@ -9,6 +9,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -176,5 +177,33 @@ var _ = Describe("execProcess", func() {
 				})
 			})
 		}
+
+		Context("when running with process attached", func() {
+			It("only terminates the command and not the other processes of its process group", func() {
+				sibling := exec.Command("sleep", "60")
+				err := sibling.Start()
+				Expect(err).ToNot(HaveOccurred())
+
+				defer func() {
+					sibling.Process.Kill() //nolint:errcheck
+					sibling.Wait()         //nolint:errcheck
+				}()
+
+				process := NewExecProcess(exec.Command("sleep", "60"), true, false, logger)
+				err = process.Start()
+				Expect(err).ToNot(HaveOccurred())
+
+				waitCh := process.Wait()
+
+				err = process.TerminateNicely(1 * time.Minute)
+				Expect(err).ToNot(HaveOccurred())
+
+				result := <-waitCh
+				Expect(result.Error).To(HaveOccurred())
+				Expect(result.ExitStatus).To(Equal(128 + 15))
+
+				Expect(sibling.Process.Signal(syscall.Signal(0))).To(Succeed())
+			})
+		})
 	})
 })
@@ -1,23 +1,33 @@
 package system
 
 import (
-	"strings"
+	"os"
+	"os/exec"
 	"time"
 
 	bosherr "github.com/cloudfoundry/bosh-utils/errors"
 )
 
 func (p *execProcess) Start() error {
-	if p.cmd.Stdout == nil {
-		p.cmd.Stdout = p.stdoutWriter
+	p.setUpOutput()
+
+	cmdString := p.cmdString()
+	p.logger.Debug(execProcessLogTag, "Running command: %s", cmdString)
+
+	err := p.prepareResourceLimits()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Starting command %s", cmdString)
 	}
-	if p.cmd.Stderr == nil {
-		p.cmd.Stderr = p.stderrWriter
+
+	ptyStarted, err := p.preparePty()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Starting command %s", cmdString)
 	}
-	cmdString := strings.Join(p.cmd.Args, " ")
-	p.logger.Debug(execProcessLogTag, "Running command: %s", cmdString)
 
-	err := p.cmd.Start()
+	p.startTime = time.Now()
+
+	err = p.cmd.Start()
+	ptyStarted(err == nil)
 	if err != nil {
 		return bosherr.WrapErrorf(err, "Starting command %s", cmdString)
 	}
@@ -53,3 +63,10 @@ func (p *execProcess) TerminateNicely(killGracePeriod time.Duration) error {
 
 	return nil
 }
+
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
+
+// joinProcessGroup does nothing since processes are not grouped on Windows
+func joinProcessGroup(cmd *exec.Cmd, pgid int) {}
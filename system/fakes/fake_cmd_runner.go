@@ -1,8 +1,11 @@
 package fakes
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -18,6 +21,7 @@ type FakeCmdRunner struct {
 	processesLock sync.Mutex
 
 	RunComplexCommands   []boshsys.Command
+	RunPipelines         [][]boshsys.Command
 	RunCommands          [][]string
 	RunCommandsWithInput [][]string
 	RunCommandsQuietly   [][]string
@@ -51,6 +55,10 @@ type FakeProcess struct {
 	TerminateNicelyKillGracePeriod time.Duration
 	TerminateNicelyErr             error
 
+	PIDValue  int
+	Signals   []os.Signal
+	SignalErr error
+
 	Stdout io.Writer
 	Stderr io.Writer
 }
@@ -69,6 +77,15 @@ func (p *FakeProcess) Wait() <-chan boshsys.Result {
 	return p.WaitCh
 }
 
+func (p *FakeProcess) PID() int {
+	return p.PIDValue
+}
+
+func (p *FakeProcess) Signal(sig os.Signal) error {
+	p.Signals = append(p.Signals, sig)
+	return p.SignalErr
+}
+
 func (p *FakeProcess) TerminateNicely(killGracePeriod time.Duration) error {
 	p.TerminateNicelyKillGracePeriod = killGracePeriod
 	p.TerminatedNicely = true
@@ -107,9 +124,42 @@ func (r *FakeCmdRunner) RunComplexCommand(cmd boshsys.Command) (string, string,
 		cmd.Stderr.Write([]byte(stderr)) //nolint:errcheck
 	}
 
+	callLineCallback(cmd.OnStdoutLine, stdout)
+	callLineCallback(cmd.OnStderrLine, stderr)
+
 	return stdout, stderr, exitstatus, err
 }
 
+func callLineCallback(onLine func(string), output string) {
+	if onLine == nil || output == "" {
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+		onLine(line)
+	}
+}
+
+// RunComplexCommandContext returns a CommandError for a done ctx
+// and otherwise behaves like RunComplexCommand
+func (r *FakeCmdRunner) RunComplexCommandContext(ctx context.Context, cmd boshsys.Command) (string, string, int, error) {
+	err := r.contextErr(ctx, cmd)
+	if err != nil {
+		return "", "", -1, err
+	}
+
+	return r.RunComplexCommand(cmd)
+}
+
+func (r *FakeCmdRunner) RunComplexCommandAsyncContext(ctx context.Context, cmd boshsys.Command) (boshsys.Process, error) {
+	err := r.contextErr(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.RunComplexCommandAsync(cmd)
+}
+
 func (r *FakeCmdRunner) RunComplexCommandAsync(cmd boshsys.Command) (boshsys.Process, error) {
 	r.processesLock.Lock()
 	defer r.processesLock.Unlock()
@@ -139,6 +189,55 @@ func (r *FakeCmdRunner) RunComplexCommandAsync(cmd boshsys.Command) (boshsys.Pro
 	panic(fmt.Sprintf("Failed to find available process for %s", fullCmd))
 }
 
+// RunPipeline returns the results added for every command of the pipeline,
+// and the error and exit status of the first command that did not succeed
+func (r *FakeCmdRunner) RunPipeline(ctx context.Context, cmds ...boshsys.Command) (boshsys.PipelineResult, error) {
+	if len(cmds) == 0 {
+		return boshsys.PipelineResult{}, errors.New("Running pipeline: No commands")
+	}
+
+	err := r.contextErr(ctx, cmds[0])
+	if err != nil {
+		return boshsys.PipelineResult{ExitStatus: -1}, err
+	}
+
+	r.commandResultsLock.Lock()
+	defer r.commandResultsLock.Unlock()
+
+	r.RunPipelines = append(r.RunPipelines, cmds)
+
+	var pipelineResult boshsys.PipelineResult
+
+	for i, cmd := range cmds {
+		runCmd := append([]string{cmd.Name}, cmd.Args...)
+
+		r.runCallbackForCmd(runCmd)
+
+		stdout, stderr, exitStatus, err := r.getOutputsForCmd(runCmd)
+		if i < len(cmds)-1 {
+			stdout = ""
+		}
+
+		pipelineResult.Results = append(pipelineResult.Results, boshsys.Result{
+			Stdout:     stdout,
+			Stderr:     stderr,
+			ExitStatus: exitStatus,
+			Error:      err,
+		})
+	}
+
+	pipelineResult.Stdout = pipelineResult.Results[len(cmds)-1].Stdout
+
+	for _, result := range pipelineResult.Results {
+		if result.Error != nil {
+			pipelineResult.ExitStatus = result.ExitStatus
+			return pipelineResult, boshsys.CommandError{Reason: boshsys.CommandExited, ExitStatus: result.ExitStatus, Err: result.Error}
+		}
+	}
+
+	return pipelineResult, nil
+}
+
 func (r *FakeCmdRunner) RunCommand(cmdName string, args ...string) (string, string, int, error) {
 	r.commandResultsLock.Lock()
 	defer r.commandResultsLock.Unlock()
@@ -151,6 +250,15 @@ func (r *FakeCmdRunner) RunCommand(cmdName string, args ...string) (string, stri
 	return r.getOutputsForCmd(runCmd)
 }
 
+func (r *FakeCmdRunner) RunCommandContext(ctx context.Context, cmdName string, args ...string) (string, string, int, error) {
+	err := r.contextErr(ctx, boshsys.Command{Name: cmdName, Args: args})
+	if err != nil {
+		return "", "", -1, err
+	}
+
+	return r.RunCommand(cmdName, args...)
+}
+
 func (r *FakeCmdRunner) ClearCommandHistory() {
 	r.commandResultsLock.Lock()
 	defer r.commandResultsLock.Unlock()
@@ -208,6 +316,29 @@ func (r *FakeCmdRunner) SetCmdCallback(fullCmd string, callback FakeCmdCallback)
 	r.runCommandCallbacks[fullCmd] = callback
 }
 
+func (r *FakeCmdRunner) contextErr(ctx context.Context, cmd boshsys.Command) error {
+	return commandContextErr(ctx, cmd.Name)
+}
+
+// commandContextErr returns the CommandError of a runner not starting
+// cmdName because ctx is done
+func commandContextErr(ctx context.Context, cmdName string) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+
+	reason := boshsys.CommandCanceled
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		reason = boshsys.CommandTimedOut
+	}
+
+	return boshsys.CommandError{
+		Reason:     reason,
+		ExitStatus: -1,
+		Err:        fmt.Errorf("Not starting command '%s'", cmdName),
+	}
+}
+
 func (r *FakeCmdRunner) getOutputsForCmd(runCmd []string) (string, string, int, error) {
 	fullCmd := strings.Join(runCmd, " ")
 	results, found := r.commandResults[fullCmd]
@@ -1,6 +1,9 @@
 package fakes_test
 
 import (
+	"context"
+	"errors"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
@@ -53,4 +56,62 @@ var _ = Describe("FakeCmdRunner", func() {
 			Expect(runner.RunCommands).To(Equal([][]string{{"foo", "bar"}, {"foo", "bar"}}))
 		})
 	})
+
+	Describe("RunComplexCommand", func() {
+		It("calls line callbacks with the scripted output", func() {
+			runner.AddCmdResult("foo bar", FakeCmdResult{Stdout: "one\ntwo\n", Stderr: "three"})
+
+			var lines []string
+			_, _, _, err := runner.RunComplexCommand(Command{
+				Name:         "foo",
+				Args:         []string{"bar"},
+				OnStdoutLine: func(line string) { lines = append(lines, line) },
+				OnStderrLine: func(line string) { lines = append(lines, "stderr:"+line) },
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lines).To(Equal([]string{"one", "two", "stderr:three"}))
+		})
+	})
+
+	Describe("RunCommandContext", func() {
+		It("runs the command like RunCommand", func() {
+			runner.AddCmdResult("foo bar", FakeCmdResult{Stdout: "nice"})
+
+			stdout, _, _, err := runner.RunCommandContext(context.Background(), "foo", "bar")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("nice"))
+
+			Expect(runner.RunCommands).To(Equal([][]string{{"foo", "bar"}}))
+		})
+
+		It("returns a CommandError without running the command when the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, _, _, err := runner.RunCommandContext(ctx, "foo", "bar")
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+
+			Expect(runner.RunCommands).To(BeEmpty())
+		})
+	})
+
+	Describe("RunPipeline", func() {
+		It("records the pipeline and reports the first command that did not succeed", func() {
+			runner.AddCmdResult("foo", FakeCmdResult{Stdout: "ignored", Stderr: "foo-err"})
+			runner.AddCmdResult("bar", FakeCmdResult{ExitStatus: 2, Error: errors.New("fake-err")})
+			runner.AddCmdResult("baz", FakeCmdResult{Stdout: "out"})
+
+			cmds := []Command{{Name: "foo"}, {Name: "bar"}, {Name: "baz"}}
+
+			result, err := runner.RunPipeline(context.Background(), cmds...)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("fake-err"))
+			Expect(result.Stdout).To(Equal("out"))
+			Expect(result.ExitStatus).To(Equal(2))
+			Expect(result.Results[0].Stdout).To(BeEmpty())
+			Expect(result.Results[0].Stderr).To(Equal("foo-err"))
+
+			Expect(runner.RunPipelines).To(Equal([][]Command{cmds}))
+		})
+	})
 })
@@ -56,7 +56,13 @@ type FakeFileSystem struct {
 	WriteFileCallCount        int
 	WriteFileQuietlyCallCount int
 
+	WriteFileAtomicallyCallCount int
+
+	LockFileError error
+	fileLocks     map[string]*fakeFileLocks
+
 	SymlinkError error
+	LinkError    error
 
 	MkdirAllError       error
 	mkdirAllErrorByPath map[string]error
@@ -69,6 +75,8 @@ type FakeFileSystem struct {
 	ChmodErr       error
 	ChmodCallCount int
 
+	ChtimesErr error
+
 	CopyFileError     error
 	CopyFileCallCount int
 
@@ -79,6 +87,8 @@ type FakeFileSystem struct {
 	RenameOldPaths []string
 	RenameNewPaths []string
 
+	ReplaceFileError error
+
 	RemoveAllStub removeAllFn
 
 	ReadAndFollowLinkError error
@@ -104,6 +114,9 @@ type FakeFileSystem struct {
 
 	WalkErr error
 
+	WatchErr error
+	Watchers []*FakeWatcher
+
 	TempRootPath   string
 	strictTempRoot bool
 }
@@ -503,6 +516,23 @@ func (fs *FakeFileSystem) Chmod(path string, perm os.FileMode) error {
 	return nil
 }
 
+func (fs *FakeFileSystem) Chtimes(path string, atime time.Time, mtime time.Time) error {
+	fs.filesLock.Lock()
+	defer fs.filesLock.Unlock()
+
+	if fs.ChtimesErr != nil {
+		return fs.ChtimesErr
+	}
+
+	stats := fs.fileRegistry.Get(path)
+	if stats == nil {
+		return fmt.Errorf("path does not exist: %s", path)
+	}
+
+	stats.ModTime = mtime
+	return nil
+}
+
 func (fs *FakeFileSystem) WriteFileString(path, content string) error {
 	return fs.WriteFile(path, []byte(content))
 }
@@ -517,6 +547,13 @@ func (fs *FakeFileSystem) WriteFile(path string, content []byte) error {
 	return fs.writeFile(path, content)
 }
 
+// WriteFileAtomically writes the file like WriteFile,
+// keeping the stats of an existing file
+func (fs *FakeFileSystem) WriteFileAtomically(path string, content []byte) error {
+	fs.WriteFileAtomicallyCallCount++
+	return fs.writeFile(path, content)
+}
+
 func (fs *FakeFileSystem) writeFile(path string, content []byte) error {
 	fs.filesLock.Lock()
 	defer fs.filesLock.Unlock()
@@ -588,6 +625,102 @@ func (fs *FakeFileSystem) ConvergeFileContents(path string, content []byte, opts
 	return false, nil
 }
 
+type fakeFileLocks struct {
+	exclusive bool
+	shared    int
+}
+
+// FakeFileLock is returned by FakeFileSystem.LockFile
+type FakeFileLock struct {
+	fs     *FakeFileSystem
+	path   string
+	shared bool
+
+	Unlocked  bool
+	UnlockErr error
+}
+
+func (l *FakeFileLock) Unlock() error {
+	if l.UnlockErr != nil {
+		return l.UnlockErr
+	}
+
+	l.fs.filesLock.Lock()
+	defer l.fs.filesLock.Unlock()
+
+	if l.Unlocked {
+		return nil
+	}
+
+	l.Unlocked = true
+
+	locks := l.fs.fileLocks[l.path]
+	if l.shared {
+		locks.shared--
+	} else {
+		locks.exclusive = false
+	}
+
+	if !locks.exclusive && locks.shared == 0 {
+		delete(l.fs.fileLocks, l.path)
+	}
+
+	return nil
+}
+
+// LockFile acquires the lock right away, or fails like a lock that timed out
+// when a conflicting lock is held, without waiting for it to be released
+func (fs *FakeFileSystem) LockFile(path string, opts boshsys.LockOpts) (boshsys.FileLock, error) {
+	fs.filesLock.Lock()
+	defer fs.filesLock.Unlock()
+
+	if fs.LockFileError != nil {
+		return nil, fs.LockFileError
+	}
+
+	path = fs.fileRegistry.UnifiedPath(path)
+
+	stats := fs.getOrCreateFile(path)
+	if stats.FileType == "" {
+		stats.FileType = FakeFileTypeFile
+	}
+
+	if fs.fileLocks == nil {
+		fs.fileLocks = map[string]*fakeFileLocks{}
+	}
+
+	locks := fs.fileLocks[path]
+	if locks == nil {
+		locks = &fakeFileLocks{}
+		fs.fileLocks[path] = locks
+	}
+
+	lockType := "exclusive"
+	if opts.Shared {
+		lockType = "shared"
+	}
+
+	if locks.exclusive || (!opts.Shared && locks.shared > 0) {
+		return nil, bosherr.Errorf("Timed out after %s acquiring %s lock on %s", opts.Timeout, lockType, path)
+	}
+
+	if opts.Shared {
+		locks.shared++
+	} else {
+		locks.exclusive = true
+	}
+
+	return &FakeFileLock{fs: fs, path: path, shared: opts.Shared}, nil
+}
+
+// IsLocked returns whether a lock is held on the file at path
+func (fs *FakeFileSystem) IsLocked(path string) bool {
+	fs.filesLock.Lock()
+	defer fs.filesLock.Unlock()
+
+	return fs.fileLocks[fs.fileRegistry.UnifiedPath(path)] != nil
+}
+
 func (fs *FakeFileSystem) ReadFileString(path string) (string, error) {
 	b, err := fs.ReadFile(path)
 	if err != nil {
@@ -687,6 +820,59 @@ func (fs *FakeFileSystem) Rename(oldPath, newPath string) error {
 	return nil
 }
 
+// ReplaceFile registers the stats of oldPath for newPath in place of
+// the stats of an existing file, which fails if newPath is a dir
+func (fs *FakeFileSystem) ReplaceFile(oldPath, newPath string) error {
+	fs.filesLock.Lock()
+	defer fs.filesLock.Unlock()
+
+	if fs.ReplaceFileError != nil {
+		return fs.ReplaceFileError
+	}
+
+	oldPath = fs.fileRegistry.UnifiedPath(oldPath)
+	newPath = fs.fileRegistry.UnifiedPath(newPath)
+
+	stats := fs.fileRegistry.Get(oldPath)
+	if stats == nil {
+		return errors.New("old path did not exist")
+	}
+
+	newStats := fs.fileRegistry.Get(newPath)
+	if newStats != nil && newStats.FileType == FakeFileTypeDir {
+		return errors.New("new path is a directory")
+	}
+
+	fs.fileRegistry.Register(newPath, stats)
+	fs.fileRegistry.Remove(oldPath)
+
+	return nil
+}
+
+// Link registers the stats of oldPath for newPath as well,
+// so that changes through either path apply to both
+func (fs *FakeFileSystem) Link(oldPath, newPath string) error {
+	fs.filesLock.Lock()
+	defer fs.filesLock.Unlock()
+
+	if fs.LinkError != nil {
+		return fs.LinkError
+	}
+
+	stats := fs.fileRegistry.Get(oldPath)
+	if stats == nil {
+		return errors.New("old path did not exist")
+	}
+
+	if fs.fileRegistry.Get(newPath) != nil {
+		return os.ErrExist
+	}
+
+	fs.fileRegistry.Register(newPath, stats)
+
+	return nil
+}
+
 func (fs *FakeFileSystem) Symlink(oldPath, newPath string) (err error) {
 	fs.filesLock.Lock()
 	defer fs.filesLock.Unlock()
@@ -984,6 +1170,36 @@ func (fs *FakeFileSystem) Ls(root string) ([]string, error) {
 	return matches, nil
 }
 
+// Watch returns a FakeWatcher, which is added to Watchers
+func (fs *FakeFileSystem) Watch(path string, opts boshsys.WatchOpts) (boshsys.Watcher, error) {
+	fs.filesLock.Lock()
+	defer fs.filesLock.Unlock()
+
+	if fs.WatchErr != nil {
+		return nil, fs.WatchErr
+	}
+
+	watcher := NewFakeWatcher(path, opts)
+	fs.Watchers = append(fs.Watchers, watcher)
+
+	return watcher, nil
+}
+
+// WatchersFor returns the watchers of path that were not closed
+func (fs *FakeFileSystem) WatchersFor(path string) []*FakeWatcher {
+	fs.filesLock.Lock()
+	defer fs.filesLock.Unlock()
+
+	var watchers []*FakeWatcher
+	for _, watcher := range fs.Watchers {
+		if watcher.Path == path && !watcher.Closed() {
+			watchers = append(watchers, watcher)
+		}
+	}
+
+	return watchers
+}
+
 func (fs *FakeFileSystem) Walk(root string, walkFunc filepath.WalkFunc) error {
 	if fs.WalkErr != nil {
 		return walkFunc("", nil, fs.WalkErr)
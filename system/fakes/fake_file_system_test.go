@@ -332,6 +332,123 @@ var _ = Describe("FakeFileSystem", func() {
 		})
 	})
 
+	Describe("WriteFileAtomically", func() {
+		It("writes the file keeping its stats", func() {
+			err := fs.WriteFileString("/config", "initial write")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = fs.Chmod("/config", 0600)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = fs.WriteFileAtomically("/config", []byte("second write"))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(fs.GetFileTestStat("/config").StringContents()).To(Equal("second write"))
+			Expect(fs.GetFileTestStat("/config").FileMode).To(Equal(os.FileMode(0600)))
+			Expect(fs.WriteFileAtomicallyCallCount).To(Equal(1))
+		})
+	})
+
+	Describe("LockFile", func() {
+		It("fails to acquire conflicting locks until they are released", func() {
+			lock, err := fs.LockFile("/lock", boshsys.LockOpts{Shared: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fs.FileExists("/lock")).To(BeTrue())
+			Expect(fs.IsLocked("/lock")).To(BeTrue())
+
+			otherLock, err := fs.LockFile("/lock", boshsys.LockOpts{Shared: true})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = fs.LockFile("/lock", boshsys.LockOpts{Timeout: time.Second})
+			Expect(err).To(MatchError("Timed out after 1s acquiring exclusive lock on /lock"))
+
+			Expect(lock.Unlock()).To(Succeed())
+			Expect(otherLock.Unlock()).To(Succeed())
+			Expect(fs.IsLocked("/lock")).To(BeFalse())
+
+			lock, err = fs.LockFile("/lock", boshsys.LockOpts{})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = fs.LockFile("/lock", boshsys.LockOpts{Shared: true})
+			Expect(err).To(HaveOccurred())
+
+			Expect(lock.Unlock()).To(Succeed())
+		})
+
+		It("returns LockFileError", func() {
+			fs.LockFileError = errors.New("fake-err")
+
+			_, err := fs.LockFile("/lock", boshsys.LockOpts{})
+			Expect(err).To(MatchError("fake-err"))
+		})
+	})
+
+	Describe("Watch", func() {
+		It("returns watchers reporting the events sent to them", func() {
+			watcher, err := fs.Watch("/etc/cert.pem", boshsys.WatchOpts{Debounce: time.Second})
+			Expect(err).ToNot(HaveOccurred())
+
+			fakeWatchers := fs.WatchersFor("/etc/cert.pem")
+			Expect(fakeWatchers).To(HaveLen(1))
+			Expect(fakeWatchers[0].Opts.Debounce).To(Equal(time.Second))
+
+			event := boshsys.WatchEvent{Path: "/etc/cert.pem", Op: boshsys.WatchWrite}
+			fakeWatchers[0].SendEvent(event)
+			Expect(watcher.Events()).To(Receive(Equal(event)))
+
+			fakeWatchers[0].SendError(errors.New("fake-err"))
+			Expect(watcher.Errors()).To(Receive(MatchError("fake-err")))
+
+			Expect(watcher.Close()).To(Succeed())
+			Expect(watcher.Events()).To(BeClosed())
+			Expect(fs.WatchersFor("/etc/cert.pem")).To(BeEmpty())
+		})
+
+		It("returns WatchErr", func() {
+			fs.WatchErr = errors.New("fake-err")
+
+			_, err := fs.Watch("/etc/cert.pem", boshsys.WatchOpts{})
+			Expect(err).To(MatchError("fake-err"))
+		})
+	})
+
+	Describe("ReplaceFile", func() {
+		It("replaces the file at the new path", func() {
+			Expect(fs.WriteFileString("/new", "new content")).To(Succeed())
+			Expect(fs.WriteFileString("/file", "old content")).To(Succeed())
+
+			Expect(fs.ReplaceFile("/new", "/file")).To(Succeed())
+
+			Expect(fs.ReadFileString("/file")).To(Equal("new content"))
+			Expect(fs.FileExists("/new")).To(BeFalse())
+		})
+
+		It("returns an error when the new path is a directory", func() {
+			Expect(fs.WriteFileString("/new", "new content")).To(Succeed())
+			Expect(fs.MkdirAll("/dir", os.ModePerm)).To(Succeed())
+
+			Expect(fs.ReplaceFile("/new", "/dir")).ToNot(Succeed())
+			Expect(fs.FileExists("/new")).To(BeTrue())
+		})
+	})
+
+	Describe("Link", func() {
+		It("shares the file between both paths", func() {
+			Expect(fs.WriteFileString("/file", "content")).To(Succeed())
+			Expect(fs.Link("/file", "/link")).To(Succeed())
+
+			Expect(fs.WriteFileString("/link", "new content")).To(Succeed())
+			Expect(fs.ReadFileString("/file")).To(Equal("new content"))
+		})
+
+		It("returns an error when the new path exists", func() {
+			Expect(fs.WriteFileString("/file", "content")).To(Succeed())
+			Expect(fs.WriteFileString("/link", "other")).To(Succeed())
+
+			Expect(fs.Link("/file", "/link")).To(MatchError(os.ErrExist))
+		})
+	})
+
 	Describe("Symlink", func() {
 		It("creates", func() {
 			err := fs.Symlink("foobarbaz", "foobar")
@@ -0,0 +1,76 @@
+package fakes
+
+import (
+	"sync"
+
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// FakeWatcher is returned by FakeFileSystem.Watch.
+// Tests send it the events and errors it reports.
+type FakeWatcher struct {
+	Path string
+	Opts boshsys.WatchOpts
+
+	CloseErr error
+
+	events chan boshsys.WatchEvent
+	errors chan error
+
+	closed bool
+	lock   sync.Mutex
+}
+
+func NewFakeWatcher(path string, opts boshsys.WatchOpts) *FakeWatcher {
+	return &FakeWatcher{
+		Path: path,
+		Opts: opts,
+
+		events: make(chan boshsys.WatchEvent, 100),
+		errors: make(chan error, 100),
+	}
+}
+
+func (w *FakeWatcher) Events() <-chan boshsys.WatchEvent { return w.events }
+
+func (w *FakeWatcher) Errors() <-chan error { return w.errors }
+
+// SendEvent reports event unless the watcher is closed
+func (w *FakeWatcher) SendEvent(event boshsys.WatchEvent) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if !w.closed {
+		w.events <- event
+	}
+}
+
+// SendError reports err unless the watcher is closed
+func (w *FakeWatcher) SendError(err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if !w.closed {
+		w.errors <- err
+	}
+}
+
+func (w *FakeWatcher) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if !w.closed {
+		w.closed = true
+		close(w.events)
+		close(w.errors)
+	}
+
+	return w.CloseErr
+}
+
+func (w *FakeWatcher) Closed() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.closed
+}
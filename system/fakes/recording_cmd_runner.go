@@ -0,0 +1,462 @@
+package fakes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+// CmdRecordings are the contents of a fixture file written by
+// RecordingCmdRunner and served back by ReplayingCmdRunner
+type CmdRecordings struct {
+	Commands      []CmdRecording  `json:"commands"`
+	CommandExists map[string]bool `json:"command_exists,omitempty"`
+
+	// SecretPatterns are the secret patterns the commands were redacted with,
+	// so that commands can be redacted the same way when they are replayed
+	SecretPatterns []string `json:"secret_patterns,omitempty"`
+}
+
+// CmdRecording is a command that was run and its result.
+// Commands run with RunCommand, RunCommandQuietly and RunCommandWithInput
+// are recorded like complex commands with only Name, Args and Stdin.
+type CmdRecording struct {
+	Name       string            `json:"name,omitempty"`
+	Args       []string          `json:"args,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+	WorkingDir string            `json:"working_dir,omitempty"`
+	Stdin      string            `json:"stdin,omitempty"`
+
+	// Pipeline holds the commands of a pipeline in order, in which case the
+	// fields above are empty. Only the first command has Stdin and only the
+	// last one has Stdout.
+	Pipeline []CmdRecording `json:"pipeline,omitempty"`
+
+	Stdout     string `json:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+	ExitStatus int    `json:"exit_status"`
+
+	// Error is the message of the error of the command. When the error was a
+	// CommandError, ErrorReason is its reason and Error the message of its Err.
+	Error       string                     `json:"error,omitempty"`
+	ErrorReason boshsys.CommandErrorReason `json:"error_reason,omitempty"`
+
+	// NotStarted is set when an async command failed to start
+	NotStarted bool `json:"not_started,omitempty"`
+}
+
+func (r CmdRecording) String() string {
+	if len(r.Pipeline) > 0 {
+		cmds := make([]string, len(r.Pipeline))
+		for i, cmd := range r.Pipeline {
+			cmds[i] = cmd.String()
+		}
+		return strings.Join(cmds, " | ")
+	}
+
+	return strings.Join(append([]string{r.Name}, r.Args...), " ")
+}
+
+// RecordingCmdRunner runs commands with another CmdRunner and records every
+// invocation so that Save can write them to a fixture file for
+// ReplayingCmdRunner. Stdin of commands is read to memory before they run.
+// Commands are recorded in the order they started, once they finished.
+// Args, Env values and stdin are redacted with a boshsys.SecretRedactor
+// using the secret patterns before they are recorded.
+type RecordingCmdRunner struct {
+	runner   boshsys.CmdRunner
+	fs       boshsys.FileSystem
+	path     string
+	redactor boshsys.SecretRedactor
+
+	// Commands holds a slot for every command that was started,
+	// which is filled in once the command finished
+	recordings CmdRecordings
+	finished   []bool
+	lock       sync.Mutex
+}
+
+func NewRecordingCmdRunner(
+	runner boshsys.CmdRunner,
+	fs boshsys.FileSystem,
+	path string,
+	secretPatterns []*regexp.Regexp,
+) *RecordingCmdRunner {
+	recordings := CmdRecordings{CommandExists: map[string]bool{}}
+	for _, pattern := range secretPatterns {
+		recordings.SecretPatterns = append(recordings.SecretPatterns, pattern.String())
+	}
+
+	return &RecordingCmdRunner{
+		runner:   runner,
+		fs:       fs,
+		path:     path,
+		redactor: boshsys.NewSecretRedactor(secretPatterns),
+
+		recordings: recordings,
+	}
+}
+
+// Recordings returns the commands that finished so far
+// in the order they started
+func (r *RecordingCmdRunner) Recordings() []CmdRecording {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.finishedRecordings()
+}
+
+// Save writes the commands that finished to the fixture file
+func (r *RecordingCmdRunner) Save() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	recordings := r.recordings
+	recordings.Commands = r.finishedRecordings()
+
+	contents, err := json.MarshalIndent(recordings, "", "  ")
+	if err != nil {
+		return bosherr.WrapError(err, "Marshalling command recordings")
+	}
+
+	err = r.fs.WriteFile(r.path, contents)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing command recordings to '%s'", r.path)
+	}
+
+	return nil
+}
+
+func (r *RecordingCmdRunner) RunComplexCommand(cmd boshsys.Command) (string, string, int, error) {
+	cmd, rec, err := r.startRecording(cmd)
+	if err != nil {
+		return "", "", -1, err
+	}
+
+	stdout, stderr, exitStatus, err := r.runner.RunComplexCommand(cmd)
+
+	r.finishRecording(rec, stdout, stderr, exitStatus, err)
+
+	return stdout, stderr, exitStatus, err
+}
+
+func (r *RecordingCmdRunner) RunComplexCommandContext(ctx context.Context, cmd boshsys.Command) (string, string, int, error) {
+	cmd, rec, err := r.startRecording(cmd)
+	if err != nil {
+		return "", "", -1, err
+	}
+
+	stdout, stderr, exitStatus, err := r.runner.RunComplexCommandContext(ctx, cmd)
+
+	r.finishRecording(rec, stdout, stderr, exitStatus, err)
+
+	return stdout, stderr, exitStatus, err
+}
+
+func (r *RecordingCmdRunner) RunComplexCommandAsync(cmd boshsys.Command) (boshsys.Process, error) {
+	cmd, rec, err := r.startRecording(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	process, err := r.runner.RunComplexCommandAsync(cmd)
+
+	return r.recordProcess(rec, process, err)
+}
+
+func (r *RecordingCmdRunner) RunComplexCommandAsyncContext(ctx context.Context, cmd boshsys.Command) (boshsys.Process, error) {
+	cmd, rec, err := r.startRecording(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	process, err := r.runner.RunComplexCommandAsyncContext(ctx, cmd)
+
+	return r.recordProcess(rec, process, err)
+}
+
+func (r *RecordingCmdRunner) RunPipeline(ctx context.Context, cmds ...boshsys.Command) (boshsys.PipelineResult, error) {
+	if len(cmds) == 0 {
+		return r.runner.RunPipeline(ctx, cmds...)
+	}
+
+	cmds = append([]boshsys.Command{}, cmds...)
+	recs := make([]*cmdRecorder, len(cmds))
+
+	for i := range cmds {
+		var err error
+
+		cmds[i], recs[i], err = r.prepareRecording(cmds[i])
+		if err != nil {
+			return boshsys.PipelineResult{ExitStatus: -1}, err
+		}
+
+		// Only the stdin of the first command is used
+		if i > 0 {
+			recs[i].recording.Stdin = ""
+		}
+	}
+
+	index := r.reserve()
+
+	result, err := r.runner.RunPipeline(ctx, cmds...)
+
+	rec := CmdRecording{ExitStatus: result.ExitStatus}
+	setRecordingError(&rec, err, func(s string) string {
+		for _, cmd := range cmds {
+			s = r.redactor.Redact(cmd, s)
+		}
+		return s
+	})
+
+	for i, stage := range recs {
+		var stageResult boshsys.Result
+		if i < len(result.Results) {
+			stageResult = result.Results[i]
+		}
+
+		stage.finish(stageResult.Stdout, stageResult.Stderr, stageResult.ExitStatus, stageResult.Error)
+		rec.Pipeline = append(rec.Pipeline, stage.recording)
+	}
+
+	r.record(index, rec)
+
+	return result, err
+}
+
+func (r *RecordingCmdRunner) RunCommand(cmdName string, args ...string) (string, string, int, error) {
+	index := r.reserve()
+
+	stdout, stderr, exitStatus, err := r.runner.RunCommand(cmdName, args...)
+
+	r.recordCommand(index, "", cmdName, args, stdout, stderr, exitStatus, err)
+
+	return stdout, stderr, exitStatus, err
+}
+
+func (r *RecordingCmdRunner) RunCommandContext(ctx context.Context, cmdName string, args ...string) (string, string, int, error) {
+	index := r.reserve()
+
+	stdout, stderr, exitStatus, err := r.runner.RunCommandContext(ctx, cmdName, args...)
+
+	r.recordCommand(index, "", cmdName, args, stdout, stderr, exitStatus, err)
+
+	return stdout, stderr, exitStatus, err
+}
+
+func (r *RecordingCmdRunner) RunCommandQuietly(cmdName string, args ...string) (string, string, int, error) {
+	index := r.reserve()
+
+	stdout, stderr, exitStatus, err := r.runner.RunCommandQuietly(cmdName, args...)
+
+	r.recordCommand(index, "", cmdName, args, stdout, stderr, exitStatus, err)
+
+	return stdout, stderr, exitStatus, err
+}
+
+func (r *RecordingCmdRunner) RunCommandWithInput(input, cmdName string, args ...string) (string, string, int, error) {
+	index := r.reserve()
+
+	stdout, stderr, exitStatus, err := r.runner.RunCommandWithInput(input, cmdName, args...)
+
+	r.recordCommand(index, input, cmdName, args, stdout, stderr, exitStatus, err)
+
+	return stdout, stderr, exitStatus, err
+}
+
+func (r *RecordingCmdRunner) CommandExists(cmdName string) bool {
+	exists := r.runner.CommandExists(cmdName)
+
+	r.lock.Lock()
+	r.recordings.CommandExists[cmdName] = exists
+	r.lock.Unlock()
+
+	return exists
+}
+
+// cmdRecorder captures the output of a command
+// written to custom Stdout and Stderr writers
+type cmdRecorder struct {
+	index     int
+	recording CmdRecording
+
+	// redact redacts the output and error of the command
+	redact func(string) string
+
+	stdout *bytes.Buffer
+	stderr *bytes.Buffer
+}
+
+// startRecording prepares the recording of a command
+// and reserves its slot before the command starts
+func (r *RecordingCmdRunner) startRecording(cmd boshsys.Command) (boshsys.Command, *cmdRecorder, error) {
+	cmd, rec, err := r.prepareRecording(cmd)
+	if err != nil {
+		return cmd, nil, err
+	}
+
+	rec.index = r.reserve()
+
+	return cmd, rec, nil
+}
+
+func (r *RecordingCmdRunner) prepareRecording(cmd boshsys.Command) (boshsys.Command, *cmdRecorder, error) {
+	rec := &cmdRecorder{
+		recording: CmdRecording{
+			Name:       cmd.Name,
+			Args:       r.redactor.RedactArgs(cmd),
+			Env:        r.redactor.RedactEnv(cmd),
+			WorkingDir: cmd.WorkingDir,
+		},
+		redact: func(s string) string { return r.redactor.Redact(cmd, s) },
+	}
+
+	if cmd.Stdin != nil {
+		stdin, err := io.ReadAll(cmd.Stdin)
+		if err != nil {
+			return cmd, nil, bosherr.WrapErrorf(err, "Reading stdin of command '%s'", cmd.Name)
+		}
+
+		rec.recording.Stdin = r.redactor.Redact(cmd, string(stdin))
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	if cmd.Stdout != nil {
+		rec.stdout = &bytes.Buffer{}
+		cmd.Stdout = io.MultiWriter(cmd.Stdout, rec.stdout)
+	}
+
+	if cmd.Stderr != nil {
+		rec.stderr = &bytes.Buffer{}
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, rec.stderr)
+	}
+
+	return cmd, rec, nil
+}
+
+func (r *RecordingCmdRunner) finishRecording(rec *cmdRecorder, stdout, stderr string, exitStatus int, err error) {
+	rec.finish(stdout, stderr, exitStatus, err)
+	r.record(rec.index, rec.recording)
+}
+
+func (r *RecordingCmdRunner) recordProcess(rec *cmdRecorder, process boshsys.Process, err error) (boshsys.Process, error) {
+	if err != nil {
+		rec.finish("", "", -1, err)
+		rec.recording.NotStarted = true
+		r.record(rec.index, rec.recording)
+		return nil, err
+	}
+
+	return &recordingProcess{Process: process, onResult: func(result boshsys.Result) {
+		r.finishRecording(rec, result.Stdout, result.Stderr, result.ExitStatus, result.Error)
+	}}, nil
+}
+
+func (r *RecordingCmdRunner) recordCommand(index int, input, cmdName string, args []string, stdout, stderr string, exitStatus int, err error) {
+	cmd := boshsys.Command{Name: cmdName, Args: args}
+
+	rec := CmdRecording{
+		Name:       cmdName,
+		Args:       r.redactor.RedactArgs(cmd),
+		Stdin:      r.redactor.Redact(cmd, input),
+		Stdout:     r.redactor.Redact(cmd, stdout),
+		Stderr:     r.redactor.Redact(cmd, stderr),
+		ExitStatus: exitStatus,
+	}
+
+	setRecordingError(&rec, err, func(s string) string { return r.redactor.Redact(cmd, s) })
+
+	r.record(index, rec)
+}
+
+// reserve returns the slot of a command that is about to start
+func (r *RecordingCmdRunner) reserve() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.recordings.Commands = append(r.recordings.Commands, CmdRecording{})
+	r.finished = append(r.finished, false)
+
+	return len(r.recordings.Commands) - 1
+}
+
+func (r *RecordingCmdRunner) record(index int, rec CmdRecording) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.recordings.Commands[index] = rec
+	r.finished[index] = true
+}
+
+func (r *RecordingCmdRunner) finishedRecordings() []CmdRecording {
+	recordings := []CmdRecording{}
+	for i, rec := range r.recordings.Commands {
+		if r.finished[i] {
+			recordings = append(recordings, rec)
+		}
+	}
+	return recordings
+}
+
+func (rec *cmdRecorder) finish(stdout, stderr string, exitStatus int, err error) {
+	if rec.stdout != nil {
+		stdout = rec.stdout.String()
+	}
+
+	if rec.stderr != nil {
+		stderr = rec.stderr.String()
+	}
+
+	rec.recording.Stdout = rec.redact(stdout)
+	rec.recording.Stderr = rec.redact(stderr)
+	rec.recording.ExitStatus = exitStatus
+
+	setRecordingError(&rec.recording, err, rec.redact)
+}
+
+// setRecordingError records the redacted message of err, since errors
+// such as ExecError contain the whole command line
+func setRecordingError(rec *CmdRecording, err error, redact func(string) string) {
+	if err == nil {
+		return
+	}
+
+	cmdErr, ok := err.(boshsys.CommandError)
+	if !ok {
+		rec.Error = redact(err.Error())
+		return
+	}
+
+	rec.ErrorReason = cmdErr.Reason
+	if cmdErr.Err != nil {
+		rec.Error = redact(cmdErr.Err.Error())
+	}
+}
+
+// recordingProcess records the result of the process it wraps
+// when it is received from Wait
+type recordingProcess struct {
+	boshsys.Process
+
+	onResult func(boshsys.Result)
+}
+
+func (p *recordingProcess) Wait() <-chan boshsys.Result {
+	resultCh := make(chan boshsys.Result, 1)
+	processResultCh := p.Process.Wait()
+
+	go func() {
+		result := <-processResultCh
+		p.onResult(result)
+		resultCh <- result
+	}()
+
+	return resultCh
+}
@@ -0,0 +1,223 @@
+package fakes_test
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/bosh-utils/system"
+	. "github.com/cloudfoundry/bosh-utils/system/fakes"
+)
+
+var _ = Describe("RecordingCmdRunner", func() {
+	var (
+		fs        *FakeFileSystem
+		cmdRunner *FakeCmdRunner
+		recorder  *RecordingCmdRunner
+	)
+
+	BeforeEach(func() {
+		fs = NewFakeFileSystem()
+		cmdRunner = NewFakeCmdRunner()
+		recorder = NewRecordingCmdRunner(cmdRunner, fs, "/fixtures/commands.json", []*regexp.Regexp{regexp.MustCompile(`s3cr3\w`)})
+	})
+
+	It("records the invocations and results of the commands it runs", func() {
+		cmdRunner.AddCmdResult("tar -xzf a.tgz", FakeCmdResult{Stdout: "extracted", ExitStatus: 0})
+		cmdRunner.AddCmdResult("iptables -L", FakeCmdResult{Stderr: "denied", ExitStatus: 4, Error: errors.New("fake-err")})
+
+		stdout, _, _, err := recorder.RunComplexCommand(Command{
+			Name:       "tar",
+			Args:       []string{"-xzf", "a.tgz"},
+			Env:        map[string]string{"FOO": "bar"},
+			WorkingDir: "/tmp",
+			Stdin:      strings.NewReader("fake-stdin"),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stdout).To(Equal("extracted"))
+
+		_, _, exitStatus, err := recorder.RunCommand("iptables", "-L")
+		Expect(err).To(MatchError("fake-err"))
+		Expect(exitStatus).To(Equal(4))
+
+		Expect(recorder.Recordings()).To(Equal([]CmdRecording{
+			{
+				Name:       "tar",
+				Args:       []string{"-xzf", "a.tgz"},
+				Env:        map[string]string{"FOO": "bar"},
+				WorkingDir: "/tmp",
+				Stdin:      "fake-stdin",
+				Stdout:     "extracted",
+			},
+			{
+				Name:       "iptables",
+				Args:       []string{"-L"},
+				Stderr:     "denied",
+				ExitStatus: 4,
+				Error:      "fake-err",
+			},
+		}))
+	})
+
+	It("passes stdin on to the command after reading it", func() {
+		var stdin bytes.Buffer
+		cmdRunner.SetCmdCallback("cat", func() {
+			stdin.ReadFrom(cmdRunner.RunComplexCommands[0].Stdin) //nolint:errcheck
+		})
+
+		_, _, _, err := recorder.RunComplexCommand(Command{Name: "cat", Stdin: strings.NewReader("fake-stdin")})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(stdin.String()).To(Equal("fake-stdin"))
+	})
+
+	It("records output written to custom writers", func() {
+		cmdRunner.AddCmdResult("echo hi", FakeCmdResult{Stdout: "hi\n"})
+
+		var stdout bytes.Buffer
+		_, _, _, err := recorder.RunComplexCommand(Command{Name: "echo", Args: []string{"hi"}, Stdout: &stdout})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(stdout.String()).To(Equal("hi\n"))
+		Expect(recorder.Recordings()[0].Stdout).To(Equal("hi\n"))
+	})
+
+	It("records the result of async commands once they are waited for", func() {
+		cmdRunner.AddProcess("sleep 1", &FakeProcess{WaitResult: Result{Stdout: "done", ExitStatus: 0}})
+
+		process, err := recorder.RunComplexCommandAsync(Command{Name: "sleep", Args: []string{"1"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(recorder.Recordings()).To(BeEmpty())
+
+		result := <-process.Wait()
+		Expect(result.Stdout).To(Equal("done"))
+
+		Expect(recorder.Recordings()).To(Equal([]CmdRecording{{Name: "sleep", Args: []string{"1"}, Stdout: "done"}}))
+	})
+
+	It("records overlapping async commands in the order they started", func() {
+		cmdRunner.AddProcess("sleep 2", &FakeProcess{WaitResult: Result{Stdout: "slow"}})
+		cmdRunner.AddProcess("sleep 1", &FakeProcess{WaitResult: Result{Stdout: "fast"}})
+
+		slow, err := recorder.RunComplexCommandAsync(Command{Name: "sleep", Args: []string{"2"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		fast, err := recorder.RunComplexCommandAsync(Command{Name: "sleep", Args: []string{"1"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		<-fast.Wait()
+		Expect(recorder.Recordings()).To(Equal([]CmdRecording{{Name: "sleep", Args: []string{"1"}, Stdout: "fast"}}))
+
+		<-slow.Wait()
+		Expect(recorder.Recordings()).To(Equal([]CmdRecording{
+			{Name: "sleep", Args: []string{"2"}, Stdout: "slow"},
+			{Name: "sleep", Args: []string{"1"}, Stdout: "fast"},
+		}))
+	})
+
+	It("saves only the commands that finished", func() {
+		cmdRunner.AddProcess("sleep 1", &FakeProcess{WaitResult: Result{}})
+
+		_, err := recorder.RunComplexCommandAsync(Command{Name: "sleep", Args: []string{"1"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, _, err = recorder.RunCommand("sync")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(recorder.Save()).To(Succeed())
+
+		contents, err := fs.ReadFileString("/fixtures/commands.json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(contents).To(ContainSubstring(`"sync"`))
+		Expect(contents).ToNot(ContainSubstring(`"sleep"`))
+	})
+
+	It("redacts args, env values and stdin before recording them", func() {
+		cmdRunner.AddCmdResult("mysql --password=s3cr3t -u admin:hunter2", FakeCmdResult{})
+		cmdRunner.AddCmdResult("s3cr3t\n chpasswd", FakeCmdResult{})
+
+		_, _, _, err := recorder.RunComplexCommand(Command{
+			Name:   "mysql",
+			Args:   []string{"--password=s3cr3t", "-u", "admin:hunter2"},
+			Env:    map[string]string{"MYSQL_PWD": "s3cr3t", "DB_PASSWORD": "other", "HOME": "/root"},
+			Stdin:  strings.NewReader("SET PASSWORD = 's3cr3t'"),
+			Redact: func(s string) string { return strings.ReplaceAll(s, "hunter2", "***") },
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, _, _, err = recorder.RunCommandWithInput("s3cr3t\n", "chpasswd")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(recorder.Recordings()).To(Equal([]CmdRecording{
+			{
+				Name:  "mysql",
+				Args:  []string{"--password=<redacted>", "-u", "admin:***"},
+				Env:   map[string]string{"MYSQL_PWD": "<redacted>", "DB_PASSWORD": "<redacted>", "HOME": "/root"},
+				Stdin: "SET PASSWORD = '<redacted>'",
+			},
+			{Name: "chpasswd", Stdin: "<redacted>\n"},
+		}))
+
+		Expect(recorder.Save()).To(Succeed())
+
+		contents, err := fs.ReadFileString("/fixtures/commands.json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(contents).ToNot(ContainSubstring("s3cr3t"))
+		Expect(contents).ToNot(ContainSubstring("hunter2"))
+	})
+
+	It("redacts the output and errors of failing commands with secrets", func() {
+		execErr := NewExecError("mysql --password=s3cr3t", "welcome s3cr3t", "denied s3cr3t")
+		cmdRunner.AddCmdResult("mysql --password=s3cr3t", FakeCmdResult{Stdout: "welcome s3cr3t", Stderr: "denied s3cr3t", ExitStatus: 1, Error: execErr})
+		cmdRunner.AddCmdResult("mysql --password=s3cr3t", FakeCmdResult{Stdout: "welcome s3cr3t", Stderr: "denied s3cr3t", ExitStatus: 1, Error: execErr})
+
+		_, _, _, err := recorder.RunComplexCommand(Command{Name: "mysql", Args: []string{"--password=s3cr3t"}})
+		Expect(err).To(HaveOccurred())
+
+		_, _, _, err = recorder.RunCommand("mysql", "--password=s3cr3t")
+		Expect(err).To(HaveOccurred())
+
+		recordings := recorder.Recordings()
+		Expect(recordings).To(HaveLen(2))
+
+		for _, recording := range recordings {
+			Expect(recording.Stdout).To(Equal("welcome <redacted>"))
+			Expect(recording.Stderr).To(Equal("denied <redacted>"))
+			Expect(recording.Error).To(ContainSubstring("mysql --password=<redacted>"))
+		}
+
+		Expect(recorder.Save()).To(Succeed())
+
+		contents, err := fs.ReadFileString("/fixtures/commands.json")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(contents).ToNot(ContainSubstring("s3cr3t"))
+	})
+
+	It("records commands with secrets that are replayed after being saved", func() {
+		cmdRunner.AddCmdResult("mysql --password=s3cr3t", FakeCmdResult{Stdout: "connected"})
+
+		cmd := Command{
+			Name: "mysql",
+			Args: []string{"--password=s3cr3t"},
+			Env:  map[string]string{"MYSQL_PWD": "s3cr3t"},
+		}
+
+		_, _, _, err := recorder.RunComplexCommand(cmd)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(recorder.Save()).To(Succeed())
+
+		replayer, err := NewReplayingCmdRunner(fs, "/fixtures/commands.json", StrictReplayOrder)
+		Expect(err).ToNot(HaveOccurred())
+
+		stdout, _, _, err := replayer.RunComplexCommand(cmd)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stdout).To(Equal("connected"))
+
+		Expect(replayer.ExpectAllReplayed()).To(Succeed())
+	})
+})
@@ -0,0 +1,402 @@
+package fakes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshsys "github.com/cloudfoundry/bosh-utils/system"
+)
+
+type ReplayOrder int
+
+const (
+	// StrictReplayOrder requires commands to run in the recorded order
+	StrictReplayOrder ReplayOrder = iota
+
+	// LenientReplayOrder serves the first matching recording that was not
+	// served yet, regardless of the order commands run in
+	LenientReplayOrder
+)
+
+// ReplayingCmdRunner serves back the commands recorded by RecordingCmdRunner.
+// A command matches a recording when its name, args, env, working dir and
+// stdin are the same, after they are redacted like they were when recorded.
+// Running a command that does not match returns an error describing how it
+// differs from the expected recording.
+type ReplayingCmdRunner struct {
+	recordings CmdRecordings
+	order      ReplayOrder
+	redactor   boshsys.SecretRedactor
+
+	replayed   []bool
+	unexpected []string
+	lock       sync.Mutex
+}
+
+func NewReplayingCmdRunner(fs boshsys.FileSystem, path string, order ReplayOrder) (*ReplayingCmdRunner, error) {
+	contents, err := fs.ReadFile(path)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Reading command recordings from '%s'", path)
+	}
+
+	var recordings CmdRecordings
+
+	err = json.Unmarshal(contents, &recordings)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Unmarshalling command recordings from '%s'", path)
+	}
+
+	for _, pattern := range recordings.SecretPatterns {
+		_, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Compiling secret pattern of command recordings from '%s'", path)
+		}
+	}
+
+	return NewReplayingCmdRunnerWithRecordings(recordings, order), nil
+}
+
+// NewReplayingCmdRunnerWithRecordings panics when
+// the secret patterns of the recordings are invalid
+func NewReplayingCmdRunnerWithRecordings(recordings CmdRecordings, order ReplayOrder) *ReplayingCmdRunner {
+	var secretPatterns []*regexp.Regexp
+	for _, pattern := range recordings.SecretPatterns {
+		secretPatterns = append(secretPatterns, regexp.MustCompile(pattern))
+	}
+
+	return &ReplayingCmdRunner{
+		recordings: recordings,
+		order:      order,
+		redactor:   boshsys.NewSecretRedactor(secretPatterns),
+		replayed:   make([]bool, len(recordings.Commands)),
+	}
+}
+
+// ExpectAllReplayed returns an error listing the unexpected commands that
+// were run and the recordings that were not served
+func (r *ReplayingCmdRunner) ExpectAllReplayed() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	problems := append([]string{}, r.unexpected...)
+
+	for i, replayed := range r.replayed {
+		if !replayed {
+			problems = append(problems, fmt.Sprintf("Recorded command %d '%s' was not run", i+1, r.recordings.Commands[i]))
+		}
+	}
+
+	if len(problems) > 0 {
+		return bosherr.Errorf("Replaying commands:\n%s", strings.Join(problems, "\n"))
+	}
+
+	return nil
+}
+
+func (r *ReplayingCmdRunner) RunComplexCommand(cmd boshsys.Command) (string, string, int, error) {
+	rec, err := r.replay(cmd)
+	if err != nil {
+		return "", "", -1, err
+	}
+
+	stdout, stderr := writeReplayedOutput(cmd, rec.Stdout, rec.Stderr)
+
+	return stdout, stderr, rec.ExitStatus, replayedError(rec)
+}
+
+func (r *ReplayingCmdRunner) RunComplexCommandContext(ctx context.Context, cmd boshsys.Command) (string, string, int, error) {
+	err := commandContextErr(ctx, cmd.Name)
+	if err != nil {
+		return "", "", -1, err
+	}
+
+	return r.RunComplexCommand(cmd)
+}
+
+func (r *ReplayingCmdRunner) RunComplexCommandAsync(cmd boshsys.Command) (boshsys.Process, error) {
+	rec, err := r.replay(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if rec.NotStarted {
+		return nil, replayedError(rec)
+	}
+
+	stdout, stderr := writeReplayedOutput(cmd, rec.Stdout, rec.Stderr)
+
+	return &FakeProcess{
+		WaitResult: boshsys.Result{
+			Stdout:     stdout,
+			Stderr:     stderr,
+			ExitStatus: rec.ExitStatus,
+			Error:      replayedError(rec),
+		},
+	}, nil
+}
+
+func (r *ReplayingCmdRunner) RunComplexCommandAsyncContext(ctx context.Context, cmd boshsys.Command) (boshsys.Process, error) {
+	err := commandContextErr(ctx, cmd.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.RunComplexCommandAsync(cmd)
+}
+
+func (r *ReplayingCmdRunner) RunPipeline(ctx context.Context, cmds ...boshsys.Command) (boshsys.PipelineResult, error) {
+	if len(cmds) == 0 {
+		return boshsys.PipelineResult{}, errors.New("Running pipeline: No commands")
+	}
+
+	err := commandContextErr(ctx, cmds[0].Name)
+	if err != nil {
+		return boshsys.PipelineResult{ExitStatus: -1}, err
+	}
+
+	actual := CmdRecording{}
+
+	for i, cmd := range cmds {
+		stage, err := r.newActualRecording(cmd)
+		if err != nil {
+			return boshsys.PipelineResult{ExitStatus: -1}, err
+		}
+
+		if i > 0 {
+			stage.Stdin = ""
+		}
+
+		actual.Pipeline = append(actual.Pipeline, stage)
+	}
+
+	rec, err := r.replayRecording(actual)
+	if err != nil {
+		return boshsys.PipelineResult{ExitStatus: -1}, err
+	}
+
+	result := boshsys.PipelineResult{ExitStatus: rec.ExitStatus}
+
+	for _, stage := range rec.Pipeline {
+		result.Results = append(result.Results, boshsys.Result{
+			Stdout:     stage.Stdout,
+			Stderr:     stage.Stderr,
+			ExitStatus: stage.ExitStatus,
+			Error:      replayedError(stage),
+		})
+	}
+
+	last := len(cmds) - 1
+	result.Results[last].Stdout, _ = writeReplayedOutput(cmds[last], rec.Pipeline[last].Stdout, "")
+	result.Stdout = result.Results[last].Stdout
+
+	return result, replayedError(rec)
+}
+
+func (r *ReplayingCmdRunner) RunCommand(cmdName string, args ...string) (string, string, int, error) {
+	return r.RunComplexCommand(boshsys.Command{Name: cmdName, Args: args})
+}
+
+func (r *ReplayingCmdRunner) RunCommandContext(ctx context.Context, cmdName string, args ...string) (string, string, int, error) {
+	return r.RunComplexCommandContext(ctx, boshsys.Command{Name: cmdName, Args: args})
+}
+
+func (r *ReplayingCmdRunner) RunCommandQuietly(cmdName string, args ...string) (string, string, int, error) {
+	return r.RunComplexCommand(boshsys.Command{Name: cmdName, Args: args})
+}
+
+func (r *ReplayingCmdRunner) RunCommandWithInput(input, cmdName string, args ...string) (string, string, int, error) {
+	return r.RunComplexCommand(boshsys.Command{Name: cmdName, Args: args, Stdin: strings.NewReader(input)})
+}
+
+// CommandExists returns whether the command existed when it was recorded
+func (r *ReplayingCmdRunner) CommandExists(cmdName string) bool {
+	return r.recordings.CommandExists[cmdName]
+}
+
+func (r *ReplayingCmdRunner) replay(cmd boshsys.Command) (CmdRecording, error) {
+	actual, err := r.newActualRecording(cmd)
+	if err != nil {
+		return CmdRecording{}, err
+	}
+
+	return r.replayRecording(actual)
+}
+
+func (r *ReplayingCmdRunner) replayRecording(actual CmdRecording) (CmdRecording, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	next := -1
+	for i, replayed := range r.replayed {
+		if !replayed {
+			next = i
+			break
+		}
+	}
+
+	if next < 0 {
+		return CmdRecording{}, r.unexpectedErr(fmt.Sprintf("Unexpected command '%s': all recorded commands were run", actual))
+	}
+
+	if r.order == StrictReplayOrder {
+		expected := r.recordings.Commands[next]
+
+		diff := diffRecordings("", expected, actual)
+		if len(diff) > 0 {
+			return CmdRecording{}, r.unexpectedErr(fmt.Sprintf(
+				"Unexpected command '%s', expected recorded command %d '%s':\n%s", actual, next+1, expected, strings.Join(diff, "\n")))
+		}
+
+		r.replayed[next] = true
+		return expected, nil
+	}
+
+	closest := -1
+	var closestDiff []string
+
+	for i, expected := range r.recordings.Commands {
+		if r.replayed[i] {
+			continue
+		}
+
+		diff := diffRecordings("", expected, actual)
+		if len(diff) == 0 {
+			r.replayed[i] = true
+			return expected, nil
+		}
+
+		if expected.Name == actual.Name && (closest < 0 || len(diff) < len(closestDiff)) {
+			closest = i
+			closestDiff = diff
+		}
+	}
+
+	if closest < 0 {
+		return CmdRecording{}, r.unexpectedErr(fmt.Sprintf("Unexpected command '%s': no remaining recorded command is similar", actual))
+	}
+
+	return CmdRecording{}, r.unexpectedErr(fmt.Sprintf(
+		"Unexpected command '%s', closest remaining recorded command is %d '%s':\n%s",
+		actual, closest+1, r.recordings.Commands[closest], strings.Join(closestDiff, "\n")))
+}
+
+func (r *ReplayingCmdRunner) unexpectedErr(msg string) error {
+	r.unexpected = append(r.unexpected, msg)
+	return errors.New(msg)
+}
+
+func (r *ReplayingCmdRunner) newActualRecording(cmd boshsys.Command) (CmdRecording, error) {
+	actual := CmdRecording{
+		Name:       cmd.Name,
+		Args:       r.redactor.RedactArgs(cmd),
+		Env:        r.redactor.RedactEnv(cmd),
+		WorkingDir: cmd.WorkingDir,
+	}
+
+	if cmd.Stdin != nil {
+		stdin, err := io.ReadAll(cmd.Stdin)
+		if err != nil {
+			return actual, bosherr.WrapErrorf(err, "Reading stdin of command '%s'", cmd.Name)
+		}
+
+		actual.Stdin = r.redactor.Redact(cmd, string(stdin))
+	}
+
+	return actual, nil
+}
+
+// diffRecordings returns a line for every field of the invocation that differs,
+// followed by the expected and actual values prefixed with - and +
+func diffRecordings(prefix string, expected, actual CmdRecording) []string {
+	if len(expected.Pipeline) > 0 || len(actual.Pipeline) > 0 {
+		if len(expected.Pipeline) != len(actual.Pipeline) {
+			return diffField(prefix+"pipeline", expected.String(), actual.String())
+		}
+
+		var diff []string
+		for i := range expected.Pipeline {
+			diff = append(diff, diffRecordings(fmt.Sprintf("%scommand %d ", prefix, i+1), expected.Pipeline[i], actual.Pipeline[i])...)
+		}
+		return diff
+	}
+
+	var diff []string
+
+	if expected.Name != actual.Name {
+		diff = append(diff, diffField(prefix+"name", expected.Name, actual.Name)...)
+	}
+
+	if !reflect.DeepEqual(emptyToNil(expected.Args), emptyToNil(actual.Args)) {
+		diff = append(diff, diffField(prefix+"args", expected.Args, actual.Args)...)
+	}
+
+	if len(expected.Env) != len(actual.Env) || (len(expected.Env) > 0 && !reflect.DeepEqual(expected.Env, actual.Env)) {
+		diff = append(diff, diffField(prefix+"env", expected.Env, actual.Env)...)
+	}
+
+	if expected.WorkingDir != actual.WorkingDir {
+		diff = append(diff, diffField(prefix+"working dir", expected.WorkingDir, actual.WorkingDir)...)
+	}
+
+	if expected.Stdin != actual.Stdin {
+		diff = append(diff, diffField(prefix+"stdin", expected.Stdin, actual.Stdin)...)
+	}
+
+	return diff
+}
+
+func diffField(name string, expected, actual interface{}) []string {
+	return []string{
+		fmt.Sprintf("  %s:", name),
+		fmt.Sprintf("  - %q", expected),
+		fmt.Sprintf("  + %q", actual),
+	}
+}
+
+func emptyToNil(args []string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+// writeReplayedOutput writes the replayed output to the custom Stdout and
+// Stderr of cmd and to its line callbacks, and returns the stdout that is
+// and stderr captured by the runner
+func writeReplayedOutput(cmd boshsys.Command, stdout, stderr string) (string, string) {
+	callLineCallback(cmd.OnStdoutLine, stdout)
+	callLineCallback(cmd.OnStderrLine, stderr)
+
+	if cmd.Stdout != nil {
+		cmd.Stdout.Write([]byte(stdout)) //nolint:errcheck
+		stdout = ""
+	}
+
+	if cmd.Stderr != nil {
+		cmd.Stderr.Write([]byte(stderr)) //nolint:errcheck
+		stderr = ""
+	}
+
+	return stdout, stderr
+}
+
+func replayedError(rec CmdRecording) error {
+	var err error
+	if rec.Error != "" {
+		err = errors.New(rec.Error)
+	}
+
+	if rec.ErrorReason != "" {
+		return boshsys.CommandError{Reason: rec.ErrorReason, ExitStatus: rec.ExitStatus, Err: err}
+	}
+
+	return err
+}
@@ -0,0 +1,205 @@
+package fakes_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/bosh-utils/system"
+	. "github.com/cloudfoundry/bosh-utils/system/fakes"
+)
+
+var _ = Describe("RecordingCmdRunner and ReplayingCmdRunner", func() {
+	var (
+		fs        *FakeFileSystem
+		cmdRunner *FakeCmdRunner
+		recorder  *RecordingCmdRunner
+	)
+
+	BeforeEach(func() {
+		fs = NewFakeFileSystem()
+		cmdRunner = NewFakeCmdRunner()
+		recorder = NewRecordingCmdRunner(cmdRunner, fs, "/fixtures/commands.json", nil)
+	})
+
+	replayer := func(order ReplayOrder) *ReplayingCmdRunner {
+		Expect(recorder.Save()).To(Succeed())
+
+		replayer, err := NewReplayingCmdRunner(fs, "/fixtures/commands.json", order)
+		Expect(err).ToNot(HaveOccurred())
+
+		return replayer
+	}
+
+	Describe("ReplayingCmdRunner", func() {
+		BeforeEach(func() {
+			cmdRunner.AddCmdResult("tar -xzf a.tgz", FakeCmdResult{Stdout: "extracted\n"})
+			cmdRunner.AddCmdResult("fake-input sfdisk -l", FakeCmdResult{Stdout: "partitions\n", Stderr: "warning\n"})
+			cmdRunner.AvailableCommands["tar"] = true
+
+			_, _, _, err := recorder.RunComplexCommand(Command{Name: "tar", Args: []string{"-xzf", "a.tgz"}})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, _, _, err = recorder.RunCommandWithInput("fake-input", "sfdisk", "-l")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(recorder.CommandExists("tar")).To(BeTrue())
+			Expect(recorder.CommandExists("iptables")).To(BeFalse())
+		})
+
+		It("serves back recorded results", func() {
+			runner := replayer(StrictReplayOrder)
+
+			var stdoutLines []string
+			stdout, _, _, err := runner.RunComplexCommand(Command{
+				Name:         "tar",
+				Args:         []string{"-xzf", "a.tgz"},
+				OnStdoutLine: func(line string) { stdoutLines = append(stdoutLines, line) },
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("extracted\n"))
+			Expect(stdoutLines).To(Equal([]string{"extracted"}))
+
+			stdout, stderr, _, err := runner.RunComplexCommand(Command{Name: "sfdisk", Args: []string{"-l"}, Stdin: strings.NewReader("fake-input")})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("partitions\n"))
+			Expect(stderr).To(Equal("warning\n"))
+
+			Expect(runner.CommandExists("tar")).To(BeTrue())
+			Expect(runner.CommandExists("iptables")).To(BeFalse())
+
+			Expect(runner.ExpectAllReplayed()).To(Succeed())
+		})
+
+		It("returns an error describing how a command differs from the next recorded one in strict order", func() {
+			runner := replayer(StrictReplayOrder)
+
+			_, _, _, err := runner.RunCommandWithInput("other-input", "sfdisk", "-l")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal(`Unexpected command 'sfdisk -l', expected recorded command 1 'tar -xzf a.tgz':
+  name:
+  - "tar"
+  + "sfdisk"
+  args:
+  - ["-xzf" "a.tgz"]
+  + ["-l"]
+  stdin:
+  - ""
+  + "other-input"`))
+
+			err = runner.ExpectAllReplayed()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Unexpected command 'sfdisk -l'"))
+			Expect(err.Error()).To(ContainSubstring("Recorded command 1 'tar -xzf a.tgz' was not run"))
+			Expect(err.Error()).To(ContainSubstring("Recorded command 2 'sfdisk -l' was not run"))
+		})
+
+		It("serves recordings in any order in lenient order", func() {
+			runner := replayer(LenientReplayOrder)
+
+			stdout, _, _, err := runner.RunCommandWithInput("fake-input", "sfdisk", "-l")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("partitions\n"))
+
+			stdout, _, _, err = runner.RunCommand("tar", "-xzf", "a.tgz")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(stdout).To(Equal("extracted\n"))
+
+			Expect(runner.ExpectAllReplayed()).To(Succeed())
+		})
+
+		It("returns an error describing how a command differs from the closest recording in lenient order", func() {
+			runner := replayer(LenientReplayOrder)
+
+			_, _, _, err := runner.RunCommand("tar", "-czf", "a.tgz")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal(`Unexpected command 'tar -czf a.tgz', closest remaining recorded command is 1 'tar -xzf a.tgz':
+  args:
+  - ["-xzf" "a.tgz"]
+  + ["-czf" "a.tgz"]`))
+
+			_, _, _, err = runner.RunCommand("iptables", "-L")
+			Expect(err).To(MatchError("Unexpected command 'iptables -L': no remaining recorded command is similar"))
+		})
+
+		It("returns an error when all recorded commands were run", func() {
+			runner := replayer(StrictReplayOrder)
+
+			_, _, _, err := runner.RunCommand("tar", "-xzf", "a.tgz")
+			Expect(err).ToNot(HaveOccurred())
+			_, _, _, err = runner.RunCommandWithInput("fake-input", "sfdisk", "-l")
+			Expect(err).ToNot(HaveOccurred())
+
+			_, _, _, err = runner.RunCommand("tar", "-xzf", "a.tgz")
+			Expect(err).To(MatchError("Unexpected command 'tar -xzf a.tgz': all recorded commands were run"))
+		})
+	})
+
+	It("replays command errors", func() {
+		cmdRunner.AddCmdResult("false", FakeCmdResult{ExitStatus: 1, Error: errors.New("fake-err")})
+
+		_, _, _, err := recorder.RunComplexCommandContext(context.Background(), Command{Name: "false"})
+		Expect(err).To(MatchError("fake-err"))
+
+		runner := replayer(StrictReplayOrder)
+
+		_, _, exitStatus, err := runner.RunComplexCommandContext(context.Background(), Command{Name: "false"})
+		Expect(err).To(MatchError("fake-err"))
+		Expect(exitStatus).To(Equal(1))
+	})
+
+	It("replays timed out commands as CommandErrors", func() {
+		recordings := CmdRecordings{Commands: []CmdRecording{
+			{Name: "sleep", Args: []string{"60"}, ExitStatus: 143, ErrorReason: CommandTimedOut, Error: "fake-err"},
+		}}
+
+		runner := NewReplayingCmdRunnerWithRecordings(recordings, StrictReplayOrder)
+
+		_, _, exitStatus, err := runner.RunComplexCommand(Command{Name: "sleep", Args: []string{"60"}})
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(err).To(MatchError("Command timed out (exit status 143): fake-err"))
+		Expect(exitStatus).To(Equal(143))
+	})
+
+	It("records and replays async commands", func() {
+		cmdRunner.AddProcess("sleep 1", &FakeProcess{WaitResult: Result{Stdout: "done", ExitStatus: 0}})
+
+		process, err := recorder.RunComplexCommandAsync(Command{Name: "sleep", Args: []string{"1"}})
+		Expect(err).ToNot(HaveOccurred())
+		<-process.Wait()
+
+		runner := replayer(StrictReplayOrder)
+
+		process, err = runner.RunComplexCommandAsync(Command{Name: "sleep", Args: []string{"1"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		result := <-process.Wait()
+		Expect(result.Stdout).To(Equal("done"))
+	})
+
+	It("records and replays pipelines", func() {
+		cmdRunner.AddCmdResult("tar -cf -", FakeCmdResult{})
+		cmdRunner.AddCmdResult("gzip", FakeCmdResult{Stdout: "compressed"})
+
+		cmds := []Command{{Name: "tar", Args: []string{"-cf", "-"}}, {Name: "gzip"}}
+
+		result, err := recorder.RunPipeline(context.Background(), cmds...)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Stdout).To(Equal("compressed"))
+
+		runner := replayer(StrictReplayOrder)
+
+		_, err = runner.RunPipeline(context.Background(), Command{Name: "tar", Args: []string{"-cf", "-"}}, Command{Name: "bzip2"})
+		Expect(err).To(MatchError(ContainSubstring("command 2 name:\n  - \"gzip\"\n  + \"bzip2\"")))
+
+		runner = replayer(StrictReplayOrder)
+
+		result, err = runner.RunPipeline(context.Background(), cmds...)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(result.Stdout).To(Equal("compressed"))
+		Expect(result.Results).To(HaveLen(2))
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // File is a subset of os.File
@@ -16,6 +17,11 @@ type File interface {
 	Name() string
 }
 
+// FileLock is an advisory lock on a file held until Unlock is called
+type FileLock interface {
+	Unlock() error
+}
+
 type FileSystem interface {
 	HomeDir(username string) (path string, err error)
 	ExpandPath(path string) (expandedPath string, err error)
@@ -27,6 +33,7 @@ type FileSystem interface {
 
 	Chown(path, username string) error
 	Chmod(path string, perm os.FileMode) error
+	Chtimes(path string, atime time.Time, mtime time.Time) error
 
 	OpenFile(path string, flag int, perm os.FileMode) (File, error)
 
@@ -35,6 +42,17 @@ type FileSystem interface {
 	WriteFileQuietly(path string, content []byte) error
 	ConvergeFileContents(path string, content []byte, opts ...ConvergeFileContentsOpts) (written bool, err error)
 
+	// WriteFileAtomically replaces the file at path so that it has either its
+	// old or its new content, even after a crash. The content is written to a
+	// temp file in the same dir, which is synced and renamed over the file.
+	// An existing file keeps its mode and owner, and a symlink its target.
+	WriteFileAtomically(path string, content []byte) error
+
+	// LockFile acquires an advisory lock on the file at path, creating it
+	// if needed. Locks are held by open files, so a process holding a lock
+	// conflicts with its own locks on the same file as well.
+	LockFile(path string, opts LockOpts) (FileLock, error)
+
 	ReadFileString(path string) (content string, err error)
 	ReadFile(path string) (content []byte, err error)
 	ReadFileWithOpts(path string, opts ReadOpts) (content []byte, err error)
@@ -46,11 +64,19 @@ type FileSystem interface {
 
 	Rename(oldPath, newPath string) error
 
+	// ReplaceFile renames the file or symlink at oldPath to newPath. Unlike
+	// Rename, an existing file at newPath is not removed first, so that newPath
+	// refers to either the old or the new file at any time.
+	ReplaceFile(oldPath, newPath string) error
+
 	// After Symlink file at newPath will be pointing to file at oldPath.
 	// Symlink call will remove file at newPath if one exists
 	// to make newPath a symlink to the file at oldPath.
 	Symlink(oldPath, newPath string) error
 
+	// Link creates newPath as a hard link to the file at oldPath
+	Link(oldPath, newPath string) error
+
 	ReadAndFollowLink(symlinkPath string) (targetPath string, err error)
 	Readlink(symlinkPath string) (targetPath string, err error)
 
@@ -65,4 +91,8 @@ type FileSystem interface {
 	Glob(pattern string) (matches []string, err error)
 	RecursiveGlob(pattern string) (matches []string, err error)
 	Walk(root string, walkFunc filepath.WalkFunc) error
+
+	// Watch reports changes to the file or dir at path until the Watcher
+	// is closed. Dirs are not watched recursively.
+	Watch(path string, opts WatchOpts) (Watcher, error)
 }
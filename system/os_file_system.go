@@ -3,11 +3,14 @@ package system
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/bmatcuk/doublestar"
 	bosherr "github.com/cloudfoundry/bosh-utils/errors"
@@ -73,6 +76,11 @@ func (fs *osFileSystem) Chmod(path string, perm os.FileMode) (err error) {
 	return os.Chmod(path, perm)
 }
 
+func (fs *osFileSystem) Chtimes(path string, atime time.Time, mtime time.Time) error {
+	fs.logger.Debug(fs.logTag, "Chtimes %s to %s", path, mtime)
+	return os.Chtimes(path, atime, mtime)
+}
+
 func (fs *osFileSystem) openFile(path string, flag int, perm os.FileMode) (*os.File, error) {
 	return os.OpenFile(path, flag, perm)
 }
@@ -144,19 +152,27 @@ func (fs *osFileSystem) writeFileHelper(path string, content []byte, logDebug bo
 
 type ConvergeFileContentsOpts struct {
 	DryRun bool
+
+	// Atomic writes the file with WriteFileAtomically
+	Atomic bool
 }
 
 func (fs *osFileSystem) ConvergeFileContents(path string, content []byte, opts ...ConvergeFileContentsOpts) (bool, error) {
 	actuallyConverge := true
+	writeFile := fs.WriteFile
 
 	if len(opts) > 0 {
 		actuallyConverge = !opts[0].DryRun
+
+		if opts[0].Atomic {
+			writeFile = fs.WriteFileAtomically
+		}
 	}
 
 	fi, err := fs.Stat(path)
 	if err != nil || fi.Size() != int64(len(content)) {
 		if actuallyConverge {
-			return true, fs.WriteFile(path, content)
+			return true, writeFile(path, content)
 		}
 		return true, nil
 	}
@@ -180,12 +196,166 @@ func (fs *osFileSystem) ConvergeFileContents(path string, content []byte, opts .
 	if actuallyConverge {
 		fs.logger.Debug(fs.logTag, "File %s will be overwritten", path)
 		file.Close()
-		return true, fs.WriteFile(path, content)
+		return true, writeFile(path, content)
 	}
 
 	return true, nil
 }
 
+func (fs *osFileSystem) WriteFileAtomically(path string, content []byte) error {
+	fs.logger.Debug(fs.logTag, "Atomically writing %s", path)
+
+	// Replacing the target of a symlink keeps the symlink
+	target, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		path = target
+	}
+
+	dir := filepath.Dir(path)
+
+	err = fs.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return bosherr.WrapError(err, "Creating dir to write file")
+	}
+
+	file, err := createAtomicWriteFile(dir, filepath.Base(path))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Creating temp file to write %s", path)
+	}
+
+	renamed := false
+
+	defer func() {
+		if !renamed {
+			file.Close()           //nolint:errcheck
+			os.Remove(file.Name()) //nolint:errcheck
+		}
+	}()
+
+	fs.logger.DebugWithDetails(fs.logTag, "Write content", content)
+
+	_, err = file.Write(content)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing content to temp file %s", file.Name())
+	}
+
+	fi, err := os.Stat(path)
+	if err == nil {
+		err = file.Chmod(fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky))
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Preserving mode of %s", path)
+		}
+
+		err = preserveOwner(file, fi)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Preserving owner of %s", path)
+		}
+	} else if !os.IsNotExist(err) {
+		return bosherr.WrapErrorf(err, "Checking file %s", path)
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Syncing temp file %s", file.Name())
+	}
+
+	err = file.Close()
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Closing temp file %s", file.Name())
+	}
+
+	err = os.Rename(file.Name(), path)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Renaming temp file %s to %s", file.Name(), path)
+	}
+
+	renamed = true
+
+	// The rename is only durable once the dir is synced
+	err = syncDir(dir)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Syncing dir %s", dir)
+	}
+
+	return nil
+}
+
+// createAtomicWriteFile creates a hidden temp file in dir with the
+// permissions of files created by WriteFile
+func createAtomicWriteFile(dir, name string) (*os.File, error) {
+	for i := 0; ; i++ {
+		path := filepath.Join(dir, fmt.Sprintf(".%s.tmp-%d", name, rand.Uint32()))
+
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && i < 100 {
+			continue
+		}
+
+		return file, err
+	}
+}
+
+type LockOpts struct {
+	// Shared locks can be held together with other shared locks,
+	// while an exclusive lock excludes all other locks
+	Shared bool
+
+	// Timeout is how long to wait for the lock; waits until the lock
+	// is acquired when zero
+	Timeout time.Duration
+}
+
+const fileLockPollInterval = 10 * time.Millisecond
+
+func (fs *osFileSystem) LockFile(path string, opts LockOpts) (FileLock, error) {
+	lockType := "exclusive"
+	if opts.Shared {
+		lockType = "shared"
+	}
+
+	fs.logger.Debug(fs.logTag, "Acquiring %s lock on %s", lockType, path)
+
+	file, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Opening file %s to lock", path)
+	}
+
+	deadline := time.Now().Add(opts.Timeout)
+
+	for {
+		locked, err := tryLockFile(file, opts.Shared)
+		if err != nil {
+			file.Close() //nolint:errcheck
+			return nil, bosherr.WrapErrorf(err, "Acquiring %s lock on %s", lockType, path)
+		}
+
+		if locked {
+			return &osFileLock{file: file}, nil
+		}
+
+		if opts.Timeout > 0 && time.Now().After(deadline) {
+			file.Close() //nolint:errcheck
+			return nil, bosherr.Errorf("Timed out after %s acquiring %s lock on %s", opts.Timeout, lockType, path)
+		}
+
+		time.Sleep(fileLockPollInterval)
+	}
+}
+
+type osFileLock struct {
+	file *os.File
+}
+
+func (l *osFileLock) Unlock() error {
+	err := unlockFile(l.file)
+	if err != nil {
+		l.file.Close() //nolint:errcheck
+		return bosherr.WrapErrorf(err, "Releasing lock on %s", l.file.Name())
+	}
+
+	return l.file.Close()
+}
+
 type ReadOpts struct {
 	Quiet bool
 }
@@ -246,6 +416,18 @@ func (fs *osFileSystem) Rename(oldPath, newPath string) (err error) {
 	return os.Rename(oldPath, newPath)
 }
 
+func (fs *osFileSystem) ReplaceFile(oldPath, newPath string) error {
+	fs.logger.Debug(fs.logTag, "Replacing %s with %s", newPath, oldPath)
+
+	return os.Rename(oldPath, newPath)
+}
+
+func (fs *osFileSystem) Link(oldPath, newPath string) error {
+	fs.logger.Debug(fs.logTag, "Hard linking %s to %s", newPath, oldPath)
+
+	return os.Link(oldPath, newPath)
+}
+
 func (fs *osFileSystem) Symlink(oldPath, newPath string) error {
 	fs.logger.Debug(fs.logTag, "Symlinking oldPath %s with newPath %s", oldPath, newPath)
 
@@ -413,6 +595,11 @@ func (fs *osFileSystem) Walk(root string, walkFunc filepath.WalkFunc) error {
 	return filepath.Walk(root, walkFunc)
 }
 
+func (fs *osFileSystem) Watch(path string, opts WatchOpts) (Watcher, error) {
+	fs.logger.Debug(fs.logTag, "Watching %s", path)
+	return newWatcher(path, opts, fs.logger)
+}
+
 func (fs *osFileSystem) runCommand(cmd string) (string, error) { //nolint:unused
 	var stdout bytes.Buffer
 	shCmd := exec.Command("sh", "-c", cmd)
@@ -7,6 +7,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -166,6 +167,23 @@ var _ = Describe("OS FileSystem", func() {
 		Expect(fileStat.Mode()).To(Equal(compStat.Mode()))
 	})
 
+	It("chtimes", func() {
+		osFs := createOsFs()
+		testPath := filepath.Join(TempDir, "ChtimesTestFile")
+
+		_, err := os.Create(testPath)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.Remove(testPath)
+
+		modTime := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+		err = osFs.Chtimes(testPath, modTime, modTime)
+		Expect(err).ToNot(HaveOccurred())
+
+		fileStat, err := os.Stat(testPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fileStat.ModTime()).To(BeTemporally("==", modTime))
+	})
+
 	It("opens file", func() {
 		osFs := createOsFs()
 		testPath := filepath.Join(TempDir, "OpenFileTestFile")
@@ -205,6 +223,132 @@ var _ = Describe("OS FileSystem", func() {
 		})
 	})
 
+	Describe("WriteFileAtomically", func() {
+		It("replaces the file, creating its dir, without leaving temp files", func() {
+			osFs := createOsFs()
+			testPath := filepath.Join(TempDir, "subDir", "WriteFileAtomicallyTestFile")
+
+			err := osFs.WriteFileAtomically(testPath, []byte("initial write"))
+			Expect(err).ToNot(HaveOccurred())
+
+			err = osFs.WriteFileAtomically(testPath, []byte("second"))
+			Expect(err).ToNot(HaveOccurred())
+
+			content, err := os.ReadFile(testPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("second"))
+
+			entries, err := os.ReadDir(filepath.Dir(testPath))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+
+		It("preserves the mode of an existing file", func() {
+			osFs := createOsFs()
+			testPath := filepath.Join(TempDir, "WriteFileAtomicallyTestFile")
+
+			Expect(os.WriteFile(testPath, []byte("initial write"), 0400)).To(Succeed())
+
+			err := osFs.WriteFileAtomically(testPath, []byte("second write"))
+			Expect(err).ToNot(HaveOccurred())
+
+			fi, err := os.Stat(testPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fi.Mode()).To(Equal(os.FileMode(0400)))
+		})
+
+		It("keeps existing readers of the old file reading the old content", func() {
+			osFs := createOsFs()
+			testPath := filepath.Join(TempDir, "WriteFileAtomicallyTestFile")
+
+			Expect(os.WriteFile(testPath, []byte("initial write"), 0644)).To(Succeed())
+
+			file, err := os.Open(testPath)
+			Expect(err).ToNot(HaveOccurred())
+			defer file.Close() //nolint:errcheck
+
+			err = osFs.WriteFileAtomically(testPath, []byte("second write"))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(readFile(file)).To(Equal("initial write"))
+		})
+
+		It("writes atomically when converging file contents with the Atomic option", func() {
+			osFs := createOsFs()
+			testPath := filepath.Join(TempDir, "ConvergeFileContentsTestFile")
+
+			Expect(os.WriteFile(testPath, []byte("initial write"), 0600)).To(Succeed())
+
+			written, err := osFs.ConvergeFileContents(testPath, []byte("second write!"), ConvergeFileContentsOpts{Atomic: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(written).To(BeTrue())
+
+			content, err := os.ReadFile(testPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("second write!"))
+
+			fi, err := os.Stat(testPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0600)))
+		})
+	})
+
+	Describe("LockFile", func() {
+		var (
+			osFs     FileSystem
+			lockPath string
+		)
+
+		BeforeEach(func() {
+			osFs = createOsFs()
+			lockPath = filepath.Join(TempDir, "lock")
+		})
+
+		It("creates the file and times out while an exclusive lock is held", func() {
+			lock, err := osFs.LockFile(lockPath, LockOpts{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(osFs.FileExists(lockPath)).To(BeTrue())
+
+			_, err = osFs.LockFile(lockPath, LockOpts{Shared: true, Timeout: 50 * time.Millisecond})
+			Expect(err).To(MatchError(ContainSubstring("Timed out after 50ms acquiring shared lock on")))
+
+			Expect(lock.Unlock()).To(Succeed())
+
+			lock, err = osFs.LockFile(lockPath, LockOpts{Timeout: 50 * time.Millisecond})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lock.Unlock()).To(Succeed())
+		})
+
+		It("allows several shared locks but no exclusive lock at the same time", func() {
+			lock1, err := osFs.LockFile(lockPath, LockOpts{Shared: true})
+			Expect(err).ToNot(HaveOccurred())
+
+			lock2, err := osFs.LockFile(lockPath, LockOpts{Shared: true, Timeout: 50 * time.Millisecond})
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = osFs.LockFile(lockPath, LockOpts{Timeout: 50 * time.Millisecond})
+			Expect(err).To(MatchError(ContainSubstring("Timed out after 50ms acquiring exclusive lock on")))
+
+			Expect(lock1.Unlock()).To(Succeed())
+			Expect(lock2.Unlock()).To(Succeed())
+		})
+
+		It("waits for the lock to be released", func() {
+			lock, err := osFs.LockFile(lockPath, LockOpts{})
+			Expect(err).ToNot(HaveOccurred())
+
+			go func() {
+				defer GinkgoRecover()
+				time.Sleep(100 * time.Millisecond)
+				Expect(lock.Unlock()).To(Succeed())
+			}()
+
+			lock, err = osFs.LockFile(lockPath, LockOpts{Timeout: 5 * time.Second})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(lock.Unlock()).To(Succeed())
+		})
+	})
+
 	Describe("ConvergeFileContents", func() {
 		It("converges file", func() {
 			osFs := createOsFs()
@@ -455,6 +599,57 @@ var _ = Describe("OS FileSystem", func() {
 		Expect(osFs.FileExists(newFilePath)).To(BeTrue())
 	})
 
+	Describe("ReplaceFile", func() {
+		It("renames the file over the existing file", func() {
+			osFs := createOsFs()
+			newPath := filepath.Join(TempDir, "ReplaceFileTestNew")
+			filePath := filepath.Join(TempDir, "ReplaceFileTestFile")
+			defer os.Remove(newPath)  //nolint:errcheck
+			defer os.Remove(filePath) //nolint:errcheck
+
+			Expect(osFs.WriteFileString(newPath, "new content")).To(Succeed())
+			Expect(osFs.WriteFileString(filePath, "old content")).To(Succeed())
+
+			Expect(osFs.ReplaceFile(newPath, filePath)).To(Succeed())
+
+			Expect(osFs.ReadFileString(filePath)).To(Equal("new content"))
+			Expect(osFs.FileExists(newPath)).To(BeFalse())
+		})
+
+		It("does not remove a directory at the new path", func() {
+			osFs := createOsFs()
+			newPath := filepath.Join(TempDir, "ReplaceFileTestNew")
+			dirPath := filepath.Join(TempDir, "ReplaceFileTestDir")
+			defer os.Remove(newPath)    //nolint:errcheck
+			defer os.RemoveAll(dirPath) //nolint:errcheck
+
+			Expect(osFs.WriteFileString(newPath, "new content")).To(Succeed())
+			Expect(osFs.WriteFileString(filepath.Join(dirPath, "file"), "content")).To(Succeed())
+
+			Expect(osFs.ReplaceFile(newPath, dirPath)).ToNot(Succeed())
+			Expect(osFs.FileExists(filepath.Join(dirPath, "file"))).To(BeTrue())
+		})
+	})
+
+	Describe("Link", func() {
+		It("creates a hard link to the file", func() {
+			osFs := createOsFs()
+			filePath := filepath.Join(TempDir, "LinkTestFile")
+			linkPath := filepath.Join(TempDir, "LinkTestLink")
+			defer os.Remove(filePath) //nolint:errcheck
+			defer os.Remove(linkPath) //nolint:errcheck
+
+			Expect(osFs.WriteFileString(filePath, "some content")).To(Succeed())
+			Expect(osFs.Link(filePath, linkPath)).To(Succeed())
+
+			fileStats, err := os.Stat(filePath)
+			Expect(err).ToNot(HaveOccurred())
+			linkStats, err := os.Lstat(linkPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.SameFile(fileStats, linkStats)).To(BeTrue())
+		})
+	})
+
 	Describe("Symlink", func() {
 
 		It("creates a symlink", func() {
@@ -6,20 +6,17 @@ package system
 import (
 	"errors"
 	"fmt"
+	"os"
 	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
 
 	bosherr "github.com/cloudfoundry/bosh-utils/errors"
 )
 
 func (fs *osFileSystem) homeDir(username string) (string, error) {
-	homeDir, err := fs.runCommand(fmt.Sprintf("echo ~%s", username))
-	if err != nil {
-		return "", bosherr.WrapErrorf(err, "Shelling out to get user '%s' home directory", username)
-	}
-	if strings.HasPrefix(homeDir, "~") {
-		return "", bosherr.Errorf("Failed to get user '%s' home directory", username)
-	}
-	return homeDir, nil
+	return lookupHomeDir(username)
 }
 
 func (fs *osFileSystem) chown(path, owner string) error {
@@ -34,7 +31,7 @@ func (fs *osFileSystem) chown(path, owner string) error {
 	user := ownerSplit[0]
 
 	if len(ownerSplit) <= 1 {
-		group, err = fs.runCommand(fmt.Sprintf("id -g %s", user))
+		group, err = lookupPrimaryGroupID(user)
 		if err != nil {
 			return bosherr.WrapErrorf(err, "failed to lookup user '%s'", user)
 		}
@@ -53,3 +50,53 @@ func (fs *osFileSystem) chown(path, owner string) error {
 func (fs *osFileSystem) symlinkPaths(oldPath, newPath string) (old, new string, err error) {
 	return oldPath, newPath, nil
 }
+
+func preserveOwner(file *os.File, fi os.FileInfo) error {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	uid, gid := int(stat.Uid), int(stat.Gid)
+
+	tempFi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	tempStat, ok := tempFi.Sys().(*syscall.Stat_t)
+	if ok && int(tempStat.Uid) == uid && int(tempStat.Gid) == gid {
+		return nil
+	}
+
+	return file.Chown(uid, gid)
+}
+
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close() //nolint:errcheck
+
+	return file.Sync()
+}
+
+func tryLockFile(file *os.File, shared bool) (bool, error) {
+	how := unix.LOCK_EX
+	if shared {
+		how = unix.LOCK_SH
+	}
+
+	err := unix.Flock(int(file.Fd()), how|unix.LOCK_NB)
+	if err == unix.EWOULDBLOCK || err == unix.EINTR {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func unlockFile(file *os.File) error {
+	return unix.Flock(int(file.Fd()), unix.LOCK_UN)
+}
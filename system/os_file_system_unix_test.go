@@ -228,4 +228,51 @@ var _ = Describe("OS FileSystem", func() {
 			Expect(homeDir).To(Equal(expDir))
 		})
 	})
+
+	Describe("WriteFileAtomically", func() {
+		BeforeEach(func() {
+			if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+				Skip("This test can only run as `root` on Linux")
+			}
+		})
+
+		It("preserves the owner of an existing file", func() {
+			testPath := filepath.Join(GinkgoT().TempDir(), "WriteFileAtomicallyTestFile")
+
+			Expect(os.WriteFile(testPath, []byte("initial write"), 0644)).To(Succeed())
+			Expect(os.Chown(testPath, 65534, 65534)).To(Succeed())
+
+			osFs := NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+
+			err := osFs.WriteFileAtomically(testPath, []byte("second write"))
+			Expect(err).ToNot(HaveOccurred())
+
+			fi, err := os.Stat(testPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fi.Sys().(*syscall.Stat_t).Uid).To(Equal(uint32(65534)))
+			Expect(fi.Sys().(*syscall.Stat_t).Gid).To(Equal(uint32(65534)))
+		})
+
+		It("replaces the target of a symlink", func() {
+			dir := GinkgoT().TempDir()
+			targetPath := filepath.Join(dir, "target")
+			linkPath := filepath.Join(dir, "link")
+
+			Expect(os.WriteFile(targetPath, []byte("initial write"), 0644)).To(Succeed())
+			Expect(os.Symlink(targetPath, linkPath)).To(Succeed())
+
+			osFs := NewOsFileSystem(boshlog.NewLogger(boshlog.LevelNone))
+
+			err := osFs.WriteFileAtomically(linkPath, []byte("second write"))
+			Expect(err).ToNot(HaveOccurred())
+
+			fi, err := os.Lstat(linkPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fi.Mode() & os.ModeSymlink).ToNot(BeZero())
+
+			content, err := os.ReadFile(targetPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("second write"))
+		})
+	})
 })
@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"golang.org/x/sys/windows"
+
 	bosherr "github.com/cloudfoundry/bosh-utils/errors"
 )
 
@@ -56,3 +58,32 @@ func (fs *osFileSystem) symlinkPaths(oldPath, newPath string) (old, new string,
 	}
 	return
 }
+
+// preserveOwner does nothing since files created on Windows
+// inherit the permissions of their dir
+func preserveOwner(file *os.File, fi os.FileInfo) error {
+	return nil
+}
+
+// syncDir does nothing since dirs cannot be synced on Windows
+func syncDir(dir string) error {
+	return nil
+}
+
+func tryLockFile(file *os.File, shared bool) (bool, error) {
+	flags := uint32(windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if !shared {
+		flags |= windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+
+	err := windows.LockFileEx(windows.Handle(file.Fd()), flags, 0, 1, 0, &windows.Overlapped{})
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func unlockFile(file *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
@@ -0,0 +1,60 @@
+package system
+
+import (
+	"time"
+)
+
+// ResourceLimits are applied to a command before it is executed, and thus
+// to all processes it starts. Zero values leave the limits of the parent in place.
+// Resource limits are only supported on Linux.
+//
+// To set rlimits, the command is started through /bin/sh, which waits until
+// they are set with prlimit(2) before it executes the command by its path.
+// Raising them above the hard limits of the parent requires CAP_SYS_RESOURCE.
+type ResourceLimits struct {
+	// OpenFiles is the maximum number of open file descriptors (RLIMIT_NOFILE)
+	OpenFiles uint64
+
+	// AddressSpace is the maximum size of virtual memory in bytes (RLIMIT_AS)
+	AddressSpace uint64
+
+	// CPUTime is the maximum CPU time, rounded up to seconds (RLIMIT_CPU)
+	CPUTime time.Duration
+
+	// CoreSize is the maximum size of core dumps in bytes (RLIMIT_CORE).
+	// Set DisableCoreDumps to prevent core dumps altogether.
+	CoreSize         uint64
+	DisableCoreDumps bool
+
+	// Cgroup places the command into a cgroup v2 when set
+	Cgroup *CgroupLimits
+}
+
+type CgroupLimits struct {
+	// Path of the cgroup relative to the cgroup v2 hierarchy mounted at
+	// /sys/fs/cgroup. It is created along with its parents when missing and
+	// removed after the command exits if it was created for the command.
+	Path string
+
+	// MemoryMax is the memory limit in bytes (memory.max)
+	MemoryMax uint64
+
+	// CPUMax is the number of CPUs the command may use, e.g. 0.5 (cpu.max)
+	CPUMax float64
+}
+
+// rlimitConfig is an rlimit to set on a command
+type rlimitConfig struct {
+	name     string
+	resource int
+	value    uint64
+}
+
+func (l ResourceLimits) isZero() bool {
+	return l.OpenFiles == 0 &&
+		l.AddressSpace == 0 &&
+		l.CPUTime == 0 &&
+		l.CoreSize == 0 &&
+		!l.DisableCoreDumps &&
+		l.Cgroup == nil
+}
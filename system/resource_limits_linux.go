@@ -0,0 +1,279 @@
+package system
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+const (
+	cgroupRoot      = "/sys/fs/cgroup"
+	cgroupCPUPeriod = 100000
+
+	// rlimitGateScript waits for the limits to be set before it executes the
+	// command, and exits without executing it when the gate closes without
+	// being opened, e.g. when the parent failed to set them or died.
+	// The fd of the gate is the first argument of Sprintf.
+	rlimitGateScript = `read -r _ <&%[1]d || exit 127; exec %[1]d<&-; exec "$0" "$@"`
+)
+
+// prepareResourceLimits creates the cgroup of the command so that the
+// command starts in it, and starts the command behind a gate when it has rlimits
+func (p *execProcess) prepareResourceLimits() error {
+	err := p.prepareCgroup()
+	if err != nil {
+		return err
+	}
+
+	err = p.prepareRlimits()
+	if err != nil {
+		p.cleanUpResourceLimits()
+		return err
+	}
+
+	return nil
+}
+
+func (p *execProcess) prepareCgroup() error {
+	cgroup := p.limits.Cgroup
+	if cgroup == nil {
+		return nil
+	}
+
+	err := p.createCgroup(cgroupRoot, *cgroup)
+	if err != nil {
+		p.cleanUpResourceLimits()
+		return bosherr.WrapErrorf(err, "Creating cgroup '%s'", cgroup.Path)
+	}
+
+	dir, err := os.Open(p.cgroupDir)
+	if err != nil {
+		p.cleanUpResourceLimits()
+		return bosherr.WrapErrorf(err, "Opening cgroup '%s'", cgroup.Path)
+	}
+
+	p.cgroupFile = dir
+
+	if p.cmd.SysProcAttr == nil {
+		p.cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	p.cmd.SysProcAttr.UseCgroupFD = true
+	p.cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+
+	return nil
+}
+
+// prepareRlimits starts the command through a shell that waits on a pipe until
+// awaitResourceLimits has set the rlimits of the shell, which then executes the
+// command. Rlimits are inherited on exec, so the command cannot start any
+// process before its rlimits are set.
+func (p *execProcess) prepareRlimits() error {
+	limits := []struct {
+		rlimitConfig
+		set bool
+	}{
+		{rlimitConfig{"open files", unix.RLIMIT_NOFILE, p.limits.OpenFiles}, p.limits.OpenFiles > 0},
+		{rlimitConfig{"address space", unix.RLIMIT_AS, p.limits.AddressSpace}, p.limits.AddressSpace > 0},
+		{rlimitConfig{"CPU time", unix.RLIMIT_CPU, uint64(math.Ceil(p.limits.CPUTime.Seconds()))}, p.limits.CPUTime > 0},
+		{rlimitConfig{"core size", unix.RLIMIT_CORE, p.limits.CoreSize}, p.limits.CoreSize > 0 || p.limits.DisableCoreDumps},
+	}
+
+	for _, limit := range limits {
+		if limit.set {
+			p.rlimits = append(p.rlimits, limit.rlimitConfig)
+		}
+	}
+
+	if len(p.rlimits) == 0 {
+		return nil
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return bosherr.WrapError(err, "Creating rlimit gate")
+	}
+
+	p.rlimitGateReader = reader
+	p.rlimitGateWriter = writer
+
+	// Extra files start at fd 3 in the command
+	gateFD := 3 + len(p.cmd.ExtraFiles)
+	p.cmd.ExtraFiles = append(p.cmd.ExtraFiles, reader)
+
+	p.cmd.Args = append([]string{"sh", "-c", fmt.Sprintf(rlimitGateScript, gateFD), p.cmd.Path}, p.cmd.Args[1:]...)
+	p.cmd.Path = "/bin/sh"
+
+	return nil
+}
+
+// awaitResourceLimits sets the rlimits of the started command
+// and then lets it execute the command
+func (p *execProcess) awaitResourceLimits() error {
+	if p.cgroupFile != nil {
+		p.cgroupFile.Close() //nolint:errcheck
+		p.cgroupFile = nil
+	}
+
+	if p.rlimitGateWriter == nil {
+		return nil
+	}
+
+	p.rlimitGateReader.Close() //nolint:errcheck
+	p.rlimitGateReader = nil
+
+	for _, limit := range p.rlimits {
+		err := unix.Prlimit(p.pid, limit.resource, &unix.Rlimit{Cur: limit.value, Max: limit.value}, nil)
+		if err != nil {
+			return bosherr.WrapErrorf(err, "Limiting %s to %d", limit.name, limit.value)
+		}
+	}
+
+	_, err := p.rlimitGateWriter.Write([]byte("\n"))
+
+	p.rlimitGateWriter.Close() //nolint:errcheck
+	p.rlimitGateWriter = nil
+
+	if err != nil {
+		return bosherr.WrapError(err, "Opening rlimit gate")
+	}
+
+	return nil
+}
+
+// cleanUpResourceLimits removes the cgroups created for the command
+func (p *execProcess) cleanUpResourceLimits() {
+	if p.cgroupFile != nil {
+		p.cgroupFile.Close() //nolint:errcheck
+		p.cgroupFile = nil
+	}
+
+	if p.rlimitGateReader != nil {
+		p.rlimitGateReader.Close() //nolint:errcheck
+		p.rlimitGateReader = nil
+	}
+
+	if p.rlimitGateWriter != nil {
+		p.rlimitGateWriter.Close() //nolint:errcheck
+		p.rlimitGateWriter = nil
+	}
+
+	for i := len(p.createdCgroupDirs) - 1; i >= 0; i-- {
+		err := os.Remove(p.createdCgroupDirs[i])
+		if err != nil {
+			p.logger.Error(execProcessLogTag, "Removing cgroup '%s': %s", p.createdCgroupDirs[i], err.Error())
+			return
+		}
+	}
+
+	p.createdCgroupDirs = nil
+}
+
+func (p *execProcess) createCgroup(root string, cgroup CgroupLimits) error {
+	var stat unix.Statfs_t
+
+	err := unix.Statfs(root, &stat)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Checking cgroup file system '%s'", root)
+	}
+
+	if stat.Type != unix.CGROUP2_SUPER_MAGIC {
+		return bosherr.Errorf("'%s' is not a cgroup v2 file system", root)
+	}
+
+	relPath := filepath.Clean(string(filepath.Separator) + cgroup.Path)
+	if relPath == string(filepath.Separator) {
+		return bosherr.Error("Cgroup path must not be empty")
+	}
+
+	var controllers []string
+	if cgroup.MemoryMax > 0 {
+		controllers = append(controllers, "memory")
+	}
+	if cgroup.CPUMax > 0 {
+		controllers = append(controllers, "cpu")
+	}
+
+	dir := root
+
+	for _, name := range strings.Split(strings.TrimPrefix(relPath, string(filepath.Separator)), string(filepath.Separator)) {
+		// Controllers are enabled for the children of every ancestor
+		err = enableCgroupControllers(dir, controllers)
+		if err != nil {
+			return err
+		}
+
+		dir = filepath.Join(dir, name)
+
+		err = os.Mkdir(dir, 0755)
+		if err == nil {
+			p.createdCgroupDirs = append(p.createdCgroupDirs, dir)
+		} else if !os.IsExist(err) {
+			return bosherr.WrapErrorf(err, "Creating '%s'", dir)
+		}
+	}
+
+	p.cgroupDir = dir
+
+	if cgroup.MemoryMax > 0 {
+		err = writeCgroupFile(dir, "memory.max", fmt.Sprintf("%d", cgroup.MemoryMax))
+		if err != nil {
+			return err
+		}
+	}
+
+	if cgroup.CPUMax > 0 {
+		quota := int64(math.Ceil(cgroup.CPUMax * cgroupCPUPeriod))
+
+		err = writeCgroupFile(dir, "cpu.max", fmt.Sprintf("%d %d", quota, cgroupCPUPeriod))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func enableCgroupControllers(dir string, controllers []string) error {
+	if len(controllers) == 0 {
+		return nil
+	}
+
+	enabled, err := os.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Reading controllers of '%s'", dir)
+	}
+
+	var missing []string
+
+	for _, controller := range controllers {
+		if !slices.Contains(strings.Fields(string(enabled)), controller) {
+			missing = append(missing, "+"+controller)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return writeCgroupFile(dir, "cgroup.subtree_control", strings.Join(missing, " "))
+}
+
+func writeCgroupFile(dir, name, content string) error {
+	path := filepath.Join(dir, name)
+
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		return bosherr.WrapErrorf(err, "Writing '%s' to '%s'", content, path)
+	}
+
+	return nil
+}
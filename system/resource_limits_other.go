@@ -0,0 +1,18 @@
+//go:build !linux
+
+package system
+
+import (
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+func (p *execProcess) prepareResourceLimits() error {
+	if !p.limits.isZero() {
+		return bosherr.Error("Resource limits are only supported on Linux")
+	}
+	return nil
+}
+
+func (p *execProcess) awaitResourceLimits() error { return nil }
+
+func (p *execProcess) cleanUpResourceLimits() {}
@@ -0,0 +1,95 @@
+package system
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RedactedSecret replaces secrets in the commands that are logged or recorded
+const RedactedSecret = "<redacted>"
+
+// secretEnvNamePattern matches the names of Env variables whose values are
+// secrets, e.g. MYSQL_PASSWORD or AWS_SECRET_ACCESS_KEY. The words must be
+// whole parts of the name, so that e.g. KEYBOARD or MONKEY_PATH do not match.
+var secretEnvNamePattern = regexp.MustCompile(`(?i)(^|_)(PASSWORD|PASSWD|SECRET|TOKEN|KEY|CREDENTIALS?)(_|$)`)
+
+// SecretRedactor replaces secrets in commands before they are logged or
+// recorded. Command.Redact is applied first, then matches of the secret
+// patterns are replaced with RedactedSecret. The values of Env variables
+// with names like PASSWORD, SECRET, TOKEN or KEY are always redacted.
+type SecretRedactor struct {
+	secretPatterns []*regexp.Regexp
+}
+
+func NewSecretRedactor(secretPatterns []*regexp.Regexp) SecretRedactor {
+	return SecretRedactor{secretPatterns: secretPatterns}
+}
+
+// Patterns returns the secret patterns of the redactor
+func (r SecretRedactor) Patterns() []*regexp.Regexp {
+	return r.secretPatterns
+}
+
+// Redact redacts a string belonging to a command, such as an arg or an error
+func (r SecretRedactor) Redact(cmd Command, s string) string {
+	if cmd.Redact != nil {
+		s = cmd.Redact(s)
+	}
+
+	return r.redactSecrets(s)
+}
+
+func (r SecretRedactor) redactSecrets(s string) string {
+	for _, pattern := range r.secretPatterns {
+		s = pattern.ReplaceAllLiteralString(s, RedactedSecret)
+	}
+
+	return s
+}
+
+// RedactArgs returns the redacted args of a command
+func (r SecretRedactor) RedactArgs(cmd Command) []string {
+	var args []string
+	for _, arg := range cmd.Args {
+		args = append(args, r.Redact(cmd, arg))
+	}
+	return args
+}
+
+// RedactEnv returns the redacted Env of a command
+func (r SecretRedactor) RedactEnv(cmd Command) map[string]string {
+	if len(cmd.Env) == 0 {
+		return nil
+	}
+
+	env := map[string]string{}
+	for name, value := range cmd.Env {
+		if secretEnvNamePattern.MatchString(name) {
+			env[name] = RedactedSecret
+		} else {
+			env[name] = r.Redact(cmd, value)
+		}
+	}
+
+	return env
+}
+
+// CommandString returns the redacted command line of a command or pipeline.
+// Command.Redact is applied to the whole command line of each command.
+func (r SecretRedactor) CommandString(cmds ...Command) string {
+	var cmdStrings []string
+	for _, cmd := range cmds {
+		parts := []string{cmd.Name}
+		for _, arg := range cmd.Args {
+			parts = append(parts, r.redactSecrets(arg))
+		}
+
+		cmdString := strings.Join(parts, " ")
+		if cmd.Redact != nil {
+			cmdString = cmd.Redact(cmdString)
+		}
+
+		cmdStrings = append(cmdStrings, cmdString)
+	}
+	return strings.Join(cmdStrings, " | ")
+}
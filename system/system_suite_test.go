@@ -25,6 +25,7 @@ var catPath string
 var falsePath string
 var windowsExePath string
 var priorityPath string
+var credentialsPath string
 
 var _ = SynchronizedBeforeSuite(func() []byte {
 	workingDir, err := filepath.Abs(".")
@@ -35,6 +36,7 @@ var _ = SynchronizedBeforeSuite(func() []byte {
 	paths = append(paths, buildFixtureCmd(workingDir, "exec_cmd_runner_fixtures/false/"))
 	paths = append(paths, buildFixtureCmd(workingDir, "exec_cmd_runner_fixtures/windows_exe/"))
 	paths = append(paths, buildFixtureCmd(workingDir, "exec_cmd_runner_fixtures/priority"))
+	paths = append(paths, buildFixtureCmd(workingDir, "exec_cmd_runner_fixtures/credentials"))
 
 	return []byte(strings.Join(paths, "|"))
 }, func(data []byte) {
@@ -44,6 +46,7 @@ var _ = SynchronizedBeforeSuite(func() []byte {
 	falsePath = paths[1]
 	windowsExePath = paths[2]
 	priorityPath = paths[3]
+	credentialsPath = paths[4]
 })
 
 var _ = SynchronizedAfterSuite(func() {}, func() {
@@ -0,0 +1,121 @@
+//go:build !windows
+
+package system
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+// Users and groups are looked up with id(1), getent(1) and the shell rather
+// than os/user so that they are found in every configured name service,
+// whether or not the binary was built with cgo.
+
+func lookupHomeDir(username string) (string, error) {
+	homeDir, err := runLookupCommand("sh", "-c", fmt.Sprintf("echo ~%s", username))
+	if err != nil {
+		return "", bosherr.WrapErrorf(err, "Shelling out to get user '%s' home directory", username)
+	}
+	if strings.HasPrefix(homeDir, "~") {
+		return "", bosherr.Errorf("Failed to get user '%s' home directory", username)
+	}
+	return homeDir, nil
+}
+
+// lookupUserName returns the name of a user given by name or uid
+func lookupUserName(username string) (string, error) {
+	return runLookupCommand("id", "-un", username)
+}
+
+func lookupUserID(username string) (uint32, error) {
+	id, err := runLookupCommand("id", "-u", username)
+	if err != nil {
+		return 0, err
+	}
+	return parseLookupID(id)
+}
+
+func lookupPrimaryGroupID(username string) (string, error) {
+	return runLookupCommand("id", "-g", username)
+}
+
+func lookupGroupIDs(username string) ([]uint32, error) {
+	output, err := runLookupCommand("id", "-G", username)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint32
+
+	for _, field := range strings.Fields(output) {
+		id, err := parseLookupID(field)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// lookupGroupID returns the id of a group given by name or gid.
+// os/user is only used where getent is not available, e.g. on macOS.
+func lookupGroupID(group string) (uint32, error) {
+	if id, err := parseLookupID(group); err == nil {
+		return id, nil
+	}
+
+	if _, err := exec.LookPath("getent"); err != nil {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return 0, err
+		}
+
+		return parseLookupID(g.Gid)
+	}
+
+	entry, err := runLookupCommand("getent", "group", group)
+	if err != nil {
+		return 0, bosherr.WrapErrorf(err, "Looking up group '%s'", group)
+	}
+
+	// Entries are name:password:gid:members
+	fields := strings.Split(entry, ":")
+	if len(fields) < 3 {
+		return 0, bosherr.Errorf("Parsing entry of group '%s': '%s'", group, entry)
+	}
+
+	return parseLookupID(fields[2])
+}
+
+func parseLookupID(id string) (uint32, error) {
+	parsed, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return 0, bosherr.WrapErrorf(err, "Parsing id '%s'", id)
+	}
+	return uint32(parsed), nil
+}
+
+func runLookupCommand(name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		if stderr.Len() > 0 {
+			return "", bosherr.WrapError(err, strings.TrimSpace(stderr.String()))
+		}
+		return "", err
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
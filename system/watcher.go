@@ -0,0 +1,389 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+	boshlog "github.com/cloudfoundry/bosh-utils/logger"
+)
+
+// DefaultWatchPollInterval is how often files are checked
+// for changes when they cannot be watched with inotify
+const DefaultWatchPollInterval = time.Second
+
+// WatchOp is a set of changes made to a file
+type WatchOp uint32
+
+const (
+	WatchCreate WatchOp = 1 << iota
+	WatchWrite
+	WatchRemove
+
+	// WatchRename is reported for the old path of a file. A file renamed
+	// to the watched path is reported as created.
+	WatchRename
+)
+
+func (op WatchOp) Has(other WatchOp) bool {
+	return op&other == other
+}
+
+func (op WatchOp) String() string {
+	var names []string
+
+	for _, o := range []struct {
+		op   WatchOp
+		name string
+	}{{WatchCreate, "create"}, {WatchWrite, "write"}, {WatchRemove, "remove"}, {WatchRename, "rename"}} {
+		if op.Has(o.op) {
+			names = append(names, o.name)
+		}
+	}
+
+	return strings.Join(names, "|")
+}
+
+type WatchEvent struct {
+	Path string
+	Op   WatchOp
+}
+
+type WatchOpts struct {
+	// Debounce delays events until a path did not change for this long,
+	// merging the changes made to it meanwhile into a single event
+	Debounce time.Duration
+
+	// Poll checks for changes every PollInterval instead of using inotify.
+	// Polling is also used where inotify is not available.
+	// Renames are reported as removes and creates when polling.
+	Poll         bool
+	PollInterval time.Duration
+}
+
+// Watcher reports changes to a file, or to a dir and its direct children,
+// including files that do not exist yet. The path is treated as a dir
+// whenever it is one, also when it is created or replaced after watching it.
+type Watcher interface {
+	Events() <-chan WatchEvent
+	Errors() <-chan error
+
+	// Close stops watching and closes the channels
+	Close() error
+}
+
+type watchItem struct {
+	event WatchEvent
+	err   error
+}
+
+type osWatcher struct {
+	path string
+
+	debounce time.Duration
+
+	// Sources send changes to items and the dispatcher delivers them
+	items  chan watchItem
+	events chan WatchEvent
+	errors chan error
+
+	stopSource func() error
+
+	closed    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	logger boshlog.Logger
+	logTag string
+}
+
+func newWatcher(path string, opts WatchOpts, logger boshlog.Logger) (Watcher, error) {
+	fi, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, bosherr.WrapErrorf(err, "Checking %s", path)
+	}
+
+	isDir := err == nil && fi.IsDir()
+
+	w := &osWatcher{
+		path: path,
+
+		debounce: opts.Debounce,
+
+		items:  make(chan watchItem),
+		events: make(chan WatchEvent),
+		errors: make(chan error),
+
+		closed: make(chan struct{}),
+
+		logger: logger,
+		logTag: "watcher",
+	}
+
+	if !isDir {
+		_, err = os.Stat(filepath.Dir(path))
+		if err != nil {
+			return nil, bosherr.WrapErrorf(err, "Checking dir of %s", path)
+		}
+	}
+
+	started := false
+
+	if !opts.Poll {
+		err = w.startNative()
+		if err == nil {
+			started = true
+		} else {
+			w.logger.Debug(w.logTag, "Polling %s since it cannot be watched: %s", path, err.Error())
+		}
+	}
+
+	if !started {
+		interval := opts.PollInterval
+		if interval <= 0 {
+			interval = DefaultWatchPollInterval
+		}
+
+		w.startPolling(interval)
+	}
+
+	w.wg.Add(1)
+	go w.dispatch()
+
+	return w, nil
+}
+
+func (w *osWatcher) Events() <-chan WatchEvent { return w.events }
+
+func (w *osWatcher) Errors() <-chan error { return w.errors }
+
+func (w *osWatcher) Close() error {
+	var err error
+
+	w.closeOnce.Do(func() {
+		close(w.closed)
+
+		if w.stopSource != nil {
+			err = w.stopSource()
+		}
+
+		w.wg.Wait()
+	})
+
+	return err
+}
+
+// emit sends a change to the dispatcher; it returns false once closed
+func (w *osWatcher) emit(item watchItem) bool {
+	select {
+	case w.items <- item:
+		return true
+	case <-w.closed:
+		return false
+	}
+}
+
+type pendingWatchEvent struct {
+	op       WatchOp
+	deadline time.Time
+}
+
+// dispatch delivers the changes sent by the source of the watcher,
+// merging changes to the same path made within the debounce period
+func (w *osWatcher) dispatch() {
+	defer w.wg.Done()
+	defer close(w.events)
+	defer close(w.errors)
+
+	pending := map[string]*pendingWatchEvent{}
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+	for {
+		select {
+		case <-w.closed:
+			timer.Stop()
+			return
+
+		case item := <-w.items:
+			if item.err != nil {
+				w.deliverError(item.err)
+				continue
+			}
+
+			if w.debounce <= 0 {
+				w.deliver(item.event)
+				continue
+			}
+
+			p, found := pending[item.event.Path]
+			if !found {
+				p = &pendingWatchEvent{}
+				pending[item.event.Path] = p
+			}
+
+			p.op |= item.event.Op
+			p.deadline = time.Now().Add(w.debounce)
+
+		case <-timer.C:
+			now := time.Now()
+
+			var due []string
+			for path, p := range pending {
+				if !p.deadline.After(now) {
+					due = append(due, path)
+				}
+			}
+
+			sort.Slice(due, func(i, j int) bool {
+				return pending[due[i]].deadline.Before(pending[due[j]].deadline)
+			})
+
+			for _, path := range due {
+				w.deliver(WatchEvent{Path: path, Op: pending[path].op})
+				delete(pending, path)
+			}
+		}
+
+		if len(pending) > 0 {
+			var next time.Time
+			for _, p := range pending {
+				if next.IsZero() || p.deadline.Before(next) {
+					next = p.deadline
+				}
+			}
+
+			timer.Reset(time.Until(next))
+		}
+	}
+}
+
+func (w *osWatcher) deliver(event WatchEvent) {
+	select {
+	case w.events <- event:
+	case <-w.closed:
+	}
+}
+
+func (w *osWatcher) deliverError(err error) {
+	select {
+	case w.errors <- err:
+	case <-w.closed:
+	}
+}
+
+type watchedFileState struct {
+	modTime time.Time
+	size    int64
+	mode    os.FileMode
+}
+
+func (w *osWatcher) startPolling(interval time.Duration) {
+	previous, err := w.snapshot()
+	if err != nil {
+		previous = map[string]watchedFileState{}
+	}
+
+	w.wg.Add(1)
+
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.closed:
+				return
+			case <-ticker.C:
+			}
+
+			current, err := w.snapshot()
+			if err != nil {
+				if !w.emit(watchItem{err: err}) {
+					return
+				}
+				continue
+			}
+
+			for _, event := range w.diffSnapshots(previous, current) {
+				if !w.emit(watchItem{event: event}) {
+					return
+				}
+			}
+
+			previous = current
+		}
+	}()
+}
+
+// snapshot returns the state of the watched file, or of the watched dir
+// and its children, depending on what the path currently is
+func (w *osWatcher) snapshot() (map[string]watchedFileState, error) {
+	states := map[string]watchedFileState{}
+
+	fi, err := os.Stat(w.path)
+	if os.IsNotExist(err) {
+		return states, nil
+	} else if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Checking %s", w.path)
+	}
+
+	states[w.path] = watchedFileState{modTime: fi.ModTime(), size: fi.Size(), mode: fi.Mode()}
+
+	if !fi.IsDir() {
+		return states, nil
+	}
+
+	entries, err := os.ReadDir(w.path)
+	if os.IsNotExist(err) {
+		return map[string]watchedFileState{}, nil
+	} else if err != nil {
+		return nil, bosherr.WrapErrorf(err, "Reading dir %s", w.path)
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since the dir was read
+			continue
+		}
+
+		states[filepath.Join(w.path, entry.Name())] = watchedFileState{modTime: info.ModTime(), size: info.Size(), mode: info.Mode()}
+	}
+
+	return states, nil
+}
+
+func (w *osWatcher) diffSnapshots(previous, current map[string]watchedFileState) []WatchEvent {
+	var events []WatchEvent
+
+	for path, state := range current {
+		previousState, found := previous[path]
+
+		switch {
+		case !found:
+			events = append(events, WatchEvent{Path: path, Op: WatchCreate})
+		case path == w.path && state.mode.IsDir() && previousState.mode.IsDir():
+			// Changes to the children of the dir are reported for them
+		case state != previousState:
+			events = append(events, WatchEvent{Path: path, Op: WatchWrite})
+		}
+	}
+
+	for path := range previous {
+		if _, found := current[path]; !found {
+			events = append(events, WatchEvent{Path: path, Op: WatchRemove})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+
+	return events
+}
@@ -0,0 +1,201 @@
+package system
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+const inotifyWatchMask = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF
+
+// inotifyWatches tracks the watch of the dir containing the watched path,
+// which reports the path itself being created, removed or renamed, and the
+// watch of the path while it is a dir, which reports changes to its children
+type inotifyWatches struct {
+	fd int
+
+	parentDir string
+	parentWd  int
+
+	pathWd int
+}
+
+// startNative watches with inotify. The path is watched through its dir so
+// that it is still watched after being removed or replaced, and a dir at the
+// path is watched again whenever it is created.
+func (w *osWatcher) startNative() error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return bosherr.WrapError(err, "Initializing inotify")
+	}
+
+	watches := &inotifyWatches{fd: fd, parentDir: filepath.Dir(w.path), parentWd: -1, pathWd: -1}
+
+	if watches.parentDir != w.path {
+		watches.parentWd, err = unix.InotifyAddWatch(fd, watches.parentDir, inotifyWatchMask)
+		if err != nil {
+			unix.Close(fd) //nolint:errcheck
+			return bosherr.WrapErrorf(err, "Adding inotify watch for %s", watches.parentDir)
+		}
+	}
+
+	err = w.watchPathDir(watches)
+	if err != nil {
+		unix.Close(fd) //nolint:errcheck
+		return err
+	}
+
+	// Reads of a non-blocking file use the poller, so closing it stops them
+	file := os.NewFile(uintptr(fd), "inotify")
+	w.stopSource = file.Close
+
+	w.wg.Add(1)
+
+	go func() {
+		defer w.wg.Done()
+
+		buf := make([]byte, 64*1024)
+
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				if !errors.Is(err, os.ErrClosed) {
+					w.emit(watchItem{err: bosherr.WrapError(err, "Reading inotify events")})
+				}
+				return
+			}
+
+			for _, item := range w.parseInotifyEvents(watches, buf[:n]) {
+				if !w.emit(item) {
+					return
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// watchPathDir watches the path when it is a dir. A path that is not a dir,
+// or that is gone again, is left to the watch of its parent dir.
+func (w *osWatcher) watchPathDir(watches *inotifyWatches) error {
+	fi, err := os.Stat(w.path)
+	if err != nil || !fi.IsDir() {
+		return nil
+	}
+
+	wd, err := unix.InotifyAddWatch(watches.fd, w.path, inotifyWatchMask|unix.IN_ONLYDIR)
+	if err != nil {
+		if errors.Is(err, unix.ENOENT) || errors.Is(err, unix.ENOTDIR) {
+			return nil
+		}
+		return bosherr.WrapErrorf(err, "Adding inotify watch for %s", w.path)
+	}
+
+	watches.pathWd = wd
+
+	return nil
+}
+
+// rewatchPathDir watches a dir created at the path. Its children that were
+// created before the watch was added are reported as created.
+func (w *osWatcher) rewatchPathDir(watches *inotifyWatches) []watchItem {
+	err := w.watchPathDir(watches)
+	if err != nil {
+		return []watchItem{{err: err}}
+	}
+
+	if watches.pathWd < 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(w.path)
+	if err != nil {
+		// Removed again, which the watch of its parent dir reports
+		return nil
+	}
+
+	var items []watchItem
+	for _, entry := range entries {
+		items = append(items, watchItem{event: WatchEvent{Path: filepath.Join(w.path, entry.Name()), Op: WatchCreate}})
+	}
+
+	return items
+}
+
+func (w *osWatcher) parseInotifyEvents(watches *inotifyWatches, buf []byte) []watchItem {
+	var items []watchItem
+
+	for offset := 0; offset+unix.SizeofInotifyEvent <= len(buf); {
+		raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+
+		nameStart := offset + unix.SizeofInotifyEvent
+		nameEnd := nameStart + int(raw.Len)
+		offset = nameEnd
+
+		if raw.Mask&unix.IN_Q_OVERFLOW != 0 {
+			items = append(items, watchItem{err: bosherr.Errorf("Inotify event queue of %s overflowed", w.path)})
+			continue
+		}
+
+		if int(raw.Wd) == watches.pathWd && raw.Mask&unix.IN_IGNORED != 0 {
+			// The dir at the path was removed, so it is watched again once it is created
+			watches.pathWd = -1
+			continue
+		}
+
+		name := string(buf[nameStart:nameEnd])
+		for len(name) > 0 && name[len(name)-1] == 0 {
+			name = name[:len(name)-1]
+		}
+
+		var path string
+
+		switch {
+		case int(raw.Wd) == watches.pathWd && name != "":
+			path = filepath.Join(w.path, name)
+		case int(raw.Wd) == watches.parentWd && name == filepath.Base(w.path):
+			path = w.path
+		default:
+			// Changes to the path itself are reported by the watch of its parent dir
+			continue
+		}
+
+		var op WatchOp
+
+		switch {
+		case raw.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+			op = WatchCreate
+		case raw.Mask&unix.IN_MODIFY != 0:
+			op = WatchWrite
+		case raw.Mask&(unix.IN_DELETE|unix.IN_DELETE_SELF) != 0:
+			op = WatchRemove
+		case raw.Mask&(unix.IN_MOVED_FROM|unix.IN_MOVE_SELF) != 0:
+			op = WatchRename
+		default:
+			continue
+		}
+
+		items = append(items, watchItem{event: WatchEvent{Path: path, Op: op}})
+
+		if path == w.path {
+			switch {
+			case op == WatchCreate && raw.Mask&unix.IN_ISDIR != 0:
+				items = append(items, w.rewatchPathDir(watches)...)
+
+			case (op == WatchRemove || op == WatchRename) && watches.pathWd >= 0:
+				// A dir renamed away is still watched, but no longer at the path
+				unix.InotifyRmWatch(watches.fd, uint32(watches.pathWd)) //nolint:errcheck
+				watches.pathWd = -1
+			}
+		}
+	}
+
+	return items
+}
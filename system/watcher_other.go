@@ -0,0 +1,12 @@
+//go:build !linux
+
+package system
+
+import (
+	bosherr "github.com/cloudfoundry/bosh-utils/errors"
+)
+
+// startNative fails so that files are polled for changes
+func (w *osWatcher) startNative() error {
+	return bosherr.Error("Watching files is only supported on Linux")
+}
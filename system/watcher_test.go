@@ -0,0 +1,188 @@
+package system_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	. "github.com/cloudfoundry/bosh-utils/system"
+)
+
+var _ = Describe("Watch", func() {
+	var (
+		osFs FileSystem
+		dir  string
+	)
+
+	BeforeEach(func() {
+		osFs = createOsFs()
+		dir = GinkgoT().TempDir()
+	})
+
+	receiveEvent := func(watcher Watcher) WatchEvent {
+		var event WatchEvent
+		Eventually(watcher.Events(), 5*time.Second).Should(Receive(&event))
+		return event
+	}
+
+	// Truncating and writing a file may be reported as separate writes
+	receiveEventAfterWrites := func(watcher Watcher) WatchEvent {
+		event := receiveEvent(watcher)
+		for event.Op == WatchWrite {
+			event = receiveEvent(watcher)
+		}
+		return event
+	}
+
+	for _, poll := range []bool{false, true} {
+		poll := poll
+
+		Context("when polling is "+map[bool]string{false: "disabled", true: "enabled"}[poll], func() {
+			var opts WatchOpts
+
+			BeforeEach(func() {
+				opts = WatchOpts{Poll: poll, PollInterval: 20 * time.Millisecond}
+			})
+
+			It("reports creating, writing and removing the children of a dir", func() {
+				watcher, err := osFs.Watch(dir, opts)
+				Expect(err).ToNot(HaveOccurred())
+				defer watcher.Close() //nolint:errcheck
+
+				path := filepath.Join(dir, "file")
+
+				Expect(os.WriteFile(path, nil, 0644)).To(Succeed())
+				Expect(receiveEvent(watcher)).To(Equal(WatchEvent{Path: path, Op: WatchCreate}))
+
+				Expect(os.WriteFile(path, []byte("content"), 0644)).To(Succeed())
+				Expect(receiveEvent(watcher)).To(Equal(WatchEvent{Path: path, Op: WatchWrite}))
+
+				Expect(os.Remove(path)).To(Succeed())
+				Expect(receiveEventAfterWrites(watcher)).To(Equal(WatchEvent{Path: path, Op: WatchRemove}))
+			})
+
+			It("reports changes to a file that does not exist yet, ignoring other files", func() {
+				path := filepath.Join(dir, "cert.pem")
+
+				watcher, err := osFs.Watch(path, opts)
+				Expect(err).ToNot(HaveOccurred())
+				defer watcher.Close() //nolint:errcheck
+
+				Expect(os.WriteFile(filepath.Join(dir, "other"), []byte("content"), 0644)).To(Succeed())
+
+				Expect(osFs.WriteFileAtomically(path, []byte("content"))).To(Succeed())
+				Expect(receiveEvent(watcher)).To(Equal(WatchEvent{Path: path, Op: WatchCreate}))
+
+				Expect(os.WriteFile(path, []byte("new content"), 0644)).To(Succeed())
+				Expect(receiveEvent(watcher)).To(Equal(WatchEvent{Path: path, Op: WatchWrite}))
+			})
+
+			It("keeps reporting changes to the children of a dir that is removed and created again", func() {
+				watcher, err := osFs.Watch(dir, opts)
+				Expect(err).ToNot(HaveOccurred())
+				defer watcher.Close() //nolint:errcheck
+
+				Expect(os.Remove(dir)).To(Succeed())
+				Expect(receiveEvent(watcher)).To(Equal(WatchEvent{Path: dir, Op: WatchRemove}))
+
+				Expect(os.Mkdir(dir, 0755)).To(Succeed())
+				Expect(receiveEvent(watcher)).To(Equal(WatchEvent{Path: dir, Op: WatchCreate}))
+
+				path := filepath.Join(dir, "file")
+
+				Expect(os.WriteFile(path, nil, 0644)).To(Succeed())
+				Expect(receiveEvent(watcher)).To(Equal(WatchEvent{Path: path, Op: WatchCreate}))
+			})
+
+			It("reports changes to the children of a dir created after watching its path", func() {
+				subDir := filepath.Join(dir, "sub")
+
+				watcher, err := osFs.Watch(subDir, opts)
+				Expect(err).ToNot(HaveOccurred())
+				defer watcher.Close() //nolint:errcheck
+
+				Expect(os.Mkdir(subDir, 0755)).To(Succeed())
+				Expect(receiveEvent(watcher)).To(Equal(WatchEvent{Path: subDir, Op: WatchCreate}))
+
+				path := filepath.Join(subDir, "file")
+
+				Expect(os.WriteFile(path, nil, 0644)).To(Succeed())
+				Expect(receiveEvent(watcher)).To(Equal(WatchEvent{Path: path, Op: WatchCreate}))
+
+				Expect(os.Remove(path)).To(Succeed())
+				Expect(receiveEvent(watcher)).To(Equal(WatchEvent{Path: path, Op: WatchRemove}))
+			})
+
+			It("merges changes to a path made within the debounce period", func() {
+				opts.Debounce = 300 * time.Millisecond
+
+				watcher, err := osFs.Watch(dir, opts)
+				Expect(err).ToNot(HaveOccurred())
+				defer watcher.Close() //nolint:errcheck
+
+				path := filepath.Join(dir, "file")
+
+				file, err := os.Create(path)
+				Expect(err).ToNot(HaveOccurred())
+
+				for i := 0; i < 5; i++ {
+					_, err = file.WriteString("content")
+					Expect(err).ToNot(HaveOccurred())
+					time.Sleep(10 * time.Millisecond)
+				}
+
+				Expect(file.Close()).To(Succeed())
+
+				event := receiveEvent(watcher)
+				Expect(event.Path).To(Equal(path))
+				Expect(event.Op.Has(WatchCreate)).To(BeTrue())
+
+				Consistently(watcher.Events(), 400*time.Millisecond).ShouldNot(Receive())
+			})
+
+			It("closes the channels when closed", func() {
+				watcher, err := osFs.Watch(dir, opts)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(watcher.Close()).To(Succeed())
+
+				Eventually(watcher.Events()).Should(BeClosed())
+				Eventually(watcher.Errors()).Should(BeClosed())
+			})
+		})
+	}
+
+	It("reports renames with inotify", func() {
+		if runtime.GOOS != "linux" {
+			Skip("Renames are only reported on Linux")
+		}
+
+		watcher, err := osFs.Watch(dir, WatchOpts{})
+		Expect(err).ToNot(HaveOccurred())
+		defer watcher.Close() //nolint:errcheck
+
+		oldPath := filepath.Join(dir, "old")
+		newPath := filepath.Join(dir, "new")
+
+		Expect(os.WriteFile(oldPath, nil, 0644)).To(Succeed())
+		Expect(receiveEvent(watcher)).To(Equal(WatchEvent{Path: oldPath, Op: WatchCreate}))
+
+		Expect(os.Rename(oldPath, newPath)).To(Succeed())
+		Expect(receiveEvent(watcher)).To(Equal(WatchEvent{Path: oldPath, Op: WatchRename}))
+		Expect(receiveEvent(watcher)).To(Equal(WatchEvent{Path: newPath, Op: WatchCreate}))
+	})
+
+	It("fails when the dir of the file does not exist", func() {
+		_, err := osFs.Watch(filepath.Join(dir, "missing", "file"), WatchOpts{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("describes ops", func() {
+		Expect((WatchCreate | WatchWrite).String()).To(Equal("create|write"))
+		Expect(WatchRename.String()).To(Equal("rename"))
+	})
+})